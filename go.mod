@@ -1,12 +1,41 @@
 // go.mod
 module github.com/Clean1ines/scps
 
-go 1.18
+go 1.21
 
 require (
-    cloud.google.com/go/logging v1.8.0       // Клиент Google Cloud Logging
-    cloud.google.com/go/pubsub v1.14.0         // Клиент Google Cloud Pub/Sub
-    github.com/agnivade/levenshtein v1.2.0      // Для вычисления расстояния Левенштейна (fuzzy matching)
-    github.com/go-redis/redis/v8 v8.11.5        // Клиент Redis для хранения токенов, кэша и сессий
-    github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1 // Telegram Bot API
-)
\ No newline at end of file
+	cloud.google.com/go/logging v1.8.0 // Клиент Google Cloud Logging
+	cloud.google.com/go/pubsub v1.30.0 // Клиент Google Cloud Pub/Sub
+	github.com/agnivade/levenshtein v1.2.0 // Для вычисления расстояния Левенштейна (fuzzy matching)
+	github.com/go-redis/redis/v8 v8.11.5 // Клиент Redis для хранения токенов, кэша и сессий
+	github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1 // Telegram Bot API
+)
+
+require (
+	cloud.google.com/go v0.110.2 // indirect
+	cloud.google.com/go/compute/metadata v0.2.3 // indirect
+	cloud.google.com/go/iam v1.1.0 // indirect
+	cloud.google.com/go/longrunning v0.5.0 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/google/go-cmp v0.5.9 // indirect
+	github.com/google/s2a-go v0.1.4 // indirect
+	github.com/googleapis/enterprise-certificate-proxy v0.2.3 // indirect
+	github.com/googleapis/gax-go/v2 v2.11.0 // indirect
+	go.opencensus.io v0.24.0 // indirect
+	golang.org/x/crypto v0.9.0 // indirect
+	golang.org/x/net v0.10.0 // indirect
+	golang.org/x/oauth2 v0.8.0 // indirect
+	golang.org/x/sync v0.2.0 // indirect
+	golang.org/x/sys v0.8.0 // indirect
+	golang.org/x/text v0.9.0 // indirect
+	google.golang.org/api v0.126.0 // indirect
+	google.golang.org/appengine v1.6.7 // indirect
+	google.golang.org/genproto v0.0.0-20230530153820-e85fd2cbaebc // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20230530153820-e85fd2cbaebc // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20230530153820-e85fd2cbaebc // indirect
+	google.golang.org/grpc v1.55.0 // indirect
+	google.golang.org/protobuf v1.30.0 // indirect
+)
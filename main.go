@@ -3,12 +3,13 @@ package main
 
 import (
     "context"
-    "encoding/json"
     "log"
     "net/http"
     "os"
+    "strconv"
     "time"
 
+    "github.com/Clean1ines/scps/pkg/auth"
     "github.com/Clean1ines/scps/pkg/health"
     "github.com/Clean1ines/scps/pkg/logging"
     "github.com/Clean1ines/scps/pkg/oauth"
@@ -42,11 +43,46 @@ func main() {
         log.Fatalf("Ошибка подключения к Redis: %v", err)
     }
 
-    // Инициализация OAuth для Spotify и YouTube
+    // Ключи шифрования токенов OAuth, хранящихся в Redis
+    keyring, err := oauth.LoadKeyring(os.Getenv("TOKEN_ENCRYPTION_KEYS"), os.Getenv("TOKEN_ENCRYPTION_KEY_FILE"), os.Getenv("TOKEN_ENCRYPTION_KEY_ID"))
+    if err != nil {
+        logger.Errorf("Ошибка загрузки ключей шифрования токенов: %v", err)
+        log.Fatalf("Ошибка загрузки ключей шифрования токенов: %v", err)
+    }
+    if keyring == nil {
+        // Хранение токенов в открытом виде допускается только явно (например, для локальной отладки).
+        if allow, _ := strconv.ParseBool(os.Getenv("TOKEN_ENCRYPTION_ALLOW_PLAINTEXT")); !allow {
+            logger.Errorf("Ключи шифрования токенов не заданы: укажите TOKEN_ENCRYPTION_KEYS или TOKEN_ENCRYPTION_KEY_FILE")
+            log.Fatalf("Ключи шифрования токенов не заданы: укажите TOKEN_ENCRYPTION_KEYS или TOKEN_ENCRYPTION_KEY_FILE (или TOKEN_ENCRYPTION_ALLOW_PLAINTEXT=1)")
+        }
+        logger.Errorf("Ключи шифрования токенов не заданы: токены сохраняются в Redis без шифрования (TOKEN_ENCRYPTION_ALLOW_PLAINTEXT)")
+    }
+    oauth.SetKeyring(keyring)
+
+    // Команда "scps rotate-token-keys" перешифровывает сохраненные токены основным ключом и завершает работу
+    if len(os.Args) > 1 && os.Args[1] == "rotate-token-keys" {
+        rotated, err := oauth.RotateTokenKeys(ctx, redisClient)
+        if err != nil {
+            logger.Errorf("Ошибка ротации ключей шифрования (перешифровано токенов: %d): %v", rotated, err)
+            log.Fatalf("Ошибка ротации ключей шифрования: %v", err)
+        }
+        logger.Infof("Токены перешифрованы ключом %s: %d", keyring.Primary(), rotated)
+        return
+    }
+
+    // Инициализация OAuth для Spotify и YouTube; state подписывается общим для экземпляров ключом
+    stateSecret := os.Getenv("OAUTH_STATE_SECRET")
+    if stateSecret == "" {
+        logger.Errorf("Ключ подписи state OAuth не задан: укажите OAUTH_STATE_SECRET")
+        log.Fatalf("Ключ подписи state OAuth не задан: укажите OAUTH_STATE_SECRET")
+    }
+    oauth.SetStateSecret(stateSecret)
+    // Доступ к HTTP API: токен администратора и ключ подписи токенов пользователей (команда /apitoken)
+    auth.Configure(os.Getenv("ADMIN_API_TOKEN"), os.Getenv("API_TOKEN_SECRET"))
     oauth.InitSpotify(os.Getenv("SPOTIFY_CLIENT_ID"), os.Getenv("SPOTIFY_CLIENT_SECRET"), os.Getenv("SPOTIFY_REDIRECT_URI"), redisClient, logger)
     oauth.InitYouTube(os.Getenv("YOUTUBE_CLIENT_ID"), os.Getenv("YOUTUBE_CLIENT_SECRET"), os.Getenv("YOUTUBE_REDIRECT_URI"), redisClient, logger)
 
-    // Запуск фонового процесса обновления токенов Spotify каждые 5 минут
+    // Запуск фонового процесса обновления токенов Spotify и YouTube каждые 5 минут
     go autoRefreshToken(ctx, redisClient, logger)
     // Запуск периодической двусторонней синхронизации (каждые 30 минут)
     go sync.RunPeriodicSync(ctx, redisClient, logger)
@@ -57,7 +93,6 @@ func main() {
         logger.Errorf("Ошибка инициализации Pub/Sub: %v", err)
         log.Fatalf("Ошибка инициализации Pub/Sub: %v", err)
     }
-    go pubsub.StartWorkers(ctx, psClient, logger, redisClient)
 
     // Инициализация Telegram-бота для управления синхронизацией
     bot, err := telegram.NewBot(os.Getenv("TELEGRAM_BOT_TOKEN"), redisClient, logger, psClient)
@@ -65,6 +100,11 @@ func main() {
         logger.Errorf("Ошибка инициализации Telegram-бота: %v", err)
         log.Fatalf("Ошибка инициализации Telegram-бота: %v", err)
     }
+    // Обработчики задач уведомляют пользователей через бота
+    psClient.SetNotifier(bot)
+    // О результате авторизации в Spotify и YouTube пользователь узнает в чате
+    oauth.SetNotifier(bot)
+    go pubsub.StartWorkers(ctx, psClient, logger, redisClient)
     go bot.Start()
 
     // Настройка HTTP-сервера: OAuth callback, эндпоинт здоровья, ручной запуск синхронизации
@@ -72,7 +112,11 @@ func main() {
     mux.HandleFunc("/spotify/callback", oauth.SpotifyCallbackHandler)
     mux.HandleFunc("/youtube/callback", oauth.YouTubeCallbackHandler)
     mux.HandleFunc("/health", health.HealthHandler)
-    mux.HandleFunc("/sync", sync.SyncHandler) // Эндпоинт для ручной синхронизации
+    mux.HandleFunc("/sync", auth.Require(sync.NewSyncHandler(redisClient, psClient, logger))) // Эндпоинт для ручной синхронизации
+    // Состояние задач, просмотр и повторный запуск задач, не выполненных за все попытки
+    mux.HandleFunc("/jobs/", auth.Require(psClient.JobHandler))
+    mux.HandleFunc("/dead-letters", auth.Require(psClient.DeadLetterHandler))
+    mux.HandleFunc("/dead-letters/", auth.Require(psClient.DeadLetterHandler))
 
     server := &http.Server{
         Addr:         ":" + port,
@@ -87,34 +131,17 @@ func main() {
     }
 }
 
-// autoRefreshToken обновляет Spotify access_token каждые 5 минут, используя refresh_token.
+// autoRefreshToken каждые 5 минут обновляет токены Spotify и YouTube, истекающие в ближайшее время.
+// Истекший токен обновляется и при использовании (см. oauth.AccessToken).
 func autoRefreshToken(ctx context.Context, redisClient *storage.RedisClient, logger *logging.Logger) {
     ticker := time.NewTicker(5 * time.Minute)
     defer ticker.Stop()
     for {
-        <-ticker.C
-        tokenJSON, err := redisClient.Get(ctx, "spotify_token").Result()
-        if err != nil {
-            logger.Errorf("autoRefreshToken: ошибка получения токена: %v", err)
-            continue
-        }
-        var tokenData map[string]interface{}
-        if err := json.Unmarshal([]byte(tokenJSON), &tokenData); err != nil {
-            logger.Errorf("autoRefreshToken: ошибка парсинга токена: %v", err)
-            continue
-        }
-        refreshToken, ok := tokenData["refresh_token"].(string)
-        if !ok || refreshToken == "" {
-            logger.Errorf("autoRefreshToken: refresh_token отсутствует")
-            continue
-        }
-        newToken, err := oauth.RefreshSpotifyToken(refreshToken)
-        if err != nil {
-            logger.Errorf("autoRefreshToken: ошибка обновления токена: %v", err)
-            continue
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            oauth.RefreshExpiring(ctx, redisClient, logger)
         }
-        newJSON, _ := json.Marshal(newToken)
-        redisClient.Set(ctx, "spotify_token", newJSON, time.Hour)
-        logger.Infof("autoRefreshToken: токен обновлен автоматически")
     }
 }
\ No newline at end of file
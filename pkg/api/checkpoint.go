@@ -0,0 +1,69 @@
+// pkg/api/checkpoint.go
+package api
+
+import "context"
+
+// PageCursor — прочитанная часть плейлиста, позволяющая продолжить постраничное чтение.
+type PageCursor struct {
+    List *TrackList `json:"list"`
+    Next string     `json:"next,omitempty"` // URL (Spotify) или pageToken (YouTube) следующей страницы
+    Read int        `json:"read,omitempty"` // Число прочитанных элементов с учетом пропущенных
+    Done bool       `json:"done,omitempty"` // Плейлист прочитан полностью (или до лимита)
+}
+
+// Page — одна прочитанная страница плейлиста: ее треки и состояние чтения после нее.
+// Контрольная точка хранит страницы по отдельности, чтобы сохранение очередной страницы
+// не перезаписывало весь прочитанный список.
+type Page struct {
+    Tracks    []Track `json:"tracks"`
+    Total     int     `json:"total"`
+    Truncated bool    `json:"truncated,omitempty"`
+    Next      string  `json:"next,omitempty"`
+    Read      int     `json:"read,omitempty"`
+    Done      bool    `json:"done,omitempty"`
+}
+
+// Apply добавляет страницу page к прочитанной части плейлиста.
+func (c *PageCursor) Apply(page *Page) {
+    if c.List == nil {
+        c.List = &TrackList{Tracks: []Track{}}
+    }
+    c.List.Tracks = append(c.List.Tracks, page.Tracks...)
+    c.List.Total = page.Total
+    c.List.Truncated = page.Truncated
+    c.Next, c.Read, c.Done = page.Next, page.Read, page.Done
+}
+
+// PageCheckpointer сохраняет состояние чтения плейлистов после каждой страницы, чтобы
+// прерванная синхронизация продолжила чтение с места остановки.
+type PageCheckpointer interface {
+    // LoadCursor возвращает сохраненное состояние чтения плейлиста или nil.
+    LoadCursor(platform, playlistID string) *PageCursor
+    // SavePage сохраняет очередную прочитанную страницу плейлиста.
+    SavePage(platform, playlistID string, page *Page)
+}
+
+type checkpointerKey struct{}
+
+// WithPageCheckpointer возвращает контекст, при чтении плейлистов с которым состояние чтения
+// сохраняется в c и восстанавливается из него.
+func WithPageCheckpointer(ctx context.Context, c PageCheckpointer) context.Context {
+    return context.WithValue(ctx, checkpointerKey{}, c)
+}
+
+// loadCursor возвращает сохраненное состояние чтения плейлиста из контекста или nil.
+func loadCursor(ctx context.Context, platform, playlistID string) *PageCursor {
+    if c, ok := ctx.Value(checkpointerKey{}).(PageCheckpointer); ok {
+        if cursor := c.LoadCursor(platform, playlistID); cursor != nil && cursor.List != nil {
+            return cursor
+        }
+    }
+    return nil
+}
+
+// savePage сохраняет прочитанную страницу плейлиста, если в контексте задан PageCheckpointer.
+func savePage(ctx context.Context, platform, playlistID string, page *Page) {
+    if c, ok := ctx.Value(checkpointerKey{}).(PageCheckpointer); ok {
+        c.SavePage(platform, playlistID, page)
+    }
+}
\ No newline at end of file
@@ -0,0 +1,159 @@
+// pkg/api/errors.go
+package api
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// Причины ошибок Google API, означающие исчерпание суточной квоты проекта.
+var quotaReasons = map[string]bool{
+    "quotaExceeded":      true,
+    "dailyLimitExceeded": true,
+}
+
+// StatusError — ошибочный HTTP-ответ API сервиса.
+type StatusError struct {
+    Message    string        // Описание неудавшейся операции
+    StatusCode int           // HTTP-статус ответа
+    RetryAfter time.Duration // Значение заголовка Retry-After; 0, если заголовка нет
+    Reason     string        // Причина из тела ответа Google API (error.errors[0].reason), если есть
+}
+
+// Error возвращает описание ошибки со статусом ответа.
+func (e *StatusError) Error() string {
+    return fmt.Sprintf("%s, статус: %d", e.Message, e.StatusCode)
+}
+
+// Temporary сообщает, имеет ли смысл повторить запрос: превышен лимит запросов (429) или ошибка сервера (5xx).
+func (e *StatusError) Temporary() bool {
+    return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// QuotaExceeded сообщает, исчерпана ли суточная квота API (YouTube Data API отвечает 403 quotaExceeded).
+func (e *StatusError) QuotaExceeded() bool {
+    return e.StatusCode == http.StatusForbidden && quotaReasons[e.Reason]
+}
+
+// newStatusError создает StatusError по ответу, разбирая заголовок Retry-After и причину
+// ошибки Google API. Тело ответа должно быть еще не закрыто.
+func newStatusError(resp *http.Response, message string) *StatusError {
+    return &StatusError{
+        Message:    message,
+        StatusCode: resp.StatusCode,
+        RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+        Reason:     parseErrorReason(resp.Body),
+    }
+}
+
+// parseErrorReason читает причину ошибки из тела ответа Google API:
+// {"error": {"errors": [{"reason": "quotaExceeded"}]}}. Для других форматов возвращает "".
+func parseErrorReason(body io.Reader) string {
+    var payload struct {
+        Error struct {
+            Errors []struct {
+                Reason string `json:"reason"`
+            } `json:"errors"`
+        } `json:"error"`
+    }
+    if body == nil || json.NewDecoder(io.LimitReader(body, 64<<10)).Decode(&payload) != nil {
+        return ""
+    }
+    if len(payload.Error.Errors) == 0 {
+        return ""
+    }
+    return payload.Error.Errors[0].Reason
+}
+
+// parseRetryAfter разбирает Retry-After в секундах или в виде HTTP-даты.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+    if v == "" {
+        return 0
+    }
+    if seconds, err := strconv.Atoi(v); err == nil && seconds > 0 {
+        return time.Duration(seconds) * time.Second
+    }
+    if t, err := http.ParseTime(v); err == nil && t.After(now) {
+        return t.Sub(now)
+    }
+    return 0
+}
+
+// QuotaResetAt возвращает время, когда снова можно выполнять запросы, если err вызвана
+// исчерпанием суточной квоты YouTube. Квота YouTube Data API сбрасывается в полночь
+// по тихоокеанскому времени.
+func QuotaResetAt(err error, now time.Time) (time.Time, bool) {
+    var statusErr *StatusError
+    if !errors.As(err, &statusErr) || !statusErr.QuotaExceeded() {
+        return time.Time{}, false
+    }
+    loc, lerr := time.LoadLocation("America/Los_Angeles")
+    if lerr != nil {
+        loc = time.FixedZone("PST", -8*60*60)
+    }
+    local := now.In(loc)
+    return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, loc), true
+}
+
+// IsRetryable сообщает, может ли повтор операции, завершившейся ошибкой err, оказаться успешным.
+// Ответы API со статусами 4xx (кроме 429) и отмена контекста повторять бессмысленно;
+// остальные ошибки (сетевые, 429, 5xx) считаются временными.
+func IsRetryable(err error) bool {
+    if err == nil || errors.Is(err, context.Canceled) {
+        return false
+    }
+    var statusErr *StatusError
+    if errors.As(err, &statusErr) {
+        return statusErr.Temporary()
+    }
+    return true
+}
+
+// RetryAfter возвращает задержку, запрошенную сервисом в заголовке Retry-After, или 0.
+func RetryAfter(err error) time.Duration {
+    var statusErr *StatusError
+    if errors.As(err, &statusErr) {
+        return statusErr.RetryAfter
+    }
+    return 0
+}
+
+// PartialError — ошибка операции над несколькими треками, часть которых успела примениться.
+// Треки применяются по порядку: первые Applied треков обработаны, остальные нет.
+type PartialError struct {
+    Applied int
+    Err     error
+}
+
+// Error возвращает описание ошибки с числом обработанных треков.
+func (e *PartialError) Error() string {
+    return fmt.Sprintf("%v (обработано треков: %d)", e.Err, e.Applied)
+}
+
+// Unwrap возвращает исходную ошибку.
+func (e *PartialError) Unwrap() error {
+    return e.Err
+}
+
+// partialError оборачивает err в PartialError, если хотя бы один трек обработан.
+func partialError(applied int, err error) error {
+    if applied == 0 {
+        return err
+    }
+    return &PartialError{Applied: applied, Err: err}
+}
+
+// AppliedCount возвращает число треков, обработанных до ошибки err (0, если err не PartialError).
+func AppliedCount(err error) int {
+    var partial *PartialError
+    if errors.As(err, &partial) {
+        return partial.Applied
+    }
+    return 0
+}
@@ -0,0 +1,44 @@
+// pkg/api/paging.go
+package api
+
+// Максимальные размеры страницы, допускаемые API сервисов.
+const (
+    spotifyMaxPageSize = 100
+    youtubeMaxPageSize = 50
+    // DefaultMaxItems ограничивает число читаемых элементов плейлиста по умолчанию.
+    DefaultMaxItems = 10000
+)
+
+// PageOptions задает параметры постраничного чтения плейлистов.
+type PageOptions struct {
+    PageSize int // Размер страницы; 0 или значение больше допустимого — максимум сервиса
+    MaxItems int // Максимальное число читаемых элементов; 0 — DefaultMaxItems
+}
+
+// DefaultPageOptions возвращает параметры чтения по умолчанию.
+func DefaultPageOptions() PageOptions {
+    return PageOptions{MaxItems: DefaultMaxItems}
+}
+
+// pageSize возвращает размер страницы с учетом ограничения сервиса.
+func (o PageOptions) pageSize(max int) int {
+    if o.PageSize <= 0 || o.PageSize > max {
+        return max
+    }
+    return o.PageSize
+}
+
+// maxItems возвращает лимит элементов с учетом значения по умолчанию.
+func (o PageOptions) maxItems() int {
+    if o.MaxItems <= 0 {
+        return DefaultMaxItems
+    }
+    return o.MaxItems
+}
+
+// TrackList — результат чтения плейлиста.
+type TrackList struct {
+    Tracks    []Track `json:"tracks"`
+    Total     int     `json:"total"`     // Общее число элементов по данным сервиса
+    Truncated bool    `json:"truncated"` // Чтение остановлено по лимиту MaxItems
+}
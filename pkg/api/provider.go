@@ -0,0 +1,98 @@
+// pkg/api/provider.go
+package api
+
+import (
+    "context"
+    "errors"
+    "fmt"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// Имена платформ, совпадающие со значениями Session.SourcePlatform/TargetPlatform в Telegram-боте.
+const (
+    PlatformSpotify = "spotify"
+    PlatformYouTube = "youtube"
+)
+
+// ErrTrackNotFound возвращается, если трека с указанным ID нет в каталоге сервиса.
+var ErrTrackNotFound = errors.New("трек не найден")
+
+// Track представляет трек в плейлисте любого сервиса.
+type Track struct {
+    ID         string `json:"id"`      // Spotify track ID или YouTube videoId
+    ItemID     string `json:"item_id"` // ID элемента плейлиста (YouTube playlistItem), нужен для удаления
+    Name       string `json:"name"`
+    Artist     string `json:"artist"`
+    Album      string `json:"album,omitempty"`
+    ISRC       string `json:"isrc,omitempty"`        // Есть только у треков Spotify
+    DurationMs int    `json:"duration_ms,omitempty"` // 0, если длительность неизвестна
+    Explicit   bool   `json:"explicit,omitempty"`
+}
+
+// PlaylistInfo содержит метаданные плейлиста.
+type PlaylistInfo struct {
+    ID         string `json:"id"`
+    Title      string `json:"title"`
+    Owner      string `json:"owner"`
+    TrackCount int    `json:"track_count"`
+}
+
+// Provider абстрагирует музыкальный сервис за единым API работы с плейлистами.
+type Provider interface {
+    // Name возвращает имя платформы ("spotify", "youtube").
+    Name() string
+    // GetPlaylist возвращает все треки плейлиста (с учетом постраничного чтения).
+    GetPlaylist(ctx context.Context, playlistID string) (*TrackList, error)
+    // GetPlaylistInfo возвращает метаданные плейлиста.
+    GetPlaylistInfo(ctx context.Context, playlistID string) (*PlaylistInfo, error)
+    // AddTracks добавляет треки в плейлист.
+    AddTracks(ctx context.Context, playlistID string, tracks []Track) error
+    // RemoveTracks удаляет треки из плейлиста.
+    RemoveTracks(ctx context.Context, playlistID string, tracks []Track) error
+    // MoveTrack перемещает трек с позиции from так, чтобы он оказался на позиции to (позиции с нуля).
+    MoveTrack(ctx context.Context, playlistID string, track Track, from, to int) error
+    // GetTrack возвращает трек каталога по ID или ErrTrackNotFound.
+    GetTrack(ctx context.Context, trackID string) (*Track, error)
+    // Search ищет треки в каталоге сервиса.
+    Search(ctx context.Context, query string, limit int) ([]Track, error)
+    // ResolveURL извлекает ID плейлиста из URL (или возвращает сам ID).
+    ResolveURL(url string) (string, error)
+}
+
+// Registry хранит провайдеров, индексированных по имени платформы.
+type Registry struct {
+    providers map[string]Provider
+}
+
+// NewRegistry создает реестр из переданных провайдеров.
+func NewRegistry(providers ...Provider) *Registry {
+    r := &Registry{providers: map[string]Provider{}}
+    for _, p := range providers {
+        r.Register(p)
+    }
+    return r
+}
+
+// NewDefaultRegistry создает реестр с провайдерами Spotify и YouTube, выполняющими запросы
+// от имени пользователя chatID (ID чата Telegram).
+func NewDefaultRegistry(redisClient *redis.Client, chatID int64, youtubeAPIKey string, paging PageOptions) *Registry {
+    return NewRegistry(
+        NewSpotifyProvider(redisClient, chatID, paging),
+        NewYouTubeProvider(redisClient, chatID, youtubeAPIKey, paging),
+    )
+}
+
+// Register добавляет провайдера в реестр, заменяя существующего с тем же именем.
+func (r *Registry) Register(p Provider) {
+    r.providers[p.Name()] = p
+}
+
+// Get возвращает провайдера по имени платформы.
+func (r *Registry) Get(platform string) (Provider, error) {
+    p, ok := r.providers[platform]
+    if !ok {
+        return nil, fmt.Errorf("неизвестная платформа: %s", platform)
+    }
+    return p, nil
+}
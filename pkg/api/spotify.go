@@ -2,35 +2,122 @@
 package api
 
 import (
+    "bytes"
     "context"
     "encoding/json"
     "errors"
     "fmt"
     "net/http"
+    "net/url"
+    "strings"
 
-    "github.com/Clean1ines/scps/pkg/logging"
     "github.com/go-redis/redis/v8"
 )
 
-// Track представляет аудиотрек в плейлисте Spotify.
-type Track struct {
-    ID     string `json:"id"`
-    Name   string `json:"name"`
-    Artist string `json:"artist"`
+// spotifyTrackObject представляет объект трека в ответах Spotify API.
+type spotifyTrackObject struct {
+    ID      string `json:"id"`
+    Name    string `json:"name"`
+    Artists []struct {
+        Name string `json:"name"`
+    } `json:"artists"`
+    Album struct {
+        Name string `json:"name"`
+    } `json:"album"`
+    DurationMs  int  `json:"duration_ms"`
+    Explicit    bool `json:"explicit"`
+    ExternalIDs struct {
+        ISRC string `json:"isrc"`
+    } `json:"external_ids"`
 }
 
-// PlaylistResponse представляет ответ Spotify API для плейлиста.
-type PlaylistResponse struct {
-    Items []Track `json:"items"`
+// toTrack преобразует объект Spotify в Track.
+func (o spotifyTrackObject) toTrack() Track {
+    artists := []string{}
+    for _, a := range o.Artists {
+        artists = append(artists, a.Name)
+    }
+    return Track{
+        ID:         o.ID,
+        Name:       o.Name,
+        Artist:     strings.Join(artists, ", "),
+        Album:      o.Album.Name,
+        ISRC:       o.ExternalIDs.ISRC,
+        DurationMs: o.DurationMs,
+        Explicit:   o.Explicit,
+    }
 }
 
-// GetSpotifyPlaylist получает треки из плейлиста Spotify по его ID.
-func GetSpotifyPlaylist(ctx context.Context, redisClient *redis.Client, playlistID string) ([]Track, error) {
-    token, err := redisClient.Get(ctx, "spotify_token").Result()
+// spotifyPlaylistResponse представляет страницу ответа Spotify API для треков плейлиста.
+type spotifyPlaylistResponse struct {
+    Items []struct {
+        Track *spotifyTrackObject `json:"track"`
+    } `json:"items"`
+    Next  string `json:"next"`
+    Total int    `json:"total"`
+}
+
+// GetSpotifyPlaylist получает все треки плейлиста Spotify по его ID, следуя ссылкам next
+// до конца плейлиста или до лимита opts.MaxItems. Состояние чтения сохраняется после каждой
+// страницы, если в контексте задан PageCheckpointer.
+func GetSpotifyPlaylist(ctx context.Context, redisClient *redis.Client, chatID int64, playlistID string, opts PageOptions) (*TrackList, error) {
+    cursor := loadCursor(ctx, PlatformSpotify, playlistID)
+    if cursor != nil && cursor.Done {
+        return cursor.List, nil
+    }
+    token, err := spotifyToken(ctx, redisClient, chatID)
     if err != nil {
-        return nil, fmt.Errorf("не удалось получить токен Spotify: %v", err)
+        return nil, err
+    }
+    maxItems := opts.maxItems()
+    list := &TrackList{Tracks: []Track{}}
+    read := 0
+    next := fmt.Sprintf("https://api.spotify.com/v1/playlists/%s/tracks?limit=%d", playlistID, opts.pageSize(spotifyMaxPageSize))
+    if cursor != nil {
+        // Продолжаем чтение, прерванное предыдущим запуском синхронизации.
+        list, read, next = cursor.List, cursor.Read, cursor.Next
     }
-    req, err := http.NewRequest("GET", fmt.Sprintf("https://api.spotify.com/v1/playlists/%s/tracks", playlistID), nil)
+    for next != "" {
+        pr, err := getSpotifyPlaylistPage(ctx, token, next)
+        if err != nil {
+            return nil, err
+        }
+        list.Total = pr.Total
+        pageStart := len(list.Tracks)
+        for _, item := range pr.Items {
+            if read >= maxItems {
+                list.Truncated = true
+                break
+            }
+            read++
+            // Локальные файлы и удаленные треки приходят без объекта track.
+            if item.Track == nil || item.Track.ID == "" {
+                continue
+            }
+            list.Tracks = append(list.Tracks, item.Track.toTrack())
+        }
+        next = pr.Next
+        if next != "" && read >= maxItems {
+            list.Truncated = true
+        }
+        if list.Truncated {
+            next = ""
+        }
+        savePage(ctx, PlatformSpotify, playlistID, &Page{
+            Tracks:    list.Tracks[pageStart:],
+            Total:     list.Total,
+            Truncated: list.Truncated,
+            Next:      next,
+            Read:      read,
+            Done:      next == "",
+        })
+    }
+    return list, nil
+}
+
+// getSpotifyPlaylistPage запрашивает одну страницу треков плейлиста Spotify.
+func getSpotifyPlaylistPage(ctx context.Context, token, pageURL string) (*spotifyPlaylistResponse, error) {
+    req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
     if err != nil {
         return nil, err
     }
@@ -40,18 +127,21 @@ func GetSpotifyPlaylist(ctx context.Context, redisClient *redis.Client, playlist
         return nil, err
     }
     defer resp.Body.Close()
-    var pr PlaylistResponse
+    if resp.StatusCode >= 300 {
+        return nil, newStatusError(resp, "ошибка получения плейлиста Spotify")
+    }
+    var pr spotifyPlaylistResponse
     if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
         return nil, err
     }
-    return pr.Items, nil
+    return &pr, nil
 }
 
 // AddTracksToSpotifyPlaylist добавляет треки в плейлист Spotify.
-func AddTracksToSpotifyPlaylist(ctx context.Context, redisClient *redis.Client, playlistID string, tracks []Track) error {
-    token, err := redisClient.Get(ctx, "spotify_token").Result()
+func AddTracksToSpotifyPlaylist(ctx context.Context, redisClient *redis.Client, chatID int64, playlistID string, tracks []Track) error {
+    token, err := spotifyToken(ctx, redisClient, chatID)
     if err != nil {
-        return fmt.Errorf("не удалось получить токен Spotify: %v", err)
+        return err
     }
     trackURIs := []string{}
     for _, t := range tracks {
@@ -61,7 +151,68 @@ func AddTracksToSpotifyPlaylist(ctx context.Context, redisClient *redis.Client,
         "uris": trackURIs,
     }
     bodyJSON, _ := json.Marshal(bodyData)
-    req, err := http.NewRequest("POST", fmt.Sprintf("https://api.spotify.com/v1/playlists/%s/tracks", playlistID), bytes.NewReader(bodyJSON))
+    req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("https://api.spotify.com/v1/playlists/%s/tracks", playlistID), bytes.NewReader(bodyJSON))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Authorization", "Bearer "+token)
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        return newStatusError(resp, "ошибка добавления треков на Spotify")
+    }
+    return nil
+}
+
+// MoveSpotifyPlaylistTrack перемещает трек с позиции from на позицию to через эндпоинт изменения порядка.
+// Spotify принимает insert_before — позицию до удаления трека, поэтому при перемещении вниз она на 1 больше to.
+func MoveSpotifyPlaylistTrack(ctx context.Context, redisClient *redis.Client, chatID int64, playlistID string, from, to int) error {
+    token, err := spotifyToken(ctx, redisClient, chatID)
+    if err != nil {
+        return err
+    }
+    insertBefore := to
+    if to > from {
+        insertBefore = to + 1
+    }
+    bodyJSON, _ := json.Marshal(map[string]int{
+        "range_start":   from,
+        "insert_before": insertBefore,
+        "range_length":  1,
+    })
+    req, err := http.NewRequestWithContext(ctx, "PUT", fmt.Sprintf("https://api.spotify.com/v1/playlists/%s/tracks", playlistID), bytes.NewReader(bodyJSON))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Authorization", "Bearer "+token)
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        return newStatusError(resp, "ошибка изменения порядка треков на Spotify")
+    }
+    return nil
+}
+
+// RemoveTracksFromSpotifyPlaylist удаляет треки из плейлиста Spotify.
+func RemoveTracksFromSpotifyPlaylist(ctx context.Context, redisClient *redis.Client, chatID int64, playlistID string, tracks []Track) error {
+    token, err := spotifyToken(ctx, redisClient, chatID)
+    if err != nil {
+        return err
+    }
+    uris := []map[string]string{}
+    for _, t := range tracks {
+        uris = append(uris, map[string]string{"uri": "spotify:track:" + t.ID})
+    }
+    bodyJSON, _ := json.Marshal(map[string]interface{}{"tracks": uris})
+    req, err := http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf("https://api.spotify.com/v1/playlists/%s/tracks", playlistID), bytes.NewReader(bodyJSON))
     if err != nil {
         return err
     }
@@ -73,7 +224,196 @@ func AddTracksToSpotifyPlaylist(ctx context.Context, redisClient *redis.Client,
     }
     defer resp.Body.Close()
     if resp.StatusCode >= 300 {
-        return errors.New("ошибка добавления треков на Spotify")
+        return newStatusError(resp, "ошибка удаления треков на Spotify")
     }
     return nil
-}
\ No newline at end of file
+}
+
+// SearchSpotifyTracks ищет треки в каталоге Spotify.
+func SearchSpotifyTracks(ctx context.Context, redisClient *redis.Client, chatID int64, query string, limit int) ([]Track, error) {
+    token, err := spotifyToken(ctx, redisClient, chatID)
+    if err != nil {
+        return nil, err
+    }
+    q := url.Values{}
+    q.Set("q", query)
+    q.Set("type", "track")
+    q.Set("limit", fmt.Sprintf("%d", limit))
+    req, err := http.NewRequestWithContext(ctx, "GET", "https://api.spotify.com/v1/search?"+q.Encode(), nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Authorization", "Bearer "+token)
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        return nil, newStatusError(resp, "ошибка поиска на Spotify")
+    }
+    var sr struct {
+        Tracks struct {
+            Items []spotifyTrackObject `json:"items"`
+        } `json:"tracks"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&sr); err != nil {
+        return nil, err
+    }
+    tracks := []Track{}
+    for _, item := range sr.Tracks.Items {
+        tracks = append(tracks, item.toTrack())
+    }
+    return tracks, nil
+}
+
+// GetSpotifyTrack получает трек каталога Spotify по ID.
+func GetSpotifyTrack(ctx context.Context, redisClient *redis.Client, chatID int64, trackID string) (*Track, error) {
+    token, err := spotifyToken(ctx, redisClient, chatID)
+    if err != nil {
+        return nil, err
+    }
+    req, err := http.NewRequestWithContext(ctx, "GET", "https://api.spotify.com/v1/tracks/"+url.PathEscape(trackID), nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Authorization", "Bearer "+token)
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
+        return nil, ErrTrackNotFound
+    }
+    if resp.StatusCode >= 300 {
+        return nil, newStatusError(resp, "ошибка получения трека Spotify")
+    }
+    var item spotifyTrackObject
+    if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+        return nil, err
+    }
+    track := item.toTrack()
+    return &track, nil
+}
+
+// GetSpotifyPlaylistInfo получает метаданные плейлиста Spotify.
+func GetSpotifyPlaylistInfo(ctx context.Context, redisClient *redis.Client, chatID int64, playlistID string) (*PlaylistInfo, error) {
+    token, err := spotifyToken(ctx, redisClient, chatID)
+    if err != nil {
+        return nil, err
+    }
+    req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://api.spotify.com/v1/playlists/%s?fields=id,name,owner(display_name),tracks(total)", playlistID), nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Authorization", "Bearer "+token)
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        return nil, newStatusError(resp, "ошибка получения плейлиста Spotify")
+    }
+    var pr struct {
+        ID    string `json:"id"`
+        Name  string `json:"name"`
+        Owner struct {
+            DisplayName string `json:"display_name"`
+        } `json:"owner"`
+        Tracks struct {
+            Total int `json:"total"`
+        } `json:"tracks"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
+        return nil, err
+    }
+    return &PlaylistInfo{
+        ID:         pr.ID,
+        Title:      pr.Name,
+        Owner:      pr.Owner.DisplayName,
+        TrackCount: pr.Tracks.Total,
+    }, nil
+}
+
+// ResolveSpotifyPlaylistURL извлекает ID плейлиста из ссылки вида
+// https://open.spotify.com/playlist/<id>?si=... или spotify:playlist:<id>.
+func ResolveSpotifyPlaylistURL(rawURL string) (string, error) {
+    rawURL = strings.TrimSpace(rawURL)
+    if strings.HasPrefix(rawURL, "spotify:playlist:") {
+        return strings.TrimPrefix(rawURL, "spotify:playlist:"), nil
+    }
+    if !strings.Contains(rawURL, "/") {
+        if rawURL == "" {
+            return "", errors.New("пустой URL плейлиста Spotify")
+        }
+        return rawURL, nil
+    }
+    u, err := url.Parse(rawURL)
+    if err != nil {
+        return "", err
+    }
+    parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+    for i := 0; i < len(parts)-1; i++ {
+        if parts[i] == "playlist" && parts[i+1] != "" {
+            return parts[i+1], nil
+        }
+    }
+    return "", fmt.Errorf("не удалось извлечь ID плейлиста Spotify из %s", rawURL)
+}
+
+// SpotifyProvider реализует Provider для Spotify.
+type SpotifyProvider struct {
+    redis  *redis.Client
+    chatID int64 // Пользователь, от имени которого выполняются запросы
+    paging PageOptions
+}
+
+// NewSpotifyProvider создает провайдера Spotify, выполняющего запросы с токеном пользователя chatID.
+func NewSpotifyProvider(redisClient *redis.Client, chatID int64, paging PageOptions) *SpotifyProvider {
+    return &SpotifyProvider{redis: redisClient, chatID: chatID, paging: paging}
+}
+
+// Name возвращает имя платформы.
+func (p *SpotifyProvider) Name() string { return PlatformSpotify }
+
+// GetPlaylist возвращает треки плейлиста Spotify.
+func (p *SpotifyProvider) GetPlaylist(ctx context.Context, playlistID string) (*TrackList, error) {
+    return GetSpotifyPlaylist(ctx, p.redis, p.chatID, playlistID, p.paging)
+}
+
+// GetPlaylistInfo возвращает метаданные плейлиста Spotify.
+func (p *SpotifyProvider) GetPlaylistInfo(ctx context.Context, playlistID string) (*PlaylistInfo, error) {
+    return GetSpotifyPlaylistInfo(ctx, p.redis, p.chatID, playlistID)
+}
+
+// AddTracks добавляет треки в плейлист Spotify.
+func (p *SpotifyProvider) AddTracks(ctx context.Context, playlistID string, tracks []Track) error {
+    return AddTracksToSpotifyPlaylist(ctx, p.redis, p.chatID, playlistID, tracks)
+}
+
+// MoveTrack перемещает трек внутри плейлиста Spotify.
+func (p *SpotifyProvider) MoveTrack(ctx context.Context, playlistID string, track Track, from, to int) error {
+    return MoveSpotifyPlaylistTrack(ctx, p.redis, p.chatID, playlistID, from, to)
+}
+
+// RemoveTracks удаляет треки из плейлиста Spotify.
+func (p *SpotifyProvider) RemoveTracks(ctx context.Context, playlistID string, tracks []Track) error {
+    return RemoveTracksFromSpotifyPlaylist(ctx, p.redis, p.chatID, playlistID, tracks)
+}
+
+// GetTrack возвращает трек каталога Spotify.
+func (p *SpotifyProvider) GetTrack(ctx context.Context, trackID string) (*Track, error) {
+    return GetSpotifyTrack(ctx, p.redis, p.chatID, trackID)
+}
+
+// Search ищет треки в каталоге Spotify.
+func (p *SpotifyProvider) Search(ctx context.Context, query string, limit int) ([]Track, error) {
+    return SearchSpotifyTracks(ctx, p.redis, p.chatID, query, limit)
+}
+
+// ResolveURL извлекает ID плейлиста Spotify из URL.
+func (p *SpotifyProvider) ResolveURL(url string) (string, error) {
+    return ResolveSpotifyPlaylistURL(url)
+}
@@ -0,0 +1,20 @@
+// pkg/api/token.go
+package api
+
+import (
+    "context"
+
+    "github.com/go-redis/redis/v8"
+
+    "github.com/Clean1ines/scps/pkg/oauth"
+)
+
+// spotifyToken возвращает действующий access_token Spotify пользователя chatID.
+func spotifyToken(ctx context.Context, redisClient *redis.Client, chatID int64) (string, error) {
+    return oauth.AccessToken(ctx, redisClient, PlatformSpotify, chatID)
+}
+
+// youtubeToken возвращает действующий access_token YouTube пользователя chatID.
+func youtubeToken(ctx context.Context, redisClient *redis.Client, chatID int64) (string, error) {
+    return oauth.AccessToken(ctx, redisClient, PlatformYouTube, chatID)
+}
\ No newline at end of file
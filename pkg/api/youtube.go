@@ -2,44 +2,187 @@
 package api
 
 import (
+    "bytes"
     "context"
     "encoding/json"
+    "errors"
     "fmt"
     "net/http"
-    "errors"
+    "net/url"
+    "strings"
 
-    "github.com/Clean1ines/scps/pkg/logging"
     "github.com/go-redis/redis/v8"
 )
 
-// Track представляет видео-трек в плейлисте YouTube.
-type Track struct {
-    VideoID string `json:"videoId"`
-    Title   string `json:"title"`
-    Channel string `json:"channelTitle"`
-}
-
-// PlaylistResponse представляет ответ YouTube API для плейлиста.
-type PlaylistResponse struct {
+// youtubePlaylistResponse представляет страницу ответа YouTube API для элементов плейлиста.
+type youtubePlaylistResponse struct {
     Items []struct {
+        ID      string `json:"id"`
         Snippet struct {
             ResourceId struct {
                 VideoId string `json:"videoId"`
             } `json:"resourceId"`
-            Title        string `json:"title"`
-            ChannelTitle string `json:"channelTitle"`
+            Title                  string `json:"title"`
+            ChannelTitle           string `json:"channelTitle"`
+            VideoOwnerChannelTitle string `json:"videoOwnerChannelTitle"`
         } `json:"snippet"`
     } `json:"items"`
+    NextPageToken string `json:"nextPageToken"`
+    PageInfo      struct {
+        TotalResults int `json:"totalResults"`
+    } `json:"pageInfo"`
 }
 
-// GetYouTubePlaylist получает треки из плейлиста YouTube по ID.
-func GetYouTubePlaylist(ctx context.Context, redisClient *redis.Client, playlistID, apiKey string) ([]Track, error) {
-    token, err := redisClient.Get(ctx, "youtube_token").Result()
+// GetYouTubePlaylist получает все треки плейлиста YouTube по ID, следуя nextPageToken
+// до конца плейлиста или до лимита opts.MaxItems. Состояние чтения сохраняется после каждой
+// страницы, если в контексте задан PageCheckpointer.
+func GetYouTubePlaylist(ctx context.Context, redisClient *redis.Client, chatID int64, playlistID, apiKey string, opts PageOptions) (*TrackList, error) {
+    cursor := loadCursor(ctx, PlatformYouTube, playlistID)
+    if cursor != nil && cursor.Done {
+        return cursor.List, nil
+    }
+    token, err := youtubeToken(ctx, redisClient, chatID)
+    if err != nil {
+        return nil, err
+    }
+    maxItems := opts.maxItems()
+    list := &TrackList{Tracks: []Track{}}
+    pageToken := ""
+    if cursor != nil {
+        // Продолжаем чтение, прерванное предыдущим запуском синхронизации.
+        list, pageToken = cursor.List, cursor.Next
+    }
+    for {
+        q := url.Values{}
+        q.Set("part", "snippet")
+        q.Set("playlistId", playlistID)
+        q.Set("maxResults", fmt.Sprintf("%d", opts.pageSize(youtubeMaxPageSize)))
+        q.Set("key", apiKey)
+        if pageToken != "" {
+            q.Set("pageToken", pageToken)
+        }
+        pr, err := getYouTubePlaylistPage(ctx, token, "https://www.googleapis.com/youtube/v3/playlistItems?"+q.Encode())
+        if err != nil {
+            return nil, err
+        }
+        list.Total = pr.PageInfo.TotalResults
+        pageStart := len(list.Tracks)
+        for _, item := range pr.Items {
+            if len(list.Tracks) >= maxItems {
+                list.Truncated = true
+                break
+            }
+            // channelTitle — владелец плейлиста, исполнителя содержит videoOwnerChannelTitle.
+            channel := item.Snippet.VideoOwnerChannelTitle
+            if channel == "" {
+                channel = item.Snippet.ChannelTitle
+            }
+            list.Tracks = append(list.Tracks, Track{
+                ID:     item.Snippet.ResourceId.VideoId,
+                ItemID: item.ID,
+                Name:   item.Snippet.Title,
+                Artist: channel,
+            })
+        }
+        if err := fillYouTubeDurations(ctx, token, apiKey, list.Tracks[pageStart:]); err != nil {
+            return nil, err
+        }
+        pageToken = pr.NextPageToken
+        if pageToken != "" && len(list.Tracks) >= maxItems {
+            list.Truncated = true
+        }
+        if list.Truncated {
+            pageToken = ""
+        }
+        savePage(ctx, PlatformYouTube, playlistID, &Page{
+            Tracks:    list.Tracks[pageStart:],
+            Total:     list.Total,
+            Truncated: list.Truncated,
+            Next:      pageToken,
+            Done:      pageToken == "",
+        })
+        if pageToken == "" {
+            break
+        }
+    }
+    return list, nil
+}
+
+// fillYouTubeDurations запрашивает длительности видео через videos.list (до 50 ID за запрос)
+// и заполняет DurationMs треков.
+func fillYouTubeDurations(ctx context.Context, token, apiKey string, tracks []Track) error {
+    ids := []string{}
+    for _, t := range tracks {
+        ids = append(ids, t.ID)
+    }
+    if len(ids) == 0 {
+        return nil
+    }
+    q := url.Values{}
+    q.Set("part", "contentDetails")
+    q.Set("id", strings.Join(ids, ","))
+    q.Set("key", apiKey)
+    req, err := http.NewRequestWithContext(ctx, "GET", "https://www.googleapis.com/youtube/v3/videos?"+q.Encode(), nil)
     if err != nil {
-        return nil, fmt.Errorf("не удалось получить токен YouTube: %v", err)
+        return err
     }
-    url := fmt.Sprintf("https://www.googleapis.com/youtube/v3/playlistItems?part=snippet&playlistId=%s&key=%s", playlistID, apiKey)
-    req, err := http.NewRequest("GET", url, nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        return newStatusError(resp, "ошибка получения длительности видео YouTube")
+    }
+    var vr struct {
+        Items []struct {
+            ID             string `json:"id"`
+            ContentDetails struct {
+                Duration string `json:"duration"`
+            } `json:"contentDetails"`
+        } `json:"items"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&vr); err != nil {
+        return err
+    }
+    durations := map[string]int{}
+    for _, item := range vr.Items {
+        durations[item.ID] = parseISODuration(item.ContentDetails.Duration)
+    }
+    for i := range tracks {
+        tracks[i].DurationMs = durations[tracks[i].ID]
+    }
+    return nil
+}
+
+// parseISODuration преобразует длительность ISO 8601 ("PT1H2M3S") в миллисекунды.
+// Возвращает 0 для некорректных значений.
+func parseISODuration(s string) int {
+    if !strings.HasPrefix(s, "PT") {
+        return 0
+    }
+    total, n := 0, 0
+    for _, r := range s[2:] {
+        switch {
+        case r >= '0' && r <= '9':
+            n = n*10 + int(r-'0')
+        case r == 'H':
+            total, n = total+n*3600, 0
+        case r == 'M':
+            total, n = total+n*60, 0
+        case r == 'S':
+            total, n = total+n, 0
+        default:
+            return 0
+        }
+    }
+    return total * 1000
+}
+
+// getYouTubePlaylistPage запрашивает одну страницу элементов плейлиста YouTube.
+func getYouTubePlaylistPage(ctx context.Context, token, pageURL string) (*youtubePlaylistResponse, error) {
+    req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
     if err != nil {
         return nil, err
     }
@@ -49,52 +192,355 @@ func GetYouTubePlaylist(ctx context.Context, redisClient *redis.Client, playlist
         return nil, err
     }
     defer resp.Body.Close()
-    var pr PlaylistResponse
+    if resp.StatusCode >= 300 {
+        return nil, newStatusError(resp, "ошибка получения плейлиста YouTube")
+    }
+    var pr youtubePlaylistResponse
     if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
         return nil, err
     }
+    return &pr, nil
+}
+
+// AddTracksToYouTubePlaylist добавляет треки в плейлист YouTube по одному. Если добавить
+// удалось только часть треков, возвращается PartialError с числом добавленных.
+func AddTracksToYouTubePlaylist(ctx context.Context, redisClient *redis.Client, chatID int64, playlistID, apiKey string, tracks []Track) error {
+    token, err := youtubeToken(ctx, redisClient, chatID)
+    if err != nil {
+        return err
+    }
+    for i, track := range tracks {
+        if err := addYouTubePlaylistItem(ctx, token, playlistID, apiKey, track); err != nil {
+            return partialError(i, err)
+        }
+    }
+    return nil
+}
+
+// addYouTubePlaylistItem добавляет одно видео в плейлист через playlistItems.insert.
+func addYouTubePlaylistItem(ctx context.Context, token, playlistID, apiKey string, track Track) error {
+    bodyData := map[string]interface{}{
+        "snippet": map[string]interface{}{
+            "playlistId": playlistID,
+            "resourceId": map[string]string{
+                "kind":    "youtube#video",
+                "videoId": track.ID,
+            },
+        },
+    }
+    bodyJSON, _ := json.Marshal(bodyData)
+    req, err := http.NewRequestWithContext(ctx, "POST", "https://www.googleapis.com/youtube/v3/playlistItems?part=snippet&key="+apiKey, bytes.NewReader(bodyJSON))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Authorization", "Bearer "+token)
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        return newStatusError(resp, "ошибка добавления видео на YouTube")
+    }
+    return nil
+}
+
+// MoveYouTubePlaylistItem устанавливает позицию элемента плейлиста YouTube через playlistItems.update.
+// Как и для удаления, требуется ItemID.
+func MoveYouTubePlaylistItem(ctx context.Context, redisClient *redis.Client, chatID int64, playlistID, apiKey string, track Track, position int) error {
+    token, err := youtubeToken(ctx, redisClient, chatID)
+    if err != nil {
+        return err
+    }
+    if track.ItemID == "" {
+        return fmt.Errorf("не указан ID элемента плейлиста для видео %s", track.ID)
+    }
+    bodyData := map[string]interface{}{
+        "id": track.ItemID,
+        "snippet": map[string]interface{}{
+            "playlistId": playlistID,
+            "resourceId": map[string]string{
+                "kind":    "youtube#video",
+                "videoId": track.ID,
+            },
+            "position": position,
+        },
+    }
+    bodyJSON, _ := json.Marshal(bodyData)
+    req, err := http.NewRequestWithContext(ctx, "PUT", "https://www.googleapis.com/youtube/v3/playlistItems?part=snippet&key="+apiKey, bytes.NewReader(bodyJSON))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Authorization", "Bearer "+token)
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        return newStatusError(resp, "ошибка изменения позиции видео на YouTube")
+    }
+    return nil
+}
+
+// RemoveTracksFromYouTubePlaylist удаляет элементы из плейлиста YouTube по одному.
+// Для удаления требуется ItemID (ID элемента плейлиста), а не videoId. Если удалить
+// удалось только часть элементов, возвращается PartialError с числом удаленных.
+func RemoveTracksFromYouTubePlaylist(ctx context.Context, redisClient *redis.Client, chatID int64, apiKey string, tracks []Track) error {
+    token, err := youtubeToken(ctx, redisClient, chatID)
+    if err != nil {
+        return err
+    }
+    for i, track := range tracks {
+        if err := removeYouTubePlaylistItem(ctx, token, apiKey, track); err != nil {
+            return partialError(i, err)
+        }
+    }
+    return nil
+}
+
+// removeYouTubePlaylistItem удаляет один элемент плейлиста через playlistItems.delete.
+func removeYouTubePlaylistItem(ctx context.Context, token, apiKey string, track Track) error {
+    if track.ItemID == "" {
+        return fmt.Errorf("не указан ID элемента плейлиста для видео %s", track.ID)
+    }
+    req, err := http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf("https://www.googleapis.com/youtube/v3/playlistItems?id=%s&key=%s", track.ItemID, apiKey), nil)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Authorization", "Bearer "+token)
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        return newStatusError(resp, "ошибка удаления видео на YouTube")
+    }
+    return nil
+}
+
+// SearchYouTubeVideos ищет видео на YouTube через search.list.
+func SearchYouTubeVideos(ctx context.Context, redisClient *redis.Client, chatID int64, apiKey, query string, limit int) ([]Track, error) {
+    token, err := youtubeToken(ctx, redisClient, chatID)
+    if err != nil {
+        return nil, err
+    }
+    q := url.Values{}
+    q.Set("part", "snippet")
+    q.Set("type", "video")
+    q.Set("videoCategoryId", "10") // Музыка
+    q.Set("q", query)
+    q.Set("maxResults", fmt.Sprintf("%d", limit))
+    q.Set("key", apiKey)
+    req, err := http.NewRequestWithContext(ctx, "GET", "https://www.googleapis.com/youtube/v3/search?"+q.Encode(), nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Authorization", "Bearer "+token)
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        return nil, newStatusError(resp, "ошибка поиска на YouTube")
+    }
+    var sr struct {
+        Items []struct {
+            ID struct {
+                VideoID string `json:"videoId"`
+            } `json:"id"`
+            Snippet struct {
+                Title        string `json:"title"`
+                ChannelTitle string `json:"channelTitle"`
+            } `json:"snippet"`
+        } `json:"items"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&sr); err != nil {
+        return nil, err
+    }
     tracks := []Track{}
-    for _, item := range pr.Items {
+    for _, item := range sr.Items {
         tracks = append(tracks, Track{
-            VideoID: item.Snippet.ResourceId.VideoId,
-            Title:   item.Snippet.Title,
-            Channel: item.Snippet.ChannelTitle,
+            ID:     item.ID.VideoID,
+            Name:   item.Snippet.Title,
+            Artist: item.Snippet.ChannelTitle,
         })
     }
     return tracks, nil
 }
 
-// AddTracksToYouTubePlaylist добавляет треки в плейлист YouTube.
-func AddTracksToYouTubePlaylist(ctx context.Context, redisClient *redis.Client, playlistID, apiKey string, tracks []Track) error {
-    token, err := redisClient.Get(ctx, "youtube_token").Result()
+// GetYouTubeVideo получает видео YouTube по ID через videos.list.
+func GetYouTubeVideo(ctx context.Context, redisClient *redis.Client, chatID int64, apiKey, videoID string) (*Track, error) {
+    token, err := youtubeToken(ctx, redisClient, chatID)
     if err != nil {
-        return fmt.Errorf("не удалось получить токен YouTube: %v", err)
+        return nil, err
     }
-    for _, track := range tracks {
-        bodyData := map[string]interface{}{
-            "snippet": map[string]interface{}{
-                "playlistId": playlistID,
-                "resourceId": map[string]string{
-                    "kind":    "youtube#video",
-                    "videoId": track.VideoID,
-                },
-            },
-        }
-        bodyJSON, _ := json.Marshal(bodyData)
-        req, err := http.NewRequest("POST", "https://www.googleapis.com/youtube/v3/playlistItems?part=snippet&key="+apiKey, bytes.NewReader(bodyJSON))
-        if err != nil {
-            return err
-        }
-        req.Header.Set("Authorization", "Bearer "+token)
-        req.Header.Set("Content-Type", "application/json")
-        resp, err := http.DefaultClient.Do(req)
-        if err != nil {
-            return err
-        }
-        defer resp.Body.Close()
-        if resp.StatusCode >= 300 {
-            return errors.New(fmt.Sprintf("ошибка добавления видео на YouTube, статус: %d", resp.StatusCode))
+    q := url.Values{}
+    q.Set("part", "snippet,contentDetails")
+    q.Set("id", videoID)
+    q.Set("key", apiKey)
+    req, err := http.NewRequestWithContext(ctx, "GET", "https://www.googleapis.com/youtube/v3/videos?"+q.Encode(), nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Authorization", "Bearer "+token)
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        return nil, newStatusError(resp, "ошибка получения видео YouTube")
+    }
+    var vr struct {
+        Items []struct {
+            ID      string `json:"id"`
+            Snippet struct {
+                Title        string `json:"title"`
+                ChannelTitle string `json:"channelTitle"`
+            } `json:"snippet"`
+            ContentDetails struct {
+                Duration string `json:"duration"`
+            } `json:"contentDetails"`
+        } `json:"items"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&vr); err != nil {
+        return nil, err
+    }
+    if len(vr.Items) == 0 {
+        return nil, ErrTrackNotFound
+    }
+    item := vr.Items[0]
+    return &Track{
+        ID:         item.ID,
+        Name:       item.Snippet.Title,
+        Artist:     item.Snippet.ChannelTitle,
+        DurationMs: parseISODuration(item.ContentDetails.Duration),
+    }, nil
+}
+
+// GetYouTubePlaylistInfo получает метаданные плейлиста YouTube.
+func GetYouTubePlaylistInfo(ctx context.Context, redisClient *redis.Client, chatID int64, playlistID, apiKey string) (*PlaylistInfo, error) {
+    token, err := youtubeToken(ctx, redisClient, chatID)
+    if err != nil {
+        return nil, err
+    }
+    req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://www.googleapis.com/youtube/v3/playlists?part=snippet,contentDetails&id=%s&key=%s", playlistID, apiKey), nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Authorization", "Bearer "+token)
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        return nil, newStatusError(resp, "ошибка получения плейлиста YouTube")
+    }
+    var pr struct {
+        Items []struct {
+            ID      string `json:"id"`
+            Snippet struct {
+                Title        string `json:"title"`
+                ChannelTitle string `json:"channelTitle"`
+            } `json:"snippet"`
+            ContentDetails struct {
+                ItemCount int `json:"itemCount"`
+            } `json:"contentDetails"`
+        } `json:"items"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
+        return nil, err
+    }
+    if len(pr.Items) == 0 {
+        return nil, fmt.Errorf("плейлист YouTube %s не найден", playlistID)
+    }
+    item := pr.Items[0]
+    return &PlaylistInfo{
+        ID:         item.ID,
+        Title:      item.Snippet.Title,
+        Owner:      item.Snippet.ChannelTitle,
+        TrackCount: item.ContentDetails.ItemCount,
+    }, nil
+}
+
+// ResolveYouTubePlaylistURL извлекает ID плейлиста из ссылки вида
+// https://www.youtube.com/playlist?list=<id> или https://music.youtube.com/watch?v=...&list=<id>.
+func ResolveYouTubePlaylistURL(rawURL string) (string, error) {
+    rawURL = strings.TrimSpace(rawURL)
+    if !strings.Contains(rawURL, "/") {
+        if rawURL == "" {
+            return "", errors.New("пустой URL плейлиста YouTube")
         }
+        return rawURL, nil
     }
-    return nil
-}
\ No newline at end of file
+    u, err := url.Parse(rawURL)
+    if err != nil {
+        return "", err
+    }
+    if list := u.Query().Get("list"); list != "" {
+        return list, nil
+    }
+    return "", fmt.Errorf("не удалось извлечь ID плейлиста YouTube из %s", rawURL)
+}
+
+// YouTubeProvider реализует Provider для YouTube.
+type YouTubeProvider struct {
+    redis  *redis.Client
+    chatID int64 // Пользователь, от имени которого выполняются запросы
+    apiKey string
+    paging PageOptions
+}
+
+// NewYouTubeProvider создает провайдера YouTube, выполняющего запросы с токеном пользователя chatID.
+func NewYouTubeProvider(redisClient *redis.Client, chatID int64, apiKey string, paging PageOptions) *YouTubeProvider {
+    return &YouTubeProvider{redis: redisClient, chatID: chatID, apiKey: apiKey, paging: paging}
+}
+
+// Name возвращает имя платформы.
+func (p *YouTubeProvider) Name() string { return PlatformYouTube }
+
+// GetPlaylist возвращает треки плейлиста YouTube.
+func (p *YouTubeProvider) GetPlaylist(ctx context.Context, playlistID string) (*TrackList, error) {
+    return GetYouTubePlaylist(ctx, p.redis, p.chatID, playlistID, p.apiKey, p.paging)
+}
+
+// GetPlaylistInfo возвращает метаданные плейлиста YouTube.
+func (p *YouTubeProvider) GetPlaylistInfo(ctx context.Context, playlistID string) (*PlaylistInfo, error) {
+    return GetYouTubePlaylistInfo(ctx, p.redis, p.chatID, playlistID, p.apiKey)
+}
+
+// AddTracks добавляет видео в плейлист YouTube.
+func (p *YouTubeProvider) AddTracks(ctx context.Context, playlistID string, tracks []Track) error {
+    return AddTracksToYouTubePlaylist(ctx, p.redis, p.chatID, playlistID, p.apiKey, tracks)
+}
+
+// RemoveTracks удаляет элементы из плейлиста YouTube.
+func (p *YouTubeProvider) RemoveTracks(ctx context.Context, playlistID string, tracks []Track) error {
+    return RemoveTracksFromYouTubePlaylist(ctx, p.redis, p.chatID, p.apiKey, tracks)
+}
+
+// MoveTrack перемещает элемент плейлиста YouTube на позицию to.
+func (p *YouTubeProvider) MoveTrack(ctx context.Context, playlistID string, track Track, from, to int) error {
+    return MoveYouTubePlaylistItem(ctx, p.redis, p.chatID, playlistID, p.apiKey, track, to)
+}
+
+// GetTrack возвращает видео YouTube.
+func (p *YouTubeProvider) GetTrack(ctx context.Context, trackID string) (*Track, error) {
+    return GetYouTubeVideo(ctx, p.redis, p.chatID, p.apiKey, trackID)
+}
+
+// Search ищет видео на YouTube.
+func (p *YouTubeProvider) Search(ctx context.Context, query string, limit int) ([]Track, error) {
+    return SearchYouTubeVideos(ctx, p.redis, p.chatID, p.apiKey, query, limit)
+}
+
+// ResolveURL извлекает ID плейлиста YouTube из URL.
+func (p *YouTubeProvider) ResolveURL(url string) (string, error) {
+    return ResolveYouTubePlaylistURL(url)
+}
@@ -0,0 +1,141 @@
+// pkg/auth/auth.go
+package auth
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/base64"
+    "errors"
+    "net/http"
+    "strconv"
+    "strings"
+    gosync "sync"
+    "time"
+)
+
+// TokenTTL — срок действия токена HTTP API, выданного пользователю (см. IssueToken).
+const TokenTTL = 30 * 24 * time.Hour
+
+var (
+    // ErrUnauthorized возвращается, если запрос не содержит действительного токена.
+    ErrUnauthorized = errors.New("требуется авторизация")
+    // ErrNotConfigured возвращается при выдаче токена, если ключ подписи не задан.
+    ErrNotConfigured = errors.New("ключ подписи токенов API не задан")
+)
+
+var (
+    configMu   gosync.RWMutex
+    adminToken string
+    secret     []byte
+)
+
+// Identity — автор запроса к HTTP API: пользователь (чат Telegram) или администратор.
+type Identity struct {
+    ChatID int64 // Чат пользователя; 0 для администратора
+    Admin  bool  // Администратор имеет доступ к данным всех пользователей
+}
+
+// CanAccess сообщает, может ли автор запроса работать с данными чата chatID.
+func (id *Identity) CanAccess(chatID int64) bool {
+    return id != nil && (id.Admin || (id.ChatID != 0 && id.ChatID == chatID))
+}
+
+// identityKey — ключ контекста с автором запроса.
+type identityKey struct{}
+
+// Configure задает токен администратора (ADMIN_API_TOKEN) и ключ подписи токенов
+// пользователей (API_TOKEN_SECRET). Если не задано ни то, ни другое, HTTP API отклоняет
+// все запросы. Ключ должен совпадать на всех экземплярах сервиса.
+func Configure(admin, tokenSecret string) {
+    configMu.Lock()
+    defer configMu.Unlock()
+    adminToken = admin
+    secret = nil
+    if tokenSecret != "" {
+        secret = []byte(tokenSecret)
+    }
+}
+
+// IssueToken выдает пользователю chatID токен HTTP API: <chatID>.<срок действия>.<подпись HMAC-SHA256>.
+// Токен выдается по команде бота, поэтому принадлежность чата подтверждена Telegram.
+func IssueToken(chatID int64, now time.Time) (string, error) {
+    configMu.RLock()
+    key := secret
+    configMu.RUnlock()
+    if key == nil {
+        return "", ErrNotConfigured
+    }
+    if chatID == 0 {
+        return "", errors.New("некорректный ID пользователя")
+    }
+    payload := strconv.FormatInt(chatID, 10) + "." + strconv.FormatInt(now.Add(TokenTTL).Unix(), 10)
+    return payload + "." + signature(key, payload), nil
+}
+
+// Authenticate определяет автора запроса по заголовку Authorization: Bearer <токен>.
+func Authenticate(r *http.Request, now time.Time) (*Identity, error) {
+    token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+    if token == "" {
+        return nil, ErrUnauthorized
+    }
+    configMu.RLock()
+    admin, key := adminToken, secret
+    configMu.RUnlock()
+    if admin != "" && subtle.ConstantTimeCompare([]byte(token), []byte(admin)) == 1 {
+        return &Identity{Admin: true}, nil
+    }
+    if key == nil {
+        return nil, ErrUnauthorized
+    }
+    parts := strings.Split(token, ".")
+    if len(parts) != 3 {
+        return nil, ErrUnauthorized
+    }
+    payload := parts[0] + "." + parts[1]
+    if !hmac.Equal([]byte(parts[2]), []byte(signature(key, payload))) {
+        return nil, ErrUnauthorized
+    }
+    chatID, err := strconv.ParseInt(parts[0], 10, 64)
+    if err != nil || chatID == 0 {
+        return nil, ErrUnauthorized
+    }
+    expires, err := strconv.ParseInt(parts[1], 10, 64)
+    if err != nil || now.Unix() > expires {
+        return nil, ErrUnauthorized
+    }
+    return &Identity{ChatID: chatID}, nil
+}
+
+// Require пропускает к обработчику h только запросы с действительным токеном; автор запроса
+// доступен обработчику через FromContext.
+func Require(h http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        id, err := Authenticate(r, time.Now())
+        if err != nil {
+            w.Header().Set("WWW-Authenticate", "Bearer")
+            http.Error(w, err.Error(), http.StatusUnauthorized)
+            return
+        }
+        h(w, r.WithContext(WithIdentity(r.Context(), id)))
+    }
+}
+
+// WithIdentity возвращает контекст с автором запроса.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+    return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext возвращает автора запроса или nil, если запрос не прошел через Require.
+func FromContext(ctx context.Context) *Identity {
+    id, _ := ctx.Value(identityKey{}).(*Identity)
+    return id
+}
+
+// signature вычисляет подпись токена.
+func signature(key []byte, payload string) string {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte("api:" + payload))
+    return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
\ No newline at end of file
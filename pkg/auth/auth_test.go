@@ -0,0 +1,64 @@
+// pkg/auth/auth_test.go
+package auth
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestTokenBoundToChat(t *testing.T) {
+    Configure("admin-token", "secret")
+    defer Configure("", "")
+    token, err := IssueToken(-100123, time.Now())
+    if err != nil {
+        t.Fatalf("Ошибка выдачи токена: %v", err)
+    }
+    authenticate := func(token string, now time.Time) (*Identity, error) {
+        req := httptest.NewRequest("GET", "/jobs/1", nil)
+        req.Header.Set("Authorization", "Bearer "+token)
+        return Authenticate(req, now)
+    }
+    id, err := authenticate(token, time.Now())
+    if err != nil || id.ChatID != -100123 || id.Admin {
+        t.Fatalf("Ожидался пользователь -100123, получено %+v (%v)", id, err)
+    }
+    if !id.CanAccess(-100123) || id.CanAccess(7) {
+        t.Errorf("Пользователь должен иметь доступ только к своему чату")
+    }
+    forged := "7" + strings.TrimPrefix(token, "-100123")
+    if _, err := authenticate(forged, time.Now()); err != ErrUnauthorized {
+        t.Errorf("Принят токен с подмененным пользователем")
+    }
+    if _, err := authenticate(token, time.Now().Add(TokenTTL+time.Minute)); err != ErrUnauthorized {
+        t.Errorf("Принят просроченный токен")
+    }
+    if id, err := authenticate("admin-token", time.Now()); err != nil || !id.Admin || !id.CanAccess(7) {
+        t.Errorf("Токен администратора не принят: %+v (%v)", id, err)
+    }
+}
+
+func TestRequireRejectsAnonymous(t *testing.T) {
+    Configure("admin-token", "")
+    defer Configure("", "")
+    called := false
+    h := Require(func(w http.ResponseWriter, r *http.Request) {
+        called = FromContext(r.Context()).Admin
+    })
+    w := httptest.NewRecorder()
+    h(w, httptest.NewRequest("GET", "/dead-letters", nil))
+    if w.Code != http.StatusUnauthorized || called {
+        t.Errorf("Запрос без токена должен быть отклонен, статус %d", w.Code)
+    }
+    req := httptest.NewRequest("GET", "/dead-letters", nil)
+    req.Header.Set("Authorization", "Bearer admin-token")
+    h(httptest.NewRecorder(), req)
+    if !called {
+        t.Errorf("Запрос администратора не передан обработчику")
+    }
+    if _, err := IssueToken(1, time.Now()); err != ErrNotConfigured {
+        t.Errorf("Токен выдан без ключа подписи")
+    }
+}
\ No newline at end of file
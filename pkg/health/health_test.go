@@ -8,12 +8,6 @@ import (
     "testing"
 )
 
-// HealthHandler возвращает ответ "OK" для проверки работоспособности сервера.
-func HealthHandler(w http.ResponseWriter, r *http.Request) {
-    w.WriteHeader(http.StatusOK)
-    w.Write([]byte("OK"))
-}
-
 func TestHealthHandler(t *testing.T) {
     req := httptest.NewRequest("GET", "/health", nil)
     w := httptest.NewRecorder()
@@ -35,13 +35,21 @@ func NewLogger(ctx context.Context) (*Logger, error) {
     }, nil
 }
 
+// NewStdLogger создает Logger, который пишет только в стандартный лог, без Cloud Logging
+// (для локальной разработки и тестов).
+func NewStdLogger() *Logger {
+    return &Logger{context: context.Background()}
+}
+
 // Infof записывает информационное сообщение.
 func (l *Logger) Infof(format string, args ...interface{}) {
     entry := logging.Entry{
         Severity: logging.Info,
         Payload:  fmt.Sprintf(format, args...),
     }
-    l.logger.Log(entry)
+    if l.logger != nil {
+        l.logger.Log(entry)
+    }
     log.Printf("[INFO] "+format, args...)
 }
 
@@ -51,11 +59,15 @@ func (l *Logger) Errorf(format string, args ...interface{}) {
         Severity: logging.Error,
         Payload:  fmt.Sprintf(format, args...),
     }
-    l.logger.Log(entry)
+    if l.logger != nil {
+        l.logger.Log(entry)
+    }
     log.Printf("[ERROR] "+format, args...)
 }
 
 // Close закрывает клиента логирования.
 func (l *Logger) Close() {
-    l.client.Close()
+    if l.client != nil {
+        l.client.Close()
+    }
 }
\ No newline at end of file
@@ -0,0 +1,168 @@
+// pkg/matching/index.go
+package matching
+
+import (
+    "strings"
+)
+
+const (
+    // maxBlockSize — ключи отбора, встречающиеся у большего числа треков ("the", "love"),
+    // не используются, если у трека есть более редкие ключи.
+    maxBlockSize = 256
+    // prefixLen — длина префикса названия, по которому находятся названия с опечатками.
+    prefixLen = 3
+)
+
+// targetIndex индексирует целевой плейлист для сравнения без перебора всех пар:
+// точные ключи (ISRC, "исполнитель + название") и блоки по словам и префиксу названия.
+type targetIndex struct {
+    tracks []TrackMetadata
+    norm   []Normalized
+    isrc   map[string][]int
+    exact  map[string][]int
+    blocks map[string][]int
+    seen   []int // Номер поиска, на котором трек уже рассматривался кандидатом
+    search int   // Номер текущего поиска
+}
+
+// newTargetIndex нормализует треки целевого плейлиста и строит индексы.
+func newTargetIndex(tracks []TrackMetadata) *targetIndex {
+    idx := &targetIndex{
+        tracks: tracks,
+        norm:   make([]Normalized, len(tracks)),
+        seen:   make([]int, len(tracks)),
+        isrc:   map[string][]int{},
+        exact:  map[string][]int{},
+        blocks: map[string][]int{},
+    }
+    for i, t := range tracks {
+        n := NormalizeTrack(t)
+        idx.norm[i] = n
+        if t.ISRC != "" {
+            key := strings.ToUpper(t.ISRC)
+            idx.isrc[key] = append(idx.isrc[key], i)
+        }
+        key := exactKey(n)
+        idx.exact[key] = append(idx.exact[key], i)
+        for _, b := range blockKeys(n) {
+            idx.blocks[b] = append(idx.blocks[b], i)
+        }
+    }
+    return idx
+}
+
+// find ищет в целевом плейлисте трек, совпадающий с src. Сначала проверяются точные ключи,
+// затем кандидаты из блоков; из них выбирается совпадение с наибольшей оценкой.
+func (idx *targetIndex) find(m Matcher, src TrackMetadata) (Pair, bool) {
+    ns := NormalizeTrack(src)
+    if src.ISRC != "" {
+        if pair, ok := idx.firstMatch(m, src, ns, idx.isrc[strings.ToUpper(src.ISRC)]); ok {
+            return pair, true
+        }
+    }
+    if pair, ok := idx.firstMatch(m, src, ns, idx.exact[exactKey(ns)]); ok {
+        return pair, true
+    }
+    best, found := Pair{}, false
+    idx.search++
+    for _, posting := range idx.candidateBlocks(ns) {
+        for _, i := range posting {
+            if idx.seen[i] == idx.search {
+                continue
+            }
+            idx.seen[i] = idx.search
+            if m.quickReject(src, idx.tracks[i], ns, idx.norm[i]) {
+                continue
+            }
+            r := m.compareNormalized(src, idx.tracks[i], ns, idx.norm[i])
+            if r.Matched && (!found || r.Score > best.Result.Score) {
+                best, found = Pair{Source: src, Target: idx.tracks[i], Result: r}, true
+            }
+        }
+    }
+    return best, found
+}
+
+// firstMatch возвращает первое совпадение среди кандидатов с точным ключом.
+func (idx *targetIndex) firstMatch(m Matcher, src TrackMetadata, ns Normalized, candidates []int) (Pair, bool) {
+    for _, i := range candidates {
+        if r := m.compareNormalized(src, idx.tracks[i], ns, idx.norm[i]); r.Matched {
+            return Pair{Source: src, Target: idx.tracks[i], Result: r}, true
+        }
+    }
+    return Pair{}, false
+}
+
+// candidateBlocks возвращает списки кандидатов по ключам трека, пропуская слишком частые ключи.
+// Если все ключи частые, используется самый редкий из них.
+func (idx *targetIndex) candidateBlocks(n Normalized) [][]int {
+    result := [][]int{}
+    var smallest []int
+    for _, b := range blockKeys(n) {
+        posting, ok := idx.blocks[b]
+        if !ok {
+            continue
+        }
+        if len(posting) <= maxBlockSize {
+            result = append(result, posting)
+        } else if smallest == nil || len(posting) < len(smallest) {
+            smallest = posting
+        }
+    }
+    if len(result) == 0 && smallest != nil {
+        result = append(result, smallest)
+    }
+    return result
+}
+
+// quickReject отбрасывает кандидата без вычисления расстояния Левенштейна, если даже при
+// полном совпадении исполнителей разница длин названий не позволяет достичь порога.
+func (m Matcher) quickReject(a, b TrackMetadata, na, nb Normalized) bool {
+    if a.ISRC != "" && strings.EqualFold(a.ISRC, b.ISRC) {
+        return false
+    }
+    if na.base != "" && na.base == nb.base {
+        return false
+    }
+    la, lb := na.length, nb.length
+    if la < lb {
+        la, lb = lb, la
+    }
+    if la == 0 {
+        return false
+    }
+    title := 1 - float64(la-lb)/float64(la)
+    return titleWeight*title*title+artistWeight < m.Threshold
+}
+
+// exactKey формирует ключ точного совпадения из нормализованных исполнителя и названия.
+func exactKey(n Normalized) string {
+    return n.Artist + "\x00" + n.base
+}
+
+// blockKeys возвращает ключи блоков трека: слова названия, а для названий из одного слова
+// еще и его префикс, чтобы находить опечатки ("Yesterday" и "Yesterdy").
+func blockKeys(n Normalized) []string {
+    title := n.base
+    if title == "" {
+        title = n.Name
+    }
+    words := strings.FieldsFunc(title, isSeparator)
+    keys := []string{}
+    for _, w := range words {
+        keys = append(keys, "w:"+w)
+    }
+    if len(words) == 1 {
+        prefix := []rune(words[0])
+        if len(prefix) > prefixLen {
+            prefix = prefix[:prefixLen]
+        }
+        keys = append(keys, "p:"+string(prefix))
+    }
+    return keys
+}
+
+// isSeparator определяет символы, разделяющие слова в названиях.
+func isSeparator(r rune) bool {
+    return strings.ContainsRune(" \t-,()[]", r)
+}
@@ -2,44 +2,161 @@
 package matching
 
 import (
-    "math"
     "strings"
+    "time"
+    "unicode/utf8"
 
     "github.com/agnivade/levenshtein"
 )
 
+const (
+    // DefaultMatchThreshold — минимальная оценка, при которой треки считаются одним и тем же.
+    DefaultMatchThreshold = 0.85
+    // DefaultDurationTolerance — допустимая разница длительностей совпадающих треков.
+    DefaultDurationTolerance = 10 * time.Second
+    // titleWeight и artistWeight задают вклад названия и исполнителя в итоговую оценку.
+    titleWeight  = 0.6
+    artistWeight = 0.4
+    // containmentScore — оценка названия, целиком содержащегося в другом ("Song" и "Song (Remastered 2011)").
+    containmentScore = 0.95
+)
+
 // TrackMetadata представляет метаданные трека для сравнения.
 type TrackMetadata struct {
-    Name   string
-    Artist string
+    ID       string // Идентификатор трека на его платформе; в сравнении не участвует
+    Platform string // Платформа трека ("spotify", "youtube"); определяет шаги нормализации
+    Name     string
+    Artist   string
+    Album    string
+    ISRC     string        // Международный код записи; пустой, если неизвестен
+    Duration time.Duration // Длительность; 0, если неизвестна
+    Explicit bool
+}
+
+// Matcher сравнивает треки с учетом ISRC, длительности и сходства названия и исполнителя.
+type Matcher struct {
+    Threshold         float64       // Минимальная оценка совпадения
+    DurationTolerance time.Duration // Максимальная допустимая разница длительностей
+}
+
+// DefaultMatcher возвращает Matcher с параметрами по умолчанию.
+func DefaultMatcher() Matcher {
+    return Matcher{
+        Threshold:         DefaultMatchThreshold,
+        DurationTolerance: DefaultDurationTolerance,
+    }
+}
+
+// Score возвращает степень сходства двух треков от 0 до 1.
+func (m Matcher) Score(a, b TrackMetadata) float64 {
+    return m.Compare(a, b).Score
+}
+
+// Match сообщает, совпадают ли треки с оценкой не ниже порога.
+func (m Matcher) Match(a, b TrackMetadata) bool {
+    return m.Score(a, b) >= m.Threshold
 }
 
 // FindMissingTracks сравнивает два плейлиста и возвращает треки, отсутствующие в целевом.
 func FindMissingTracks(sourcePlaylist, targetPlaylist []TrackMetadata) []TrackMetadata {
-    missing := []TrackMetadata{}
-    for _, src := range sourcePlaylist {
-        found := false
-        for _, tgt := range targetPlaylist {
-            if areTracksMatching(src, tgt) {
-                found = true
-                break
+    return DefaultMatcher().FindMissingTracks(sourcePlaylist, targetPlaylist)
+}
+
+// FindMissingTracks сравнивает два плейлиста и возвращает треки, отсутствующие в целевом.
+func (m Matcher) FindMissingTracks(sourcePlaylist, targetPlaylist []TrackMetadata) []TrackMetadata {
+    return m.Diff(sourcePlaylist, targetPlaylist).Missing
+}
+
+// Score возвращает степень сходства двух треков от 0 до 1 с параметрами по умолчанию.
+func Score(a, b TrackMetadata) float64 {
+    return DefaultMatcher().Score(a, b)
+}
+
+// BestMatch выбирает из кандидатов трек с наибольшим сходством.
+// Возвращает индекс кандидата и результат сравнения с ним; -1, если кандидатов нет.
+func BestMatch(track TrackMetadata, candidates []TrackMetadata) (int, MatchResult) {
+    m := DefaultMatcher()
+    best, bestResult := -1, MatchResult{}
+    for i, c := range candidates {
+        if r := m.Compare(track, c); best < 0 || r.Score > bestResult.Score {
+            best, bestResult = i, r
+        }
+    }
+    return best, bestResult
+}
+
+// titleSimilarity сравнивает нормализованные названия: если они совпадают после удаления
+// уточнений в скобках и после " - " ("Song (Remastered 2011)", "Song - Live"), считаем их
+// близкими, иначе используем нормализованное расстояние Левенштейна.
+func titleSimilarity(a, b Normalized) float64 {
+    s := similarity(a.Name, b.Name)
+    if s < containmentScore && a.base != "" && a.base == b.base {
+        return containmentScore
+    }
+    return s
+}
+
+// baseTitle возвращает название без уточнений в скобках и после " - ".
+func baseTitle(s string) string {
+    var b strings.Builder
+    depth := 0
+    for _, r := range s {
+        switch r {
+        case '(', '[':
+            depth++
+        case ')', ']':
+            if depth > 0 {
+                depth--
+            }
+        default:
+            if depth == 0 {
+                b.WriteRune(r)
             }
         }
-        if !found {
-            missing = append(missing, src)
+    }
+    base := b.String()
+    if i := strings.Index(base, " - "); i > 0 {
+        base = base[:i]
+    }
+    return strings.Join(strings.Fields(base), " ")
+}
+
+// artistSimilarity сравнивает исполнителей; для списков через запятую ("A, B") берется
+// наилучшее совпадение с отдельными исполнителями.
+func artistSimilarity(a, b string) float64 {
+    best := similarity(a, b)
+    if !strings.Contains(a, ",") && !strings.Contains(b, ",") {
+        return best
+    }
+    for _, x := range splitArtists(a) {
+        for _, y := range splitArtists(b) {
+            if s := similarity(x, y); s > best {
+                best = s
+            }
         }
     }
-    return missing
+    return best
 }
 
-// areTracksMatching сравнивает два трека с использованием нормализации и расстояния Левенштейна.
-func areTracksMatching(a, b TrackMetadata) bool {
-    aName := strings.ToLower(strings.TrimSpace(a.Name))
-    bName := strings.ToLower(strings.TrimSpace(b.Name))
-    aArtist := strings.ToLower(strings.TrimSpace(a.Artist))
-    bArtist := strings.ToLower(strings.TrimSpace(b.Artist))
-    nameDiff := levenshtein.ComputeDistance(aName, bName)
-    artistDiff := levenshtein.ComputeDistance(aArtist, bArtist)
-    // Если разница в названии и исполнителе меньше 3 символов, считаем треки совпадающими.
-    return nameDiff < 3 && artistDiff < 3
+// splitArtists разбивает список исполнителей по запятым.
+func splitArtists(s string) []string {
+    result := []string{}
+    for _, part := range strings.Split(s, ",") {
+        if part = strings.TrimSpace(part); part != "" {
+            result = append(result, part)
+        }
+    }
+    return result
+}
+
+// similarity возвращает 1 - distance/maxLen для двух строк.
+func similarity(a, b string) float64 {
+    maxLen := utf8.RuneCountInString(a)
+    if l := utf8.RuneCountInString(b); l > maxLen {
+        maxLen = l
+    }
+    if maxLen == 0 {
+        return 1
+    }
+    return 1 - float64(levenshtein.ComputeDistance(a, b))/float64(maxLen)
 }
\ No newline at end of file
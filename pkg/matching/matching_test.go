@@ -0,0 +1,175 @@
+// pkg/matching/matching_test.go
+package matching
+
+import (
+    "math/rand"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestMatcherMatch(t *testing.T) {
+    m := DefaultMatcher()
+    cases := []struct {
+        name string
+        a, b TrackMetadata
+        want bool
+    }{
+        {
+            name: "уточнение в скобках",
+            a:    TrackMetadata{Name: "Song (Remastered 2011)", Artist: "Artist"},
+            b:    TrackMetadata{Name: "Song", Artist: "Artist"},
+            want: true,
+        },
+        {
+            name: "короткие разные названия",
+            a:    TrackMetadata{Name: "Home", Artist: "Artist"},
+            b:    TrackMetadata{Name: "Hope", Artist: "Artist"},
+            want: false,
+        },
+        {
+            name: "одинаковый ISRC",
+            a:    TrackMetadata{Name: "Совсем другое", Artist: "A", ISRC: "USRC17607839"},
+            b:    TrackMetadata{Name: "Song", Artist: "B", ISRC: "usrc17607839"},
+            want: true,
+        },
+        {
+            name: "разная длительность",
+            a:    TrackMetadata{Name: "Song", Artist: "Artist", Duration: 3 * time.Minute},
+            b:    TrackMetadata{Name: "Song", Artist: "Artist", Duration: 5 * time.Minute},
+            want: false,
+        },
+    }
+    for _, c := range cases {
+        if got := m.Match(c.a, c.b); got != c.want {
+            t.Errorf("%s: ожидалось %v, получено %v (оценка %.2f)", c.name, c.want, got, m.Score(c.a, c.b))
+        }
+    }
+}
+
+func TestFindMissingTracks(t *testing.T) {
+    source := []TrackMetadata{
+        {ID: "1", Name: "Yesterday", Artist: "The Beatles"},
+        {ID: "2", Name: "Help!", Artist: "The Beatles"},
+    }
+    target := []TrackMetadata{
+        {ID: "a", Name: "Yesterday - Remastered 2009", Artist: "The Beatles"},
+    }
+    missing := FindMissingTracks(source, target)
+    if len(missing) != 1 || missing[0].ID != "2" {
+        t.Errorf("Ожидался недостающий трек 2, получено %v", missing)
+    }
+}
+
+func TestNormalizeTrack(t *testing.T) {
+    cases := []struct {
+        in     TrackMetadata
+        name   string
+        artist string
+    }{
+        {
+            in:     TrackMetadata{Platform: "youtube", Name: "Queen – Bohemian Rhapsody (Official Video Remastered) [4K]", Artist: "Queen Official"},
+            name:   "bohemian rhapsody",
+            artist: "queen",
+        },
+        {
+            in:     TrackMetadata{Platform: "youtube", Name: "Déjà Vu (feat. Someone)", Artist: "Beyoncé - Topic"},
+            name:   "deja vu",
+            artist: "beyonce",
+        },
+        {
+            in:     TrackMetadata{Platform: "youtube", Name: "Bad Guy | Official Music Video", Artist: "BillieEilishVEVO"},
+            name:   "bad guy",
+            artist: "billieeilish",
+        },
+        {
+            in:     TrackMetadata{Platform: "spotify", Name: "Help! - Remastered 2009", Artist: "The Beatles"},
+            name:   "help",
+            artist: "the beatles",
+        },
+    }
+    for _, c := range cases {
+        n := NormalizeTrack(c.in)
+        if n.Name != c.name || n.Artist != c.artist {
+            t.Errorf("%q / %q: ожидалось %q / %q, получено %q / %q", c.in.Name, c.in.Artist, c.name, c.artist, n.Name, n.Artist)
+        }
+    }
+}
+
+func TestMatchYouTubeVideo(t *testing.T) {
+    spotify := TrackMetadata{Platform: "spotify", Name: "Bohemian Rhapsody - Remastered 2011", Artist: "Queen"}
+    youtube := TrackMetadata{Platform: "youtube", Name: "Queen - Bohemian Rhapsody (Official Video Remastered)", Artist: "Queen Official"}
+    if !DefaultMatcher().Match(spotify, youtube) {
+        t.Errorf("Ожидалось совпадение, оценка %.2f", Score(spotify, youtube))
+    }
+}
+
+
+// syntheticPlaylists генерирует два плейлиста по n треков, половина которых совпадает
+// с точностью до регистра, пометок и формата заголовка YouTube. Названия составляются
+// из словаря в несколько тысяч слов и частых служебных слов, как в реальных библиотеках.
+func syntheticPlaylists(n int) ([]TrackMetadata, []TrackMetadata) {
+    rnd := rand.New(rand.NewSource(1))
+    syllables := []string{"ka", "lo", "mi", "ra", "ne", "to", "su", "vi", "de", "an", "el", "or", "ba", "ti", "go", "ru"}
+    vocabulary := []string{}
+    for len(vocabulary) < 4000 {
+        w := ""
+        for i := 0; i < 2+rnd.Intn(2); i++ {
+            w += syllables[rnd.Intn(len(syllables))]
+        }
+        vocabulary = append(vocabulary, w)
+    }
+    stopWords := []string{"the", "of", "my", "you", "love", "in", "me", "a"}
+    title := func() string {
+        parts := []string{}
+        for i := 0; i < 1+rnd.Intn(4); i++ {
+            if rnd.Intn(3) == 0 {
+                parts = append(parts, stopWords[rnd.Intn(len(stopWords))])
+            } else {
+                parts = append(parts, vocabulary[rnd.Intn(len(vocabulary))])
+            }
+        }
+        return strings.Join(parts, " ")
+    }
+    artist := func() string {
+        return strings.Title(vocabulary[rnd.Intn(len(vocabulary))] + " " + vocabulary[rnd.Intn(len(vocabulary))])
+    }
+    source := make([]TrackMetadata, n)
+    target := make([]TrackMetadata, n)
+    for i := 0; i < n; i++ {
+        source[i] = TrackMetadata{ID: strconv.Itoa(i), Platform: "spotify", Name: strings.Title(title()), Artist: artist()}
+        if i%2 == 0 {
+            a := source[i].Artist
+            target[i] = TrackMetadata{ID: "y" + strconv.Itoa(i), Platform: "youtube", Name: a + " - " + strings.ToUpper(source[i].Name) + " (Official Video)", Artist: strings.ReplaceAll(a, " ", "") + "VEVO"}
+        } else {
+            target[i] = TrackMetadata{ID: "y" + strconv.Itoa(i), Platform: "youtube", Name: strings.Title(title()), Artist: artist()}
+        }
+    }
+    return source, target
+}
+
+func TestDiffMatchesPairwise(t *testing.T) {
+    source, target := syntheticPlaylists(400)
+    m := DefaultMatcher()
+    diff := m.Diff(source, target)
+    for _, src := range diff.Missing {
+        for _, tgt := range target {
+            if m.Match(src, tgt) {
+                t.Errorf("Трек %q помечен отсутствующим, но совпадает с %q", src.Name, tgt.Name)
+            }
+        }
+    }
+    if len(diff.Matches) < 200 {
+        t.Errorf("Ожидалось не менее 200 совпадений, получено %d", len(diff.Matches))
+    }
+}
+
+func BenchmarkDiff10k(b *testing.B) {
+    source, target := syntheticPlaylists(10000)
+    m := DefaultMatcher()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        m.Diff(source, target)
+    }
+}
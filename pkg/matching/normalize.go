@@ -0,0 +1,230 @@
+// pkg/matching/normalize.go
+package matching
+
+import (
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+// Платформы, для которых применяется дополнительная нормализация.
+const platformYouTube = "youtube"
+
+// Шаги нормализации, фиксируемые в Normalized.Steps.
+const (
+    StepUnicode       = "unicode"        // Приведение регистра, диакритики, тире и кавычек
+    StepSplitArtist   = "split_artist"   // Исполнитель извлечен из названия "Artist - Title"
+    StepDecorations   = "decorations"    // Удалены пометки (Official Video), [4K], Remastered и т.п.
+    StepFeaturing     = "featuring"      // Удалены упоминания feat./ft.
+    StepChannelSuffix = "channel_suffix" // Удалены суффиксы канала "- Topic", "VEVO", "Official"
+)
+
+// decorationWords — слова, по которым уточнение в скобках или после " - " считается пометкой, а не частью названия.
+var decorationWords = map[string]bool{
+    "official": true, "video": true, "audio": true, "lyric": true, "lyrics": true,
+    "hd": true, "hq": true, "4k": true, "1080p": true, "720p": true,
+    "remaster": true, "remastered": true, "visualizer": true, "visualiser": true,
+    "mv": true, "m/v": true, "clip": true, "videoclip": true, "explicit": true, "клип": true,
+}
+
+// featuringPrefixes — начала упоминаний приглашенных исполнителей.
+var featuringPrefixes = []string{"feat.", "feat ", "ft.", "ft ", "featuring ", "при участии "}
+
+// featuringMarkers — упоминания приглашенных исполнителей вместе с предшествующим пробелом или скобкой.
+var featuringMarkers = func() []string {
+    markers := []string{}
+    for _, p := range featuringPrefixes {
+        for _, lead := range []string{" ", "(", "["} {
+            markers = append(markers, lead+p)
+        }
+    }
+    return markers
+}()
+
+// channelSuffixes — служебные суффиксы названий каналов YouTube.
+var channelSuffixes = []string{" - topic", "vevo", " official", "official"}
+
+// foldReplacer заменяет буквы с диакритикой, типографские тире и кавычки на базовые символы.
+var foldReplacer = strings.NewReplacer(
+    "à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "ā", "a", "ă", "a", "ą", "a",
+    "ç", "c", "ć", "c", "č", "c",
+    "ď", "d", "đ", "d",
+    "è", "e", "é", "e", "ê", "e", "ë", "e", "ē", "e", "ė", "e", "ę", "e", "ě", "e",
+    "ì", "i", "í", "i", "î", "i", "ï", "i", "ī", "i", "į", "i", "ı", "i",
+    "ł", "l", "ľ", "l",
+    "ñ", "n", "ń", "n", "ň", "n",
+    "ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o", "ō", "o", "ő", "o",
+    "ř", "r",
+    "ś", "s", "š", "s", "ş", "s", "ß", "ss",
+    "ť", "t", "ţ", "t",
+    "ù", "u", "ú", "u", "û", "u", "ü", "u", "ū", "u", "ů", "u", "ű", "u",
+    "ý", "y", "ÿ", "y",
+    "ź", "z", "ż", "z", "ž", "z",
+    "æ", "ae", "œ", "oe",
+    "ё", "е", "й", "и",
+    "–", "-", "—", "-", "‐", "-", "‒", "-",
+    "‘", "'", "’", "'", "`", "'", "“", "\"", "”", "\"", "«", "\"", "»", "\"",
+    "＆", "&", " ", " ",
+)
+
+// Normalized — результат нормализации трека перед сравнением.
+type Normalized struct {
+    Name   string
+    Artist string
+    Steps  []string // Примененные шаги нормализации
+    base   string   // Название без уточнений (см. baseTitle), вычисляется один раз
+    length int      // Длина Name в символах
+}
+
+// NormalizeTrack приводит название и исполнителя трека к виду, пригодному для сравнения.
+// Для видео YouTube дополнительно разбирает заголовок "Artist - Title" и очищает название канала.
+func NormalizeTrack(t TrackMetadata) Normalized {
+    n := Normalized{}
+    name, artist := foldUnicode(t.Name), foldUnicode(t.Artist)
+    if name != strings.ToLower(strings.TrimSpace(t.Name)) || artist != strings.ToLower(strings.TrimSpace(t.Artist)) {
+        n.addStep(StepUnicode)
+    }
+    if t.Platform == platformYouTube {
+        cleaned := trimChannelSuffix(artist)
+        if cleaned != artist {
+            artist = cleaned
+            n.addStep(StepChannelSuffix)
+        }
+        if a, title, ok := splitArtistTitle(name); ok {
+            artist, name = a, title
+            n.addStep(StepSplitArtist)
+        }
+    }
+    if cleaned := stripFeaturing(name); cleaned != name {
+        name = cleaned
+        n.addStep(StepFeaturing)
+    }
+    if cleaned := stripDecorations(name); cleaned != name {
+        name = cleaned
+        n.addStep(StepDecorations)
+    }
+    if cleaned := stripFeaturing(artist); cleaned != artist {
+        artist = cleaned
+        n.addStep(StepFeaturing)
+    }
+    n.Name = cleanPunctuation(name)
+    n.Artist = cleanPunctuation(artist)
+    n.base = baseTitle(n.Name)
+    n.length = utf8.RuneCountInString(n.Name)
+    return n
+}
+
+// addStep добавляет шаг нормализации без повторов.
+func (n *Normalized) addStep(step string) {
+    for _, s := range n.Steps {
+        if s == step {
+            return
+        }
+    }
+    n.Steps = append(n.Steps, step)
+}
+
+// foldUnicode приводит строку к нижнему регистру, убирает диакритику и унифицирует тире и кавычки.
+func foldUnicode(s string) string {
+    return strings.TrimSpace(foldReplacer.Replace(strings.ToLower(s)))
+}
+
+// splitArtistTitle разбирает заголовок вида "Artist - Title".
+func splitArtistTitle(s string) (string, string, bool) {
+    i := strings.Index(s, " - ")
+    if i <= 0 {
+        return "", "", false
+    }
+    artist, title := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+3:])
+    // "Song - Remastered 2011" — пометка, а не пара "исполнитель - название".
+    if artist == "" || title == "" || isDecoration(stripDecorations(title)) {
+        return "", "", false
+    }
+    return artist, title, true
+}
+
+// trimChannelSuffix удаляет служебные суффиксы названия канала ("Artist - Topic", "ArtistVEVO").
+func trimChannelSuffix(s string) string {
+    for _, suffix := range channelSuffixes {
+        if strings.HasSuffix(s, suffix) && len(s) > len(suffix) {
+            return strings.TrimSpace(strings.TrimSuffix(s, suffix))
+        }
+    }
+    return s
+}
+
+// stripDecorations удаляет из названия уточнения-пометки в скобках, после " - " и после "|".
+func stripDecorations(s string) string {
+    var b strings.Builder
+    for len(s) > 0 {
+        open := strings.IndexAny(s, "([")
+        if open < 0 {
+            b.WriteString(s)
+            break
+        }
+        closeChar := ")"
+        if s[open] == '[' {
+            closeChar = "]"
+        }
+        end := strings.Index(s[open:], closeChar)
+        if end < 0 {
+            b.WriteString(s)
+            break
+        }
+        inner := s[open+1 : open+end]
+        b.WriteString(s[:open])
+        if !isDecoration(inner) {
+            b.WriteString(s[open : open+end+1])
+        }
+        s = s[open+end+1:]
+    }
+    result := b.String()
+    if i := strings.Index(result, "|"); i > 0 {
+        result = result[:i]
+    }
+    if i := strings.LastIndex(result, " - "); i > 0 && isDecoration(result[i+3:]) {
+        result = result[:i]
+    }
+    return strings.Join(strings.Fields(result), " ")
+}
+
+// isDecoration сообщает, состоит ли уточнение из пометок вроде "Official Video" или "2011 Remaster".
+func isDecoration(s string) bool {
+    if decorationWords[strings.TrimSpace(s)] {
+        return true
+    }
+    for _, w := range strings.Fields(s) {
+        if decorationWords[w] {
+            return true
+        }
+    }
+    return false
+}
+
+// stripFeaturing отбрасывает упоминание приглашенных исполнителей ("feat. X", "(ft. X)")
+// и все, что следует за ним.
+func stripFeaturing(s string) string {
+    for _, marker := range featuringMarkers {
+        if i := strings.Index(s, marker); i > 0 {
+            s = s[:i]
+        }
+    }
+    return strings.TrimSpace(s)
+}
+
+// cleanPunctuation оставляет буквы, цифры, пробелы, скобки, дефисы и запятые
+// (разделители исполнителей) и схлопывает пробелы.
+func cleanPunctuation(s string) string {
+    var b strings.Builder
+    for _, r := range s {
+        switch {
+        case unicode.IsLetter(r), unicode.IsDigit(r), strings.ContainsRune("()[]-,", r):
+            b.WriteRune(r)
+        case r == '&':
+            b.WriteString(" and ")
+        default:
+            b.WriteRune(' ')
+        }
+    }
+    return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,159 @@
+// pkg/matching/result.go
+package matching
+
+import (
+    "fmt"
+    "strings"
+)
+
+// ScoreUnknown обозначает оценку поля, которое невозможно сравнить (нет данных у одного из треков).
+const ScoreUnknown = -1.0
+
+// MatchResult — объяснимый результат сравнения двух треков.
+type MatchResult struct {
+    Score       float64  `json:"score"`        // Итоговая оценка от 0 до 1
+    Matched     bool     `json:"matched"`      // Оценка не ниже порога Matcher
+    Title       float64  `json:"title"`        // Сходство названий
+    Artist      float64  `json:"artist"`       // Сходство исполнителей
+    Duration    float64  `json:"duration"`     // Близость длительностей или ScoreUnknown
+    ISRC        float64  `json:"isrc"`         // 1 — коды совпали, 0 — различаются, ScoreUnknown — нет кода
+    Reason      string   `json:"reason"`       // Решающий фактор: "isrc", "duration", "text"
+    SourceSteps []string `json:"source_steps"` // Шаги нормализации первого трека
+    TargetSteps []string `json:"target_steps"` // Шаги нормализации второго трека
+}
+
+// Причины итоговой оценки.
+const (
+    ReasonISRC     = "isrc"     // Совпал ISRC
+    ReasonDuration = "duration" // Длительности различаются больше допустимого
+    ReasonText     = "text"     // Оценка по названию и исполнителю
+)
+
+// Compare сравнивает два трека и возвращает оценку с разбивкой по полям.
+// Совпадение ISRC дает 1, разница длительностей больше допустимой — 0,
+// иначе оценка вычисляется по названию и исполнителю.
+func (m Matcher) Compare(a, b TrackMetadata) MatchResult {
+    return m.compareNormalized(a, b, NormalizeTrack(a), NormalizeTrack(b))
+}
+
+// compareNormalized сравнивает треки, для которых нормализация уже выполнена.
+func (m Matcher) compareNormalized(a, b TrackMetadata, na, nb Normalized) MatchResult {
+    r := MatchResult{
+        Title:       titleSimilarity(na, nb),
+        Artist:      artistSimilarity(na.Artist, nb.Artist),
+        Duration:    ScoreUnknown,
+        ISRC:        ScoreUnknown,
+        SourceSteps: na.Steps,
+        TargetSteps: nb.Steps,
+    }
+    if a.ISRC != "" && b.ISRC != "" {
+        r.ISRC = 0
+        if strings.EqualFold(a.ISRC, b.ISRC) {
+            r.ISRC = 1
+        }
+    }
+    if a.Duration > 0 && b.Duration > 0 {
+        diff := a.Duration - b.Duration
+        if diff < 0 {
+            diff = -diff
+        }
+        r.Duration = 0
+        if m.DurationTolerance > 0 && diff <= m.DurationTolerance {
+            r.Duration = 1 - float64(diff)/float64(m.DurationTolerance)
+        } else if diff == 0 {
+            r.Duration = 1
+        }
+    }
+    switch {
+    case r.ISRC == 1:
+        r.Score, r.Reason = 1, ReasonISRC
+    case r.Duration == 0:
+        r.Score, r.Reason = 0, ReasonDuration
+    default:
+        // Квадрат усиливает штраф за расхождение в коротких названиях ("Home" и "Hope").
+        r.Score, r.Reason = titleWeight*r.Title*r.Title+artistWeight*r.Artist, ReasonText
+    }
+    r.Matched = r.Score >= m.Threshold
+    return r
+}
+
+// Explain формирует человекочитаемое объяснение результата,
+// например "совпадение 0.82: название 0.95, исполнитель 0.60, длительность 0.90, ISRC нет".
+func (r MatchResult) Explain() string {
+    var b strings.Builder
+    if r.Matched {
+        fmt.Fprintf(&b, "совпадение %.2f", r.Score)
+    } else {
+        fmt.Fprintf(&b, "нет совпадения %.2f", r.Score)
+    }
+    switch r.Reason {
+    case ReasonISRC:
+        b.WriteString(": совпал ISRC")
+    case ReasonDuration:
+        b.WriteString(": длительность различается больше допустимого")
+    default:
+        fmt.Fprintf(&b, ": название %.2f, исполнитель %.2f, длительность %s, ISRC %s",
+            r.Title, r.Artist, formatSubScore(r.Duration), formatSubScore(r.ISRC))
+    }
+    steps := append(append([]string{}, r.SourceSteps...), r.TargetSteps...)
+    if len(steps) > 0 {
+        fmt.Fprintf(&b, "; нормализация: %s", strings.Join(uniqueSteps(steps), ", "))
+    }
+    return b.String()
+}
+
+// formatSubScore форматирует оценку поля, заменяя ScoreUnknown на "нет".
+func formatSubScore(s float64) string {
+    if s == ScoreUnknown {
+        return "нет"
+    }
+    return fmt.Sprintf("%.2f", s)
+}
+
+// uniqueSteps удаляет повторяющиеся шаги нормализации, сохраняя порядок.
+func uniqueSteps(steps []string) []string {
+    seen := map[string]bool{}
+    result := []string{}
+    for _, s := range steps {
+        if !seen[s] {
+            seen[s] = true
+            result = append(result, s)
+        }
+    }
+    return result
+}
+
+// Pair — пара совпавших треков двух плейлистов с результатом сравнения.
+type Pair struct {
+    Source TrackMetadata `json:"source"`
+    Target TrackMetadata `json:"target"`
+    Result MatchResult   `json:"result"`
+}
+
+// DiffResult — результат сравнения двух плейлистов.
+type DiffResult struct {
+    Matches []Pair          `json:"matches"` // Треки источника, найденные в целевом плейлисте
+    Missing []TrackMetadata `json:"missing"` // Треки источника, отсутствующие в целевом плейлисте
+}
+
+// Diff сравнивает два плейлиста и возвращает найденные пары с объяснением и недостающие треки.
+func Diff(sourcePlaylist, targetPlaylist []TrackMetadata) DiffResult {
+    return DefaultMatcher().Diff(sourcePlaylist, targetPlaylist)
+}
+
+// Diff сравнивает два плейлиста и возвращает найденные пары с объяснением и недостающие треки.
+// Целевой плейлист индексируется (см. index.go), поэтому каждый трек источника сравнивается
+// только с кандидатами, имеющими тот же ISRC, тот же ключ "исполнитель + название"
+// или общее слово либо префикс названия.
+func (m Matcher) Diff(sourcePlaylist, targetPlaylist []TrackMetadata) DiffResult {
+    result := DiffResult{Matches: []Pair{}, Missing: []TrackMetadata{}}
+    idx := newTargetIndex(targetPlaylist)
+    for _, src := range sourcePlaylist {
+        if pair, ok := idx.find(m, src); ok {
+            result.Matches = append(result.Matches, pair)
+        } else {
+            result.Missing = append(result.Missing, src)
+        }
+    }
+    return result
+}
@@ -0,0 +1,95 @@
+// pkg/oauth/connect.go
+package oauth
+
+import (
+    "context"
+    "errors"
+    "net/url"
+    "strconv"
+    "strings"
+    gosync "sync"
+)
+
+const (
+    spotifyAuthorizeURL = "https://accounts.spotify.com/authorize"
+    youtubeAuthorizeURL = "https://accounts.google.com/o/oauth2/v2/auth"
+)
+
+var (
+    // spotifyScopes — права, необходимые для чтения и изменения плейлистов пользователя.
+    spotifyScopes = []string{
+        "playlist-read-private",
+        "playlist-read-collaborative",
+        "playlist-modify-public",
+        "playlist-modify-private",
+    }
+    // youtubeScopes — права на управление плейлистами YouTube.
+    youtubeScopes = []string{"https://www.googleapis.com/auth/youtube"}
+)
+
+// Notifier отправляет пользователю сообщение в чат Telegram.
+type Notifier interface {
+    Notify(chatID int64, text string)
+}
+
+var (
+    notifierMu gosync.RWMutex
+    notifier   Notifier
+)
+
+// SetNotifier задает получателя сообщений о результате авторизации (Telegram-бот).
+func SetNotifier(n Notifier) {
+    notifierMu.Lock()
+    defer notifierMu.Unlock()
+    notifier = n
+}
+
+// notify отправляет сообщение в чат, если получатель задан.
+func notify(chatID int64, text string) {
+    notifierMu.RLock()
+    n := notifier
+    notifierMu.RUnlock()
+    if n != nil {
+        n.Notify(chatID, text)
+    }
+}
+
+// SpotifyAuthURL возвращает ссылку авторизации в Spotify для пользователя chatID.
+// Токен, полученный по ссылке, сохраняется для этого пользователя (см. SpotifyCallbackHandler).
+func SpotifyAuthURL(chatID int64) (string, error) {
+    if spotifyClientID == "" || spotifyRedirectURI == "" {
+        return "", errors.New("OAuth Spotify не настроен")
+    }
+    state, err := generateState(context.Background(), strconv.FormatInt(chatID, 10))
+    if err != nil {
+        return "", err
+    }
+    q := url.Values{}
+    q.Set("client_id", spotifyClientID)
+    q.Set("response_type", "code")
+    q.Set("redirect_uri", spotifyRedirectURI)
+    q.Set("scope", strings.Join(spotifyScopes, " "))
+    q.Set("state", state)
+    return spotifyAuthorizeURL + "?" + q.Encode(), nil
+}
+
+// YouTubeAuthURL возвращает ссылку авторизации в YouTube для пользователя chatID.
+// Ссылка запрашивает офлайн-доступ, чтобы Google выдал refresh_token.
+func YouTubeAuthURL(chatID int64) (string, error) {
+    if youtubeClientID == "" || youtubeRedirectURI == "" {
+        return "", errors.New("OAuth YouTube не настроен")
+    }
+    state, err := generateYouTubeState(context.Background(), strconv.FormatInt(chatID, 10))
+    if err != nil {
+        return "", err
+    }
+    q := url.Values{}
+    q.Set("client_id", youtubeClientID)
+    q.Set("response_type", "code")
+    q.Set("redirect_uri", youtubeRedirectURI)
+    q.Set("scope", strings.Join(youtubeScopes, " "))
+    q.Set("access_type", "offline")
+    q.Set("prompt", "consent")
+    q.Set("state", state)
+    return youtubeAuthorizeURL + "?" + q.Encode(), nil
+}
\ No newline at end of file
@@ -0,0 +1,234 @@
+// pkg/oauth/crypto.go
+package oauth
+
+import (
+    "context"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "strings"
+    gosync "sync"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// sealedPrefix — префикс зашифрованного токена в Redis: enc:<ID ключа>:<base64(nonce|шифртекст)>.
+// Значения без префикса — токены, сохраненные до включения шифрования, в открытом JSON.
+const sealedPrefix = "enc:"
+
+// Keyring — ключи AES-256-GCM для шифрования токенов, индексированные по ID. Новые токены
+// шифруются основным ключом; остальные ключи нужны, чтобы прочитать токены, зашифрованные
+// до ротации (см. RotateTokenKeys).
+type Keyring struct {
+    keys    map[string]cipher.AEAD
+    primary string
+}
+
+// replaceTokenScript заменяет значение ключа, если оно не изменилось с момента чтения,
+// сохраняя срок жизни ключа.
+var replaceTokenScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+    redis.call("SET", KEYS[1], ARGV[2], "KEEPTTL")
+    return 1
+end
+return 0`)
+
+var (
+    keyringMu gosync.RWMutex
+    keyring   *Keyring
+)
+
+// ParseKeyring разбирает ключи в формате <ID>:<base64 32-байтного ключа>, разделенные запятыми
+// или переводами строк; строки, начинающиеся с #, пропускаются. Основным становится ключ
+// primaryID или, если он не задан, первый ключ списка.
+func ParseKeyring(spec, primaryID string) (*Keyring, error) {
+    k := &Keyring{keys: map[string]cipher.AEAD{}}
+    for _, entry := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' }) {
+        entry = strings.TrimSpace(entry)
+        if entry == "" || strings.HasPrefix(entry, "#") {
+            continue
+        }
+        parts := strings.SplitN(entry, ":", 2)
+        if len(parts) != 2 || parts[0] == "" {
+            return nil, fmt.Errorf("неверный формат ключа шифрования: ожидается <ID>:<ключ>")
+        }
+        id := strings.TrimSpace(parts[0])
+        raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+        if err != nil || len(raw) != 32 {
+            return nil, fmt.Errorf("ключ шифрования %s должен содержать 32 байта в base64", id)
+        }
+        if _, ok := k.keys[id]; ok {
+            return nil, fmt.Errorf("ключ шифрования %s указан дважды", id)
+        }
+        block, err := aes.NewCipher(raw)
+        if err != nil {
+            return nil, err
+        }
+        if k.keys[id], err = cipher.NewGCM(block); err != nil {
+            return nil, err
+        }
+        if k.primary == "" {
+            k.primary = id
+        }
+    }
+    if len(k.keys) == 0 {
+        return nil, nil
+    }
+    if primaryID != "" {
+        if _, ok := k.keys[primaryID]; !ok {
+            return nil, fmt.Errorf("основной ключ шифрования %s не найден", primaryID)
+        }
+        k.primary = primaryID
+    }
+    return k, nil
+}
+
+// LoadKeyring загружает ключи шифрования токенов из строки keys (TOKEN_ENCRYPTION_KEYS)
+// и файла keyFile (TOKEN_ENCRYPTION_KEY_FILE) в формате ParseKeyring. Если ключи не заданы,
+// возвращает nil: токены хранятся без шифрования, что сервис допускает только при
+// TOKEN_ENCRYPTION_ALLOW_PLAINTEXT (см. main).
+func LoadKeyring(keys, keyFile, primaryID string) (*Keyring, error) {
+    spec := keys
+    if keyFile != "" {
+        data, err := ioutil.ReadFile(keyFile)
+        if err != nil {
+            return nil, fmt.Errorf("ошибка чтения файла ключей: %v", err)
+        }
+        spec += "\n" + string(data)
+    }
+    return ParseKeyring(spec, primaryID)
+}
+
+// SetKeyring задает ключи шифрования токенов. Nil отключает шифрование новых токенов.
+func SetKeyring(k *Keyring) {
+    keyringMu.Lock()
+    defer keyringMu.Unlock()
+    keyring = k
+}
+
+// currentKeyring возвращает ключи шифрования токенов или nil.
+func currentKeyring() *Keyring {
+    keyringMu.RLock()
+    defer keyringMu.RUnlock()
+    return keyring
+}
+
+// Primary возвращает ID основного ключа.
+func (k *Keyring) Primary() string {
+    return k.primary
+}
+
+// seal шифрует data основным ключом. Ключ Redis key используется как дополнительные данные:
+// шифртекст нельзя подставить под ключ другого пользователя.
+func (k *Keyring) seal(key string, data []byte) (string, error) {
+    aead := k.keys[k.primary]
+    nonce := make([]byte, aead.NonceSize())
+    if _, err := rand.Read(nonce); err != nil {
+        return "", err
+    }
+    sealed := aead.Seal(nonce, nonce, data, []byte(key))
+    return sealedPrefix + k.primary + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open расшифровывает значение, сохраненное под ключом Redis key, и возвращает ID ключа шифрования.
+func (k *Keyring) open(key, value string) ([]byte, string, error) {
+    parts := strings.SplitN(strings.TrimPrefix(value, sealedPrefix), ":", 2)
+    if len(parts) != 2 {
+        return nil, "", errors.New("неверный формат зашифрованного токена")
+    }
+    var aead cipher.AEAD
+    if k != nil {
+        aead = k.keys[parts[0]]
+    }
+    if aead == nil {
+        return nil, "", fmt.Errorf("ключ шифрования %s не найден", parts[0])
+    }
+    sealed, err := base64.StdEncoding.DecodeString(parts[1])
+    if err != nil || len(sealed) < aead.NonceSize() {
+        return nil, "", errors.New("неверный формат зашифрованного токена")
+    }
+    data, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(key))
+    if err != nil {
+        return nil, "", fmt.Errorf("не удалось расшифровать токен ключом %s", parts[0])
+    }
+    return data, parts[0], nil
+}
+
+// sealToken шифрует JSON токена для сохранения под ключом Redis key, если заданы ключи шифрования.
+func sealToken(key string, data []byte) (string, error) {
+    k := currentKeyring()
+    if k == nil {
+        return string(data), nil
+    }
+    return k.seal(key, data)
+}
+
+// openToken возвращает JSON токена, сохраненного под ключом Redis key, и ID ключа шифрования
+// ("" для токена в открытом виде).
+func openToken(key, value string) ([]byte, string, error) {
+    if !strings.HasPrefix(value, sealedPrefix) {
+        return []byte(value), "", nil
+    }
+    return currentKeyring().open(key, value)
+}
+
+// RotateTokenKeys перешифровывает основным ключом все токены, зашифрованные другими ключами
+// или хранящиеся в открытом виде, и возвращает число перешифрованных токенов. Токен, измененный
+// во время ротации (например, обновленный), уже зашифрован основным ключом и пропускается.
+// Ошибка одного токена не прерывает ротацию: ошибки всех токенов возвращаются вместе.
+// После ротации без ошибок прежние ключи можно удалить из списка.
+func RotateTokenKeys(ctx context.Context, r *redis.Client) (int, error) {
+    k := currentKeyring()
+    if k == nil {
+        return 0, errors.New("ключи шифрования токенов не заданы")
+    }
+    rotated := 0
+    failed := []string{}
+    for _, p := range tokenProviders {
+        iter := r.Scan(ctx, 0, p.keyPrefix+"*", 100).Iterator()
+        for iter.Next(ctx) {
+            key := iter.Val()
+            replaced, err := rotateToken(ctx, r, k, key)
+            if err != nil {
+                failed = append(failed, fmt.Sprintf("%s: %v", key, err))
+                continue
+            }
+            rotated += replaced
+        }
+        if err := iter.Err(); err != nil {
+            failed = append(failed, fmt.Sprintf("%s*: %v", p.keyPrefix, err))
+        }
+    }
+    if len(failed) > 0 {
+        return rotated, fmt.Errorf("не перешифровано токенов: %d (%s)", len(failed), strings.Join(failed, "; "))
+    }
+    return rotated, nil
+}
+
+// rotateToken перешифровывает токен под ключом key основным ключом k и возвращает 1, если
+// токен перешифрован, или 0, если он уже зашифрован основным ключом, удален или изменен.
+func rotateToken(ctx context.Context, r *redis.Client, k *Keyring, key string) (int, error) {
+    value, err := r.Get(ctx, key).Result()
+    if err == redis.Nil {
+        return 0, nil
+    }
+    if err != nil {
+        return 0, err
+    }
+    data, keyID, err := openToken(key, value)
+    if err != nil {
+        return 0, err
+    }
+    if keyID == k.primary {
+        return 0, nil
+    }
+    sealed, err := k.seal(key, data)
+    if err != nil {
+        return 0, err
+    }
+    return replaceTokenScript.Run(ctx, r, []string{key}, value, sealed).Int()
+}
\ No newline at end of file
@@ -0,0 +1,57 @@
+// pkg/oauth/crypto_test.go
+package oauth
+
+import (
+    "bytes"
+    "encoding/base64"
+    "strings"
+    "testing"
+)
+
+func testKey(b byte) string {
+    return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestKeyringSealsTokens(t *testing.T) {
+    old, err := ParseKeyring("k1:"+testKey(1), "")
+    if err != nil {
+        t.Fatalf("Ошибка разбора ключей: %v", err)
+    }
+    sealed, err := old.seal("spotify_token:1", []byte(`{"access_token":"a"}`))
+    if err != nil {
+        t.Fatalf("Ошибка шифрования: %v", err)
+    }
+    if !strings.HasPrefix(sealed, "enc:k1:") || strings.Contains(sealed, "access_token") {
+        t.Errorf("Токен сохранен без шифрования: %q", sealed)
+    }
+    if _, _, err := old.open("spotify_token:2", sealed); err == nil {
+        t.Errorf("Токен расшифрован под ключом другого пользователя")
+    }
+
+    // После ротации основным становится k2, но токены, зашифрованные k1, остаются читаемыми.
+    rotated, err := ParseKeyring("k1:"+testKey(1)+",\nk2:"+testKey(2), "k2")
+    if err != nil {
+        t.Fatalf("Ошибка разбора ключей: %v", err)
+    }
+    data, keyID, err := rotated.open("spotify_token:1", sealed)
+    if err != nil || keyID != "k1" || string(data) != `{"access_token":"a"}` {
+        t.Fatalf("Токен не расшифрован прежним ключом: %q, %q, %v", data, keyID, err)
+    }
+    if resealed, _ := rotated.seal("spotify_token:1", data); !strings.HasPrefix(resealed, "enc:k2:") {
+        t.Errorf("Токен зашифрован не основным ключом: %q", resealed)
+    }
+}
+
+func TestParseKeyringRejectsInvalidKeys(t *testing.T) {
+    for _, spec := range []string{"k1:" + base64.StdEncoding.EncodeToString([]byte("short")), "k1", "k1:" + testKey(1) + ",k1:" + testKey(2)} {
+        if _, err := ParseKeyring(spec, ""); err == nil {
+            t.Errorf("Принят неверный список ключей %q", spec)
+        }
+    }
+    if _, err := ParseKeyring("k1:"+testKey(1), "k2"); err == nil {
+        t.Errorf("Принят отсутствующий основной ключ")
+    }
+    if k, err := ParseKeyring("# нет ключей\n", ""); k != nil || err != nil {
+        t.Errorf("Пустой список ключей должен отключать шифрование: %v, %v", k, err)
+    }
+}
\ No newline at end of file
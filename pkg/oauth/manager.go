@@ -0,0 +1,254 @@
+// pkg/oauth/manager.go
+package oauth
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "strconv"
+    gosync "sync"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+
+    "github.com/Clean1ines/scps/pkg/logging"
+)
+
+const (
+    // refreshMargin — access_token обновляется при использовании, если истекает раньше чем через refreshMargin.
+    refreshMargin = time.Minute
+    // refreshAhead — фоновое обновление затрагивает токены, истекающие в течение refreshAhead.
+    refreshAhead = 10 * time.Minute
+    // refreshLockPrefix — префикс ключей Redis, блокирующих обновление токена: oauth_refresh_lock:<ключ токена>.
+    refreshLockPrefix = "oauth_refresh_lock:"
+    // refreshLockTTL ограничивает время блокировки, если экземпляр упал во время обновления.
+    refreshLockTTL = 30 * time.Second
+    // refreshWait — время ожидания обновления токена другим экземпляром.
+    refreshWait = 15 * time.Second
+)
+
+// ErrNotConnected возвращается, если пользователь не подключил сервис (см. /connect).
+var ErrNotConnected = errors.New("сервис не подключен")
+
+// tokenProvider описывает хранение и обновление токенов сервиса.
+type tokenProvider struct {
+    name      string // Имя платформы для команды /connect
+    title     string
+    keyPrefix string
+    refresh   func(refreshToken string) (*Token, error)
+}
+
+// tokenProviders — сервисы, токенами которых управляет менеджер, по именам платформ.
+var tokenProviders = map[string]tokenProvider{
+    platformSpotify: {name: platformSpotify, title: "Spotify", keyPrefix: spotifyTokenKeyPrefix, refresh: RefreshSpotifyToken},
+    platformYouTube: {name: platformYouTube, title: "YouTube", keyPrefix: youtubeTokenKeyPrefix, refresh: RefreshYouTubeToken},
+}
+
+// releaseRefreshLockScript снимает блокировку обновления, если она принадлежит владельцу.
+var releaseRefreshLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+    return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+var (
+    // refreshLocks сериализует обновления одного токена внутри процесса; между экземплярами
+    // обновления сериализуются блокировкой в Redis. Запись удаляется, когда токен никто не обновляет.
+    refreshLocksMu gosync.Mutex
+    refreshLocks   = map[string]*refreshMutex{}
+)
+
+// AccessToken возвращает действующий access_token сервиса platform ("spotify", "youtube")
+// пользователя chatID, обновляя токен, если он истекает в течение refreshMargin.
+func AccessToken(ctx context.Context, r *redis.Client, platform string, chatID int64) (string, error) {
+    p, key, err := providerKey(platform, chatID)
+    if err != nil {
+        return "", err
+    }
+    token, err := loadToken(ctx, r, key)
+    if err == nil && token.ExpiresWithin(refreshMargin, time.Now()) {
+        token, err = refreshToken(ctx, r, p, key, func(t *Token) bool {
+            return t.ExpiresWithin(refreshMargin, time.Now())
+        })
+    }
+    if err != nil {
+        return "", tokenError(p, err)
+    }
+    if token.AccessToken == "" {
+        return "", fmt.Errorf("access_token %s отсутствует", p.title)
+    }
+    return token.AccessToken, nil
+}
+
+// RefreshToken принудительно обновляет токен сервиса platform пользователя chatID.
+func RefreshToken(ctx context.Context, r *redis.Client, platform string, chatID int64) error {
+    p, key, err := providerKey(platform, chatID)
+    if err != nil {
+        return err
+    }
+    token, err := loadToken(ctx, r, key)
+    if err != nil {
+        return tokenError(p, err)
+    }
+    _, err = refreshToken(ctx, r, p, key, func(t *Token) bool {
+        // Токен, обновленный другим экземпляром во время ожидания, повторно не обновляется.
+        return t.AccessToken == token.AccessToken
+    })
+    return tokenError(p, err)
+}
+
+// RefreshExpiring обновляет токены всех пользователей, истекающие в течение refreshAhead,
+// чтобы синхронизация не тратила время на обновление при первом запросе.
+func RefreshExpiring(ctx context.Context, r *redis.Client, logger *logging.Logger) {
+    for _, p := range tokenProviders {
+        users, err := tokenUsers(ctx, r, p.keyPrefix)
+        if err != nil {
+            logger.Errorf("Ошибка получения пользователей %s: %v", p.title, err)
+            continue
+        }
+        for _, chatID := range users {
+            key := p.key(chatID)
+            token, err := loadToken(ctx, r, key)
+            if err != nil || !token.ExpiresWithin(refreshAhead, time.Now()) {
+                continue
+            }
+            _, err = refreshToken(ctx, r, p, key, func(t *Token) bool {
+                return t.ExpiresWithin(refreshAhead, time.Now())
+            })
+            if err != nil {
+                logger.Errorf("Ошибка обновления токена %s пользователя %d: %v", p.title, chatID, err)
+                continue
+            }
+            logger.Infof("Токен %s пользователя %d обновлен", p.title, chatID)
+        }
+    }
+}
+
+// providerKey возвращает описание сервиса platform и ключ токена пользователя chatID.
+func providerKey(platform string, chatID int64) (tokenProvider, string, error) {
+    p, ok := tokenProviders[platform]
+    if !ok {
+        return tokenProvider{}, "", fmt.Errorf("неизвестный сервис: %s", platform)
+    }
+    return p, p.key(chatID), nil
+}
+
+// key возвращает ключ Redis с токеном сервиса пользователя chatID.
+func (p tokenProvider) key(chatID int64) string {
+    return p.keyPrefix + strconv.FormatInt(chatID, 10)
+}
+
+// tokenError дополняет ошибку получения токена названием сервиса.
+func tokenError(p tokenProvider, err error) error {
+    if err == ErrNotConnected {
+        return fmt.Errorf("%s: %w, выполните /connect %s", p.title, err, p.name)
+    }
+    if err != nil {
+        return fmt.Errorf("не удалось получить токен %s: %w", p.title, err)
+    }
+    return nil
+}
+
+// refreshToken обновляет токен по ключу key, если need сообщает, что токен нуждается в обновлении.
+// Одновременно токен обновляет только один обработчик: остальные ждут и используют результат.
+func refreshToken(ctx context.Context, r *redis.Client, p tokenProvider, key string, need func(*Token) bool) (*Token, error) {
+    unlock := lockRefresh(key)
+    defer unlock()
+
+    lockKey := refreshLockPrefix + key
+    owner, err := newRefreshOwner()
+    if err != nil {
+        return nil, err
+    }
+    deadline := time.Now().Add(refreshWait)
+    for {
+        token, err := loadToken(ctx, r, key)
+        if err != nil {
+            return nil, err
+        }
+        if !need(token) {
+            return token, nil
+        }
+        acquired, err := r.SetNX(ctx, lockKey, owner, refreshLockTTL).Result()
+        if err != nil {
+            return nil, err
+        }
+        if acquired {
+            defer releaseRefreshLockScript.Run(context.Background(), r, []string{lockKey}, owner)
+            // Токен перечитывается под блокировкой: его мог обновить предыдущий владелец.
+            if token, err = loadToken(ctx, r, key); err != nil || !need(token) {
+                return token, err
+            }
+            return refreshStored(ctx, r, p, key, token)
+        }
+        if time.Now().After(deadline) {
+            return nil, errors.New("истекло время ожидания обновления токена")
+        }
+        select {
+        case <-ctx.Done():
+            return nil, ctx.Err()
+        case <-time.After(200 * time.Millisecond):
+        }
+    }
+}
+
+// refreshStored обновляет токен token у сервиса и сохраняет результат. Если сервис не вернул
+// новый refresh_token или список прав, сохраняются прежние.
+func refreshStored(ctx context.Context, r *redis.Client, p tokenProvider, key string, token *Token) (*Token, error) {
+    if token.RefreshToken == "" {
+        return nil, errors.New("refresh_token отсутствует")
+    }
+    newToken, err := p.refresh(token.RefreshToken)
+    if err != nil {
+        return nil, err
+    }
+    if newToken.RefreshToken == "" {
+        newToken.RefreshToken = token.RefreshToken
+    }
+    if len(newToken.Scopes) == 0 {
+        newToken.Scopes = token.Scopes
+    }
+    if err := saveToken(ctx, r, key, newToken); err != nil {
+        return nil, err
+    }
+    return newToken, nil
+}
+
+// refreshMutex — мьютекс обновления токена и число обработчиков, которые его удерживают или ждут.
+type refreshMutex struct {
+    mu   gosync.Mutex
+    refs int
+}
+
+// lockRefresh захватывает мьютекс обновления токена по ключу key и возвращает функцию его
+// освобождения. Последний освободивший мьютекс обработчик удаляет его из refreshLocks.
+func lockRefresh(key string) func() {
+    refreshLocksMu.Lock()
+    l, ok := refreshLocks[key]
+    if !ok {
+        l = &refreshMutex{}
+        refreshLocks[key] = l
+    }
+    l.refs++
+    refreshLocksMu.Unlock()
+    l.mu.Lock()
+    return func() {
+        l.mu.Unlock()
+        refreshLocksMu.Lock()
+        defer refreshLocksMu.Unlock()
+        if l.refs--; l.refs == 0 {
+            delete(refreshLocks, key)
+        }
+    }
+}
+
+// newRefreshOwner генерирует случайный идентификатор владельца блокировки обновления.
+func newRefreshOwner() (string, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(b), nil
+}
\ No newline at end of file
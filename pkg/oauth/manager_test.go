@@ -0,0 +1,83 @@
+// pkg/oauth/manager_test.go
+package oauth
+
+import (
+    "errors"
+    "io/ioutil"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestExpiresWithin(t *testing.T) {
+    now := time.Now()
+    token := &Token{AccessToken: "a", Expiry: now.Add(5 * time.Minute)}
+    if token.ExpiresWithin(refreshMargin, now) {
+        t.Errorf("Токен, действующий еще 5 минут, обновляется при использовании")
+    }
+    if !token.ExpiresWithin(refreshAhead, now) {
+        t.Errorf("Токен, истекающий через 5 минут, пропущен фоновым обновлением")
+    }
+    if !(&Token{AccessToken: "a"}).ExpiresWithin(refreshMargin, now) {
+        t.Errorf("Токен без времени истечения должен считаться истекшим")
+    }
+}
+
+func TestTokenErrorNotConnected(t *testing.T) {
+    err := tokenError(tokenProviders[platformYouTube], ErrNotConnected)
+    if !errors.Is(err, ErrNotConnected) || err.Error() != "YouTube: сервис не подключен, выполните /connect youtube" {
+        t.Errorf("Неверная ошибка: %v", err)
+    }
+}
+
+func TestParseTokenResponse(t *testing.T) {
+    resp := &http.Response{
+        StatusCode: 200,
+        Body:       ioutil.NopCloser(strings.NewReader(`{"access_token":"a","refresh_token":"r","expires_in":3600,"scope":"playlist-read-private playlist-modify-public"}`)),
+    }
+    token, err := parseTokenResponse(resp, "ошибка")
+    if err != nil {
+        t.Fatalf("Ошибка разбора ответа: %v", err)
+    }
+    if token.AccessToken != "a" || token.RefreshToken != "r" || len(token.Scopes) != 2 {
+        t.Errorf("Неверный токен: %+v", token)
+    }
+    if token.ExpiresWithin(refreshAhead, time.Now()) || !token.ExpiresWithin(time.Hour, time.Now()) {
+        t.Errorf("Неверное время истечения: %v", token.Expiry)
+    }
+    resp = &http.Response{StatusCode: 400, Body: ioutil.NopCloser(strings.NewReader(`{"error":"invalid_grant"}`))}
+    if _, err := parseTokenResponse(resp, "ошибка обновления"); err == nil || err.Error() != "ошибка обновления" {
+        t.Errorf("Ожидалась ошибка сервиса, получено: %v", err)
+    }
+}
+func TestTokenRequestKeepsSecretsInBody(t *testing.T) {
+    req, err := newTokenRequest(youtubeTokenURL, map[string][]string{"client_secret": {"s3cret"}, "refresh_token": {"r1"}})
+    if err != nil {
+        t.Fatalf("Ошибка формирования запроса: %v", err)
+    }
+    if req.URL.RawQuery != "" {
+        t.Errorf("Параметры переданы в URL: %q", req.URL.RawQuery)
+    }
+    body, _ := ioutil.ReadAll(req.Body)
+    if string(body) != "client_secret=s3cret&refresh_token=r1" {
+        t.Errorf("Неверное тело запроса: %q", body)
+    }
+}
+
+func TestRefreshLocksReleased(t *testing.T) {
+    unlock := lockRefresh("spotify_token:1")
+    done := make(chan struct{})
+    go func() {
+        lockRefresh("spotify_token:1")()
+        close(done)
+    }()
+    time.Sleep(10 * time.Millisecond)
+    unlock()
+    <-done
+    refreshLocksMu.Lock()
+    defer refreshLocksMu.Unlock()
+    if len(refreshLocks) != 0 {
+        t.Errorf("Мьютексы обновления не удалены: %d", len(refreshLocks))
+    }
+}
\ No newline at end of file
@@ -3,13 +3,8 @@ package oauth
 
 import (
     "context"
-    "crypto/rand"
-    "encoding/base64"
-    "encoding/json"
-    "errors"
-    "fmt"
-    "io/ioutil"
     "net/http"
+    "net/url"
     "time"
 
     "github.com/Clean1ines/scps/pkg/logging"
@@ -26,21 +21,12 @@ var (
 
 const (
     spotifyTokenURL = "https://accounts.spotify.com/api/token"
-    stateKeyPrefix  = "spotify_oauth_state:"
+    platformSpotify = "spotify"
 )
 
-// generateState генерирует уникальное значение state для конкретного пользователя и сохраняет его в Redis.
+// generateState генерирует state, привязанный к пользователю userID, для авторизации в Spotify.
 func generateState(ctx context.Context, userID string) (string, error) {
-    b := make([]byte, 16)
-    if _, err := rand.Read(b); err != nil {
-        return "", err
-    }
-    state := base64.URLEncoding.EncodeToString(b)
-    key := stateKeyPrefix + userID
-    if err := redisClient.Set(ctx, key, state, 10*time.Minute).Err(); err != nil {
-        return "", err
-    }
-    return state, nil
+    return signState(ctx, redisClient, platformSpotify, userID, time.Now())
 }
 
 // InitSpotify инициализирует параметры OAuth для Spotify.
@@ -52,15 +38,21 @@ func InitSpotify(clientID, clientSecret, redirectURI string, r *redis.Client, lo
     logger = logg
 }
 
-// SpotifyCallbackHandler обрабатывает callback от Spotify OAuth.
+// SpotifyCallbackHandler обрабатывает callback от Spotify OAuth и сохраняет токен пользователя,
+// к которому привязан state. О результате пользователь получает сообщение в чат (см. SetNotifier).
 func SpotifyCallbackHandler(w http.ResponseWriter, r *http.Request) {
     ctx := r.Context()
-    state := r.URL.Query().Get("state")
-    // Фиксированный userID "default" используется для демонстрации.
-    expectedState, err := redisClient.Get(ctx, stateKeyPrefix+"default").Result()
-    if err != nil || state != expectedState {
+    chatID, err := stateUser(ctx, redisClient, platformSpotify, r.URL.Query().Get("state"))
+    if err != nil {
         http.Error(w, "Неверный state", http.StatusBadRequest)
-        logger.Errorf("Spotify: Неверный state: получено %s, ожидалось %s", state, expectedState)
+        logger.Errorf("Spotify: %v", err)
+        return
+    }
+    if reason := r.URL.Query().Get("error"); reason != "" {
+        // Пользователь отказался предоставить доступ.
+        http.Error(w, "Авторизация отклонена", http.StatusBadRequest)
+        logger.Errorf("Spotify: Авторизация пользователя %d отклонена: %s", chatID, reason)
+        notify(chatID, "Подключение Spotify отменено: доступ не предоставлен.")
         return
     }
     code := r.URL.Query().Get("code")
@@ -68,69 +60,55 @@ func SpotifyCallbackHandler(w http.ResponseWriter, r *http.Request) {
     if err != nil {
         http.Error(w, "Ошибка обмена кода на токен", http.StatusInternalServerError)
         logger.Errorf("Spotify: Ошибка обмена кода: %v", err)
+        notify(chatID, "Не удалось подключить Spotify: ошибка обмена кода на токен. Повторите /connect spotify")
+        return
+    }
+    if err := saveToken(ctx, redisClient, SpotifyTokenKey(chatID), token); err != nil {
+        http.Error(w, "Ошибка сохранения токена", http.StatusInternalServerError)
+        logger.Errorf("Spotify: Ошибка сохранения токена пользователя %d: %v", chatID, err)
+        notify(chatID, "Не удалось подключить Spotify: ошибка сохранения токена. Повторите /connect spotify")
         return
     }
-    tokenJSON, _ := json.Marshal(token)
-    redisClient.Set(ctx, "spotify_token", tokenJSON, time.Hour)
+    notify(chatID, "Spotify подключен.")
     w.Write([]byte("Spotify OAuth успешно завершен"))
 }
 
 // exchangeSpotifyCode обменивает код на access_token.
-func exchangeSpotifyCode(code string) (map[string]interface{}, error) {
-    req, err := http.NewRequest("POST", spotifyTokenURL, nil)
+func exchangeSpotifyCode(code string) (*Token, error) {
+    req, err := newTokenRequest(spotifyTokenURL, url.Values{
+        "grant_type":   {"authorization_code"},
+        "code":         {code},
+        "redirect_uri": {spotifyRedirectURI},
+    })
     if err != nil {
         return nil, err
     }
-    q := req.URL.Query()
-    q.Add("grant_type", "authorization_code")
-    q.Add("code", code)
-    q.Add("redirect_uri", spotifyRedirectURI)
-    req.URL.RawQuery = q.Encode()
     req.SetBasicAuth(spotifyClientID, spotifyClientSecret)
-    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
     client := &http.Client{}
     resp, err := client.Do(req)
     if err != nil {
         return nil, err
     }
     defer resp.Body.Close()
-    bodyBytes, _ := ioutil.ReadAll(resp.Body)
-    var tokenResp map[string]interface{}
-    if err := json.Unmarshal(bodyBytes, &tokenResp); err != nil {
-        return nil, err
-    }
-    if resp.StatusCode >= 300 {
-        return nil, errors.New("Spotify API вернул ошибку")
-    }
-    return tokenResp, nil
+    return parseTokenResponse(resp, "Spotify API вернул ошибку")
 }
 
 // RefreshSpotifyToken обновляет access_token с использованием refresh_token.
-func RefreshSpotifyToken(refreshToken string) (map[string]interface{}, error) {
-    req, err := http.NewRequest("POST", spotifyTokenURL, nil)
+func RefreshSpotifyToken(refreshToken string) (*Token, error) {
+    req, err := newTokenRequest(spotifyTokenURL, url.Values{
+        "grant_type":    {"refresh_token"},
+        "refresh_token": {refreshToken},
+        "redirect_uri":  {spotifyRedirectURI},
+    })
     if err != nil {
         return nil, err
     }
-    q := req.URL.Query()
-    q.Add("grant_type", "refresh_token")
-    q.Add("refresh_token", refreshToken)
-    q.Add("redirect_uri", spotifyRedirectURI)
-    req.URL.RawQuery = q.Encode()
     req.SetBasicAuth(spotifyClientID, spotifyClientSecret)
-    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
     client := &http.Client{}
     resp, err := client.Do(req)
     if err != nil {
         return nil, err
     }
     defer resp.Body.Close()
-    bodyBytes, _ := ioutil.ReadAll(resp.Body)
-    var tokenResp map[string]interface{}
-    if err := json.Unmarshal(bodyBytes, &tokenResp); err != nil {
-        return nil, err
-    }
-    if resp.StatusCode >= 300 {
-        return nil, errors.New("Spotify API вернул ошибку при обновлении токена")
-    }
-    return tokenResp, nil
+    return parseTokenResponse(resp, "Spotify API вернул ошибку при обновлении токена")
 }
\ No newline at end of file
@@ -2,7 +2,11 @@
 package oauth
 
 import (
+    "context"
+    "net/url"
+    "strings"
     "testing"
+    "time"
 )
 
 func TestExchangeSpotifyCode(t *testing.T) {
@@ -13,6 +17,8 @@ func TestExchangeSpotifyCode(t *testing.T) {
 }
 
 func TestGenerateState(t *testing.T) {
+    SetStateSecret("state-secret")
+    defer SetStateSecret("")
     state, err := generateState(nil, "default")
     if err != nil {
         t.Errorf("Ошибка генерации state: %v", err)
@@ -20,4 +26,56 @@ func TestGenerateState(t *testing.T) {
     if len(state) == 0 {
         t.Errorf("Ожидается непустой state")
     }
+}
+
+func TestStateBoundToUser(t *testing.T) {
+    SetStateSecret("state-secret")
+    defer SetStateSecret("")
+    state, err := generateYouTubeState(context.Background(), "42")
+    if err != nil {
+        t.Fatalf("Ошибка генерации state: %v", err)
+    }
+    if userID, err := verifyState(platformYouTube, state, time.Now()); err != nil || userID != "42" {
+        t.Errorf("Ожидался пользователь 42, получено %q (%v)", userID, err)
+    }
+    if _, err := verifyState(platformSpotify, state, time.Now()); err != ErrInvalidState {
+        t.Errorf("State YouTube принят в callback Spotify")
+    }
+    forged := "7" + strings.TrimPrefix(state, "42")
+    if _, err := verifyState(platformYouTube, forged, time.Now()); err != ErrInvalidState {
+        t.Errorf("Принят state с подмененным пользователем")
+    }
+    if _, err := verifyState(platformYouTube, state, time.Now().Add(stateTTL+time.Minute)); err != ErrInvalidState {
+        t.Errorf("Принят просроченный state")
+    }
+    SetStateSecret("other-secret")
+    if _, err := verifyState(platformYouTube, state, time.Now()); err != ErrInvalidState {
+        t.Errorf("Принят state, подписанный другим ключом")
+    }
+    SetStateSecret("")
+    if _, err := generateYouTubeState(context.Background(), "42"); err == nil {
+        t.Errorf("State выдан без ключа подписи")
+    }
+}
+
+func TestSpotifyAuthURLBoundToChat(t *testing.T) {
+    SetStateSecret("state-secret")
+    defer SetStateSecret("")
+    InitSpotify("client", "secret", "https://example.com/spotify/callback", nil, nil)
+    defer InitSpotify("", "", "", nil, nil)
+    authURL, err := SpotifyAuthURL(-100123)
+    if err != nil {
+        t.Fatalf("Ошибка формирования ссылки: %v", err)
+    }
+    u, err := url.Parse(authURL)
+    if err != nil {
+        t.Fatalf("Некорректная ссылка %q: %v", authURL, err)
+    }
+    q := u.Query()
+    if q.Get("client_id") != "client" || !strings.Contains(q.Get("scope"), "playlist-modify-private") {
+        t.Errorf("Неверные параметры ссылки: %v", q)
+    }
+    if chatID, err := stateUser(context.Background(), nil, platformSpotify, q.Get("state")); err != nil || chatID != -100123 {
+        t.Errorf("State привязан к %d, ожидался чат -100123 (%v)", chatID, err)
+    }
 }
\ No newline at end of file
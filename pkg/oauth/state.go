@@ -0,0 +1,141 @@
+// pkg/oauth/state.go
+package oauth
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "strconv"
+    "strings"
+    gosync "sync"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// stateTTL — время, в течение которого пользователь должен завершить авторизацию.
+const stateTTL = 10 * time.Minute
+
+// stateNoncePrefix — префикс ключей Redis с еще не использованными state: <префикс><сервис>:<случайное значение>.
+const stateNoncePrefix = "oauth_state:"
+
+var (
+    stateMu     gosync.RWMutex
+    stateSecret []byte
+)
+
+// ErrInvalidState возвращается, если state из callback подделан, просрочен, уже использован
+// или выдан для другого сервиса.
+var ErrInvalidState = errors.New("неверный или просроченный state")
+
+// SetStateSecret задает ключ подписи state (OAUTH_STATE_SECRET). Ключ обязателен и должен
+// совпадать на всех экземплярах сервиса, иначе callback, пришедший на другой экземпляр
+// или после перезапуска, будет отклонен. Без ключа state не выдается.
+func SetStateSecret(secret string) {
+    stateMu.Lock()
+    defer stateMu.Unlock()
+    stateSecret = nil
+    if secret != "" {
+        stateSecret = []byte(secret)
+    }
+}
+
+// stateKey возвращает ключ подписи state или nil, если он не задан.
+func stateKey() []byte {
+    stateMu.RLock()
+    defer stateMu.RUnlock()
+    return stateSecret
+}
+
+// stateNonceKey возвращает ключ Redis, под которым хранится неиспользованный state сервиса platform.
+func stateNonceKey(platform, nonce string) string {
+    return stateNoncePrefix + platform + ":" + nonce
+}
+
+// signState формирует state, привязанный к пользователю userID и сервису platform:
+// <userID>.<срок действия>.<случайное значение>.<подпись HMAC-SHA256>. Подпись не дает подменить
+// пользователя, а случайное значение сохраняется в Redis на stateTTL, чтобы state можно было
+// использовать только один раз (см. stateUser). Без Redis state проверяется только по подписи.
+func signState(ctx context.Context, r *redis.Client, platform, userID string, now time.Time) (string, error) {
+    if userID == "" || strings.Contains(userID, ".") {
+        return "", errors.New("некорректный ID пользователя")
+    }
+    key := stateKey()
+    if key == nil {
+        return "", errors.New("ключ подписи state не задан (OAUTH_STATE_SECRET)")
+    }
+    raw := make([]byte, 16)
+    if _, err := rand.Read(raw); err != nil {
+        return "", err
+    }
+    nonce := base64.RawURLEncoding.EncodeToString(raw)
+    if r != nil {
+        ok, err := r.SetNX(ctx, stateNonceKey(platform, nonce), userID, stateTTL).Result()
+        if err != nil {
+            return "", fmt.Errorf("ошибка сохранения state: %w", err)
+        }
+        if !ok {
+            return "", errors.New("state с таким значением уже выдан")
+        }
+    }
+    payload := userID + "." + strconv.FormatInt(now.Add(stateTTL).Unix(), 10) + "." + nonce
+    return payload + "." + stateSignature(key, platform, payload), nil
+}
+
+// verifyState проверяет подпись и срок действия state, полученного в callback сервиса platform,
+// и возвращает ID пользователя.
+func verifyState(platform, state string, now time.Time) (string, error) {
+    key := stateKey()
+    parts := strings.Split(state, ".")
+    if key == nil || len(parts) != 4 {
+        return "", ErrInvalidState
+    }
+    payload := strings.Join(parts[:3], ".")
+    if !hmac.Equal([]byte(parts[3]), []byte(stateSignature(key, platform, payload))) {
+        return "", ErrInvalidState
+    }
+    expires, err := strconv.ParseInt(parts[1], 10, 64)
+    if err != nil || now.Unix() > expires {
+        return "", ErrInvalidState
+    }
+    return parts[0], nil
+}
+
+// stateUser проверяет state из callback сервиса platform, помечает его использованным
+// (GETDEL случайного значения в Redis) и возвращает ID чата пользователя. Повторно
+// предъявленный state отклоняется.
+func stateUser(ctx context.Context, r *redis.Client, platform, state string) (int64, error) {
+    userID, err := verifyState(platform, state, time.Now())
+    if err != nil {
+        return 0, err
+    }
+    if r != nil {
+        nonce := strings.Split(state, ".")[2]
+        owner, err := r.GetDel(ctx, stateNonceKey(platform, nonce)).Result()
+        if err == redis.Nil {
+            return 0, ErrInvalidState
+        }
+        if err != nil {
+            return 0, fmt.Errorf("ошибка проверки state: %w", err)
+        }
+        if owner != userID {
+            return 0, ErrInvalidState
+        }
+    }
+    chatID, err := strconv.ParseInt(userID, 10, 64)
+    if err != nil {
+        return 0, fmt.Errorf("state выдан не пользователю Telegram: %s", userID)
+    }
+    return chatID, nil
+}
+
+// stateSignature вычисляет подпись state для сервиса platform.
+func stateSignature(key []byte, platform, payload string) string {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte(platform + ":" + payload))
+    return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
\ No newline at end of file
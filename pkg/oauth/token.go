@@ -0,0 +1,134 @@
+// pkg/oauth/token.go
+package oauth
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+const (
+    // Префиксы ключей Redis с токенами пользователей: <сервис>_token:<ID чата Telegram>.
+    spotifyTokenKeyPrefix = "spotify_token:"
+    youtubeTokenKeyPrefix = "youtube_token:"
+)
+
+// Token — токен OAuth пользователя, хранящийся в Redis.
+type Token struct {
+    AccessToken  string    `json:"access_token"`
+    RefreshToken string    `json:"refresh_token,omitempty"`
+    Expiry       time.Time `json:"expiry"`           // Время истечения AccessToken
+    Scopes       []string  `json:"scopes,omitempty"` // Права, предоставленные пользователем
+}
+
+// ExpiresWithin сообщает, истекает ли AccessToken в течение d. Токен без времени истечения
+// (сохраненный до появления менеджера токенов) считается истекшим.
+func (t *Token) ExpiresWithin(d time.Duration, now time.Time) bool {
+    return !now.Add(d).Before(t.Expiry)
+}
+
+// tokenResponse — ответ сервиса авторизации на обмен кода или обновление токена.
+type tokenResponse struct {
+    AccessToken  string `json:"access_token"`
+    RefreshToken string `json:"refresh_token"`
+    ExpiresIn    int    `json:"expires_in"` // Время жизни access_token в секундах
+    Scope        string `json:"scope"`      // Права через пробел
+}
+
+// newTokenRequest формирует POST-запрос к сервису авторизации tokenURL с параметрами form в теле
+// (application/x-www-form-urlencoded): client_secret, код и refresh_token не попадают в URL,
+// а с ним — в журналы прокси и серверов.
+func newTokenRequest(tokenURL string, form url.Values) (*http.Request, error) {
+    req, err := http.NewRequest("POST", tokenURL, strings.NewReader(form.Encode()))
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    return req, nil
+}
+
+// parseTokenResponse разбирает ответ сервиса авторизации; message — текст ошибки для статусов 3xx и выше.
+func parseTokenResponse(resp *http.Response, message string) (*Token, error) {
+    bodyBytes, _ := ioutil.ReadAll(resp.Body)
+    var tokenResp tokenResponse
+    if err := json.Unmarshal(bodyBytes, &tokenResp); err != nil {
+        return nil, err
+    }
+    if resp.StatusCode >= 300 {
+        return nil, errors.New(message)
+    }
+    if tokenResp.AccessToken == "" {
+        return nil, fmt.Errorf("%s: access_token отсутствует", message)
+    }
+    return &Token{
+        AccessToken:  tokenResp.AccessToken,
+        RefreshToken: tokenResp.RefreshToken,
+        Expiry:       time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
+        Scopes:       strings.Fields(tokenResp.Scope),
+    }, nil
+}
+
+// SpotifyTokenKey возвращает ключ Redis с токеном Spotify пользователя chatID.
+func SpotifyTokenKey(chatID int64) string {
+    return spotifyTokenKeyPrefix + strconv.FormatInt(chatID, 10)
+}
+
+// YouTubeTokenKey возвращает ключ Redis с токеном YouTube пользователя chatID.
+func YouTubeTokenKey(chatID int64) string {
+    return youtubeTokenKeyPrefix + strconv.FormatInt(chatID, 10)
+}
+
+// saveToken сохраняет токен в JSON, зашифрованный основным ключом (см. SetKeyring). Токен
+// хранится без TTL: RefreshToken нужен и после истечения AccessToken.
+func saveToken(ctx context.Context, r *redis.Client, key string, token *Token) error {
+    tokenJSON, err := json.Marshal(token)
+    if err != nil {
+        return err
+    }
+    sealed, err := sealToken(key, tokenJSON)
+    if err != nil {
+        return err
+    }
+    return r.Set(ctx, key, sealed, 0).Err()
+}
+
+// loadToken читает и расшифровывает токен по ключу key. Если токена нет, возвращает ErrNotConnected.
+func loadToken(ctx context.Context, r *redis.Client, key string) (*Token, error) {
+    tokenJSON, err := r.Get(ctx, key).Result()
+    if err == redis.Nil {
+        return nil, ErrNotConnected
+    }
+    if err != nil {
+        return nil, err
+    }
+    data, _, err := openToken(key, tokenJSON)
+    if err != nil {
+        return nil, err
+    }
+    var token Token
+    if err := json.Unmarshal(data, &token); err != nil {
+        return nil, fmt.Errorf("не удалось разобрать токен: %v", err)
+    }
+    return &token, nil
+}
+
+// tokenUsers перебирает ключи токенов с префиксом prefix и возвращает ID чатов их владельцев.
+func tokenUsers(ctx context.Context, r *redis.Client, prefix string) ([]int64, error) {
+    var users []int64
+    iter := r.Scan(ctx, 0, prefix+"*", 100).Iterator()
+    for iter.Next(ctx) {
+        if chatID, err := strconv.ParseInt(strings.TrimPrefix(iter.Val(), prefix), 10, 64); err == nil {
+            users = append(users, chatID)
+        }
+    }
+    return users, iter.Err()
+}
\ No newline at end of file
@@ -2,10 +2,9 @@
 package oauth
 
 import (
-    "encoding/json"
-    "fmt"
-    "io/ioutil"
+    "context"
     "net/http"
+    "net/url"
     "time"
 
     "github.com/Clean1ines/scps/pkg/logging"
@@ -22,7 +21,7 @@ var (
 
 const (
     youtubeTokenURL = "https://oauth2.googleapis.com/token"
-    stateKeyYT      = "youtube_oauth_state:default"
+    platformYouTube = "youtube"
 )
 
 // InitYouTube инициализирует параметры OAuth для YouTube.
@@ -34,14 +33,26 @@ func InitYouTube(clientID, clientSecret, redirectURI string, r *redis.Client, lo
     loggerYT = logg
 }
 
-// YouTubeCallbackHandler обрабатывает callback от YouTube OAuth.
+// generateYouTubeState генерирует state, привязанный к пользователю userID, для авторизации в YouTube.
+func generateYouTubeState(ctx context.Context, userID string) (string, error) {
+    return signState(ctx, redisYTClient, platformYouTube, userID, time.Now())
+}
+
+// YouTubeCallbackHandler обрабатывает callback от YouTube OAuth и сохраняет токен пользователя,
+// к которому привязан state. О результате пользователь получает сообщение в чат (см. SetNotifier).
 func YouTubeCallbackHandler(w http.ResponseWriter, r *http.Request) {
     ctx := r.Context()
-    state := r.URL.Query().Get("state")
-    expectedState, err := redisYTClient.Get(ctx, stateKeyYT).Result()
-    if err != nil || state != expectedState {
+    chatID, err := stateUser(ctx, redisYTClient, platformYouTube, r.URL.Query().Get("state"))
+    if err != nil {
         http.Error(w, "Неверный state", http.StatusBadRequest)
-        loggerYT.Errorf("YouTube: Неверный state: получено %s, ожидалось %s", state, expectedState)
+        loggerYT.Errorf("YouTube: %v", err)
+        return
+    }
+    if reason := r.URL.Query().Get("error"); reason != "" {
+        // Пользователь отказался предоставить доступ.
+        http.Error(w, "Авторизация отклонена", http.StatusBadRequest)
+        loggerYT.Errorf("YouTube: Авторизация пользователя %d отклонена: %s", chatID, reason)
+        notify(chatID, "Подключение YouTube отменено: доступ не предоставлен.")
         return
     }
     code := r.URL.Query().Get("code")
@@ -49,40 +60,57 @@ func YouTubeCallbackHandler(w http.ResponseWriter, r *http.Request) {
     if err != nil {
         http.Error(w, "Ошибка обмена кода на токен", http.StatusInternalServerError)
         loggerYT.Errorf("YouTube: Ошибка обмена кода: %v", err)
+        notify(chatID, "Не удалось подключить YouTube: ошибка обмена кода на токен. Повторите /connect youtube")
+        return
+    }
+    if err := saveToken(ctx, redisYTClient, YouTubeTokenKey(chatID), token); err != nil {
+        http.Error(w, "Ошибка сохранения токена", http.StatusInternalServerError)
+        loggerYT.Errorf("YouTube: Ошибка сохранения токена пользователя %d: %v", chatID, err)
+        notify(chatID, "Не удалось подключить YouTube: ошибка сохранения токена. Повторите /connect youtube")
         return
     }
-    tokenJSON, _ := json.Marshal(token)
-    redisYTClient.Set(ctx, "youtube_token", tokenJSON, time.Hour)
+    notify(chatID, "YouTube подключен.")
     w.Write([]byte("YouTube OAuth успешно завершен"))
 }
 
 // exchangeYouTubeCode обменивает код на access_token для YouTube.
-func exchangeYouTubeCode(code string) (map[string]interface{}, error) {
-    req, err := http.NewRequest("POST", youtubeTokenURL, nil)
+func exchangeYouTubeCode(code string) (*Token, error) {
+    req, err := newTokenRequest(youtubeTokenURL, url.Values{
+        "grant_type":    {"authorization_code"},
+        "code":          {code},
+        "redirect_uri":  {youtubeRedirectURI},
+        "client_id":     {youtubeClientID},
+        "client_secret": {youtubeClientSecret},
+    })
     if err != nil {
         return nil, err
     }
-    q := req.URL.Query()
-    q.Add("grant_type", "authorization_code")
-    q.Add("code", code)
-    q.Add("redirect_uri", youtubeRedirectURI)
-    q.Add("client_id", youtubeClientID)
-    q.Add("client_secret", youtubeClientSecret)
-    req.URL.RawQuery = q.Encode()
-    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
     client := &http.Client{}
     resp, err := client.Do(req)
     if err != nil {
         return nil, err
     }
     defer resp.Body.Close()
-    bodyBytes, _ := ioutil.ReadAll(resp.Body)
-    var tokenResp map[string]interface{}
-    if err := json.Unmarshal(bodyBytes, &tokenResp); err != nil {
+    return parseTokenResponse(resp, "YouTube API вернул ошибку")
+}
+
+// RefreshYouTubeToken обновляет access_token YouTube с использованием refresh_token.
+// Google не возвращает новый refresh_token при обновлении: прежний сохраняет менеджер токенов.
+func RefreshYouTubeToken(refreshToken string) (*Token, error) {
+    req, err := newTokenRequest(youtubeTokenURL, url.Values{
+        "grant_type":    {"refresh_token"},
+        "refresh_token": {refreshToken},
+        "client_id":     {youtubeClientID},
+        "client_secret": {youtubeClientSecret},
+    })
+    if err != nil {
         return nil, err
     }
-    if resp.StatusCode >= 300 {
-        return nil, fmt.Errorf("YouTube API вернул ошибку")
+    client := &http.Client{}
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, err
     }
-    return tokenResp, nil
+    defer resp.Body.Close()
+    return parseTokenResponse(resp, "YouTube API вернул ошибку при обновлении токена")
 }
\ No newline at end of file
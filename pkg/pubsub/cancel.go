@@ -0,0 +1,125 @@
+// pkg/pubsub/cancel.go
+package pubsub
+
+import (
+    "context"
+    "errors"
+    "time"
+
+    "github.com/Clean1ines/scps/pkg/logging"
+)
+
+// jobCancelChannel — канал Redis Pub/Sub, через который запрос отмены доходит до экземпляра,
+// выполняющего задачу.
+const jobCancelChannel = "scps_job_cancel"
+
+// ErrJobFinished возвращается при попытке отменить завершенную задачу.
+var ErrJobFinished = errors.New("задача уже завершена")
+
+// CancelJob отменяет задачу: задача в очереди помечается отмененной и не будет выполнена,
+// у выполняющейся задачи отменяется контекст синхронизации (на любом экземпляре сервиса),
+// и дальнейшие изменения плейлистов не отправляются. Возвращает состояние задачи на момент отмены.
+func (p *PubSubClient) CancelJob(ctx context.Context, id string) (*Job, error) {
+    if p.redis == nil {
+        if p.cancelRunning(id) {
+            return &Job{ID: id, Status: JobRunning, CancelRequested: true}, nil
+        }
+        return nil, ErrJobNotFound
+    }
+    job, err := p.Job(ctx, id)
+    if err != nil {
+        return nil, err
+    }
+    if job.Finished() {
+        return job, ErrJobFinished
+    }
+    finished := false
+    p.updateJob(ctx, id, func(j *Job) {
+        job, finished = j, j.Finished()
+        if finished {
+            // Задача завершилась после чтения состояния.
+            return
+        }
+        j.CancelRequested = true
+        if j.Status == JobQueued || j.Status == JobParked {
+            // Обработчик, получив задачу, увидит запрос отмены и не станет ее выполнять;
+            // отложенная задача не будет возобновлена.
+            now := time.Now()
+            j.Status = JobCancelled
+            j.FinishedAt = &now
+        }
+    })
+    if finished {
+        return job, ErrJobFinished
+    }
+    if !p.cancelRunning(id) {
+        if err := p.redis.Publish(ctx, jobCancelChannel, id).Err(); err != nil {
+            return nil, err
+        }
+    }
+    return job, nil
+}
+
+// cancelRequested сообщает, запрошена ли отмена задачи.
+func (p *PubSubClient) cancelRequested(ctx context.Context, id string) bool {
+    if id == "" {
+        return false
+    }
+    job, err := p.Job(ctx, id)
+    return err == nil && (job.CancelRequested || job.Status == JobCancelled)
+}
+
+// trackRunning запоминает функцию отмены выполняющейся задачи.
+func (p *PubSubClient) trackRunning(id string, cancel context.CancelFunc) {
+    if id == "" {
+        return
+    }
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if p.running == nil {
+        p.running = map[string]context.CancelFunc{}
+    }
+    p.running[id] = cancel
+}
+
+// untrackRunning удаляет задачу из выполняющихся.
+func (p *PubSubClient) untrackRunning(id string) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    delete(p.running, id)
+}
+
+// cancelRunning отменяет задачу, если она выполняется в этом процессе.
+func (p *PubSubClient) cancelRunning(id string) bool {
+    p.mu.RLock()
+    cancel, ok := p.running[id]
+    p.mu.RUnlock()
+    if ok {
+        cancel()
+    }
+    return ok
+}
+
+// watchCancellations получает запросы отмены из канала Redis до отмены ctx и отменяет
+// задачи, выполняющиеся в этом процессе.
+func (p *PubSubClient) watchCancellations(ctx context.Context, logger *logging.Logger) {
+    if p.redis == nil {
+        return
+    }
+    sub := p.redis.Subscribe(ctx, jobCancelChannel)
+    defer sub.Close()
+    ch := sub.Channel()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case msg, ok := <-ch:
+            if !ok {
+                return
+            }
+            if p.cancelRunning(msg.Payload) {
+                logger.Infof("Задача %s отменена", msg.Payload)
+            }
+        }
+    }
+}
\ No newline at end of file
@@ -0,0 +1,195 @@
+// pkg/pubsub/deadletter.go
+package pubsub
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+
+    "github.com/Clean1ines/scps/pkg/auth"
+    "github.com/Clean1ines/scps/pkg/sync"
+)
+
+// deadLettersKey — хэш Redis с недоставленными задачами: ID -> DeadLetter в JSON.
+const deadLettersKey = "scps_dead_letters"
+
+// claimDeadLetterScript атомарно читает и удаляет недоставленную задачу, чтобы ее не
+// опубликовали заново два параллельных запроса.
+var claimDeadLetterScript = redis.NewScript(`
+local data = redis.call("HGET", KEYS[1], ARGV[1])
+if data then
+    redis.call("HDEL", KEYS[1], ARGV[1])
+end
+return data`)
+
+// ErrDeadLetterNotFound возвращается, если недоставленной задачи с указанным ID нет.
+var ErrDeadLetterNotFound = errors.New("недоставленная задача не найдена")
+
+// DeadLetter — задача, не выполненная за все попытки или завершившаяся неисправимой ошибкой.
+type DeadLetter struct {
+    ID       string    `json:"id"`
+    Task     SyncTask  `json:"task"`
+    Error    string    `json:"error"`    // Ошибка последней попытки
+    Attempts int       `json:"attempts"` // Число выполненных попыток
+    FailedAt time.Time `json:"failed_at"`
+}
+
+// saveDeadLetter сохраняет задачу в хранилище недоставленных задач.
+func (p *PubSubClient) saveDeadLetter(ctx context.Context, task SyncTask, taskErr error) (*DeadLetter, error) {
+    if p.redis == nil {
+        return nil, errors.New("хранилище недоставленных задач недоступно: Redis не подключен")
+    }
+    id, err := newID()
+    if err != nil {
+        return nil, err
+    }
+    dl := &DeadLetter{
+        ID:       id,
+        Task:     task,
+        Error:    taskErr.Error(),
+        Attempts: task.Attempt + 1,
+        FailedAt: time.Now(),
+    }
+    data, err := json.Marshal(dl)
+    if err != nil {
+        return nil, err
+    }
+    if err := p.redis.HSet(ctx, deadLettersKey, id, data).Err(); err != nil {
+        return nil, err
+    }
+    return dl, nil
+}
+
+// DeadLetters возвращает недоставленные задачи, начиная с самых старых.
+func (p *PubSubClient) DeadLetters(ctx context.Context) ([]DeadLetter, error) {
+    if p.redis == nil {
+        return nil, nil
+    }
+    values, err := p.redis.HGetAll(ctx, deadLettersKey).Result()
+    if err != nil {
+        return nil, err
+    }
+    letters := make([]DeadLetter, 0, len(values))
+    for _, v := range values {
+        var dl DeadLetter
+        if err := json.Unmarshal([]byte(v), &dl); err != nil {
+            continue
+        }
+        letters = append(letters, dl)
+    }
+    sort.Slice(letters, func(i, j int) bool { return letters[i].FailedAt.Before(letters[j].FailedAt) })
+    return letters, nil
+}
+
+// DeadLetter возвращает недоставленную задачу по ID.
+func (p *PubSubClient) DeadLetter(ctx context.Context, id string) (*DeadLetter, error) {
+    if p.redis == nil {
+        return nil, ErrDeadLetterNotFound
+    }
+    data, err := p.redis.HGet(ctx, deadLettersKey, id).Result()
+    if err == redis.Nil {
+        return nil, ErrDeadLetterNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+    var dl DeadLetter
+    if err := json.Unmarshal([]byte(data), &dl); err != nil {
+        return nil, err
+    }
+    return &dl, nil
+}
+
+// ReplayDeadLetter забирает недоставленную задачу из хранилища и публикует ее заново
+// со сброшенным счетчиком попыток. Если публикация не удалась, задача возвращается в хранилище.
+func (p *PubSubClient) ReplayDeadLetter(ctx context.Context, id string) (*DeadLetter, error) {
+    if p.redis == nil {
+        return nil, ErrDeadLetterNotFound
+    }
+    data, err := claimDeadLetterScript.Run(ctx, p.redis, []string{deadLettersKey}, id).Text()
+    if err == redis.Nil {
+        return nil, ErrDeadLetterNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+    var dl DeadLetter
+    if err := json.Unmarshal([]byte(data), &dl); err != nil {
+        return nil, err
+    }
+    task := dl.Task
+    task.Attempt = 0
+    // Задача публикуется с прежним ID: плейлисты читаются заново, а не из контрольной точки.
+    err = sync.ResetPageCursors(ctx, p.redis, task.JobID)
+    if err == nil {
+        _, err = p.PublishTask(ctx, task)
+    }
+    if err != nil {
+        restoreCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        if restoreErr := p.redis.HSet(restoreCtx, deadLettersKey, id, data).Err(); restoreErr != nil {
+            return nil, fmt.Errorf("%v (задача не возвращена в хранилище: %v)", err, restoreErr)
+        }
+        return nil, err
+    }
+    return &dl, nil
+}
+
+// DeadLetterHandler обслуживает HTTP API недоставленных задач: GET /dead-letters возвращает
+// список задач в JSON, POST /dead-letters/{id}/replay публикует задачу заново. Обработчик
+// подключается через auth.Require: пользователь видит и повторяет только свои задачи,
+// администратор — задачи всех пользователей.
+func (p *PubSubClient) DeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    identity := auth.FromContext(ctx)
+    if identity == nil {
+        http.Error(w, auth.ErrUnauthorized.Error(), http.StatusUnauthorized)
+        return
+    }
+    path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/dead-letters"), "/")
+    switch {
+    case path == "" && r.Method == http.MethodGet:
+        letters, err := p.DeadLetters(ctx)
+        if err != nil {
+            http.Error(w, fmt.Sprintf("Ошибка чтения недоставленных задач: %v", err), 500)
+            return
+        }
+        visible := []DeadLetter{}
+        for _, dl := range letters {
+            if identity.CanAccess(dl.Task.ChatID) {
+                visible = append(visible, dl)
+            }
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(visible)
+    case strings.HasSuffix(path, "/replay") && r.Method == http.MethodPost:
+        id := strings.TrimSuffix(path, "/replay")
+        dl, err := p.DeadLetter(ctx, id)
+        if err == nil && !identity.CanAccess(dl.Task.ChatID) {
+            // Чужая задача не отличается от несуществующей.
+            err = ErrDeadLetterNotFound
+        }
+        if err == nil {
+            dl, err = p.ReplayDeadLetter(ctx, id)
+        }
+        if err == ErrDeadLetterNotFound {
+            http.Error(w, err.Error(), 404)
+            return
+        }
+        if err != nil {
+            http.Error(w, fmt.Sprintf("Ошибка повторной публикации: %v", err), 500)
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(dl)
+    default:
+        http.Error(w, "Неизвестный запрос", 404)
+    }
+}
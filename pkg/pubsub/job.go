@@ -0,0 +1,381 @@
+// pkg/pubsub/job.go
+package pubsub
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+
+    "github.com/Clean1ines/scps/pkg/auth"
+    "github.com/Clean1ines/scps/pkg/sync"
+)
+
+// JobStatus — состояние задачи в очереди.
+type JobStatus string
+
+const (
+    JobQueued    JobStatus = "queued"    // Задача ожидает обработчика (в том числе повтора)
+    JobRunning   JobStatus = "running"   // Задача выполняется
+    JobSucceeded JobStatus = "succeeded" // Задача выполнена
+    JobFailed    JobStatus = "failed"    // Задача не выполнена за все попытки (см. DeadLetters)
+    JobCancelled JobStatus = "cancelled" // Задача отменена пользователем
+    JobParked    JobStatus = "parked"    // Задача отложена до сброса квоты сервиса (см. ResumeAt)
+)
+
+const (
+    // jobKeyPrefix — префикс ключей Redis с состоянием задач: scps_job:<ID>.
+    jobKeyPrefix = "scps_job:"
+    // chatJobsKeyPrefix — префикс списков последних задач чата: scps_chat_jobs:<chatID>.
+    chatJobsKeyPrefix = "scps_chat_jobs:"
+    // chatJobsLimit — число задач, которые хранятся в списке чата.
+    chatJobsLimit = 10
+    // jobItemsKeyPrefix — префикс списков операций, примененных задачей: scps_job_items:<ID>.
+    jobItemsKeyPrefix = "scps_job_items:"
+    // jobTTL — время хранения состояния задачи после последнего изменения.
+    jobTTL = 7 * 24 * time.Hour
+    // jobWriteRetries — число попыток изменения состояния задачи при одновременной записи.
+    jobWriteRetries = 5
+)
+
+// ErrJobNotFound возвращается, если задачи с указанным ID нет.
+var ErrJobNotFound = errors.New("задача не найдена")
+
+// Job — состояние задачи, хранящееся в Redis.
+type Job struct {
+    ID              string        `json:"id"`
+    Type            string        `json:"type"`
+    ChatID          int64         `json:"chat_id,omitempty"`
+    Status          JobStatus     `json:"status"`
+    Attempt         int           `json:"attempt"`                    // Номер текущей попытки, начиная с нуля
+    Error           string        `json:"error,omitempty"`            // Ошибка последней неудачной попытки
+    Progress        sync.Progress `json:"progress"`                   // Ход синхронизации; операции хранятся отдельно (см. JobItems)
+    CancelRequested bool          `json:"cancel_requested,omitempty"` // Пользователь запросил отмену (см. CancelJob)
+    CreatedAt       time.Time     `json:"created_at"`
+    UpdatedAt       time.Time     `json:"updated_at"`
+    StartedAt       *time.Time    `json:"started_at,omitempty"`  // Начало последней попытки
+    FinishedAt      *time.Time    `json:"finished_at,omitempty"` // Завершение задачи (успех, ошибка или отмена)
+    ResumeAt        *time.Time    `json:"resume_at,omitempty"`   // Время возобновления отложенной задачи или повтора
+}
+
+// Finished сообщает, завершена ли задача.
+func (j *Job) Finished() bool {
+    return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+// Summary возвращает описание состояния задачи для пользователя.
+func (j *Job) Summary() string {
+    text := fmt.Sprintf("Задача %s: %s", j.ID, j.Status.Title())
+    if j.Attempt > 0 {
+        text += fmt.Sprintf(", попытка %d", j.Attempt+1)
+    }
+    if j.Progress.Total > 0 {
+        text += fmt.Sprintf("\nОбработано треков: %d из %d", j.Progress.Applied, j.Progress.Total)
+        if j.Progress.Failed > 0 {
+            text += fmt.Sprintf(", с ошибкой: %d", j.Progress.Failed)
+        }
+    }
+    if j.Status == JobParked && j.ResumeAt != nil {
+        text += "\nВозобновление после " + j.ResumeAt.Local().Format("02.01 15:04")
+    } else if j.Status == JobQueued && j.ResumeAt != nil {
+        text += "\nПовтор после " + j.ResumeAt.Local().Format("02.01 15:04:05")
+    }
+    if j.Error != "" {
+        text += "\nОшибка: " + j.Error
+    }
+    return text + "\nОбновлено: " + j.UpdatedAt.Format("02.01 15:04:05")
+}
+
+// Title возвращает название состояния на русском.
+func (s JobStatus) Title() string {
+    switch s {
+    case JobQueued:
+        return "в очереди"
+    case JobRunning:
+        return "выполняется"
+    case JobSucceeded:
+        return "выполнена"
+    case JobFailed:
+        return "завершилась ошибкой"
+    case JobCancelled:
+        return "отменена"
+    case JobParked:
+        return "отложена до сброса квоты"
+    }
+    return string(s)
+}
+
+// jobKey формирует ключ Redis состояния задачи.
+func jobKey(id string) string {
+    return jobKeyPrefix + id
+}
+
+// jobItemsKey формирует ключ Redis списка операций, примененных задачей.
+func jobItemsKey(id string) string {
+    return jobItemsKeyPrefix + id
+}
+
+// Job возвращает состояние задачи по ID.
+func (p *PubSubClient) Job(ctx context.Context, id string) (*Job, error) {
+    if p.redis == nil {
+        return nil, ErrJobNotFound
+    }
+    data, err := p.redis.Get(ctx, jobKey(id)).Result()
+    if err == redis.Nil {
+        return nil, ErrJobNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+    var job Job
+    if err := json.Unmarshal([]byte(data), &job); err != nil {
+        return nil, err
+    }
+    return &job, nil
+}
+
+// ChatJobs возвращает последние задачи чата, начиная с самой новой.
+func (p *PubSubClient) ChatJobs(ctx context.Context, chatID int64) ([]*Job, error) {
+    if p.redis == nil {
+        return nil, nil
+    }
+    ids, err := p.redis.LRange(ctx, fmt.Sprintf("%s%d", chatJobsKeyPrefix, chatID), 0, -1).Result()
+    if err != nil {
+        return nil, err
+    }
+    var jobs []*Job
+    for _, id := range ids {
+        job, err := p.Job(ctx, id)
+        if err == ErrJobNotFound {
+            continue
+        }
+        if err != nil {
+            return nil, err
+        }
+        jobs = append(jobs, job)
+    }
+    return jobs, nil
+}
+
+// enqueueJob создает состояние новой задачи или возвращает существующую (повтор) в очередь.
+func (p *PubSubClient) enqueueJob(ctx context.Context, task SyncTask) error {
+    if p.redis == nil {
+        return nil
+    }
+    created := false
+    err := p.modifyJob(ctx, task.JobID, func(job *Job) *Job {
+        created = job == nil
+        if created {
+            job = &Job{ID: task.JobID, Type: task.Type, ChatID: task.ChatID, CreatedAt: time.Now()}
+        }
+        job.Status = JobQueued
+        job.Attempt = task.Attempt
+        job.FinishedAt = nil
+        job.ResumeAt = nil
+        return job
+    })
+    if err == nil && created && task.ChatID != 0 {
+        key := fmt.Sprintf("%s%d", chatJobsKeyPrefix, task.ChatID)
+        p.redis.LPush(ctx, key, task.JobID)
+        p.redis.LTrim(ctx, key, 0, chatJobsLimit-1)
+        p.redis.Expire(ctx, key, jobTTL)
+    }
+    return err
+}
+
+// updateJob изменяет состояние задачи функцией fn. Ошибки Redis игнорируются:
+// состояние задачи носит справочный характер и не должно мешать ее выполнению.
+func (p *PubSubClient) updateJob(ctx context.Context, id string, fn func(job *Job)) {
+    if p.redis == nil || id == "" {
+        return
+    }
+    p.modifyJob(ctx, id, func(job *Job) *Job {
+        if job != nil {
+            fn(job)
+        }
+        return job
+    })
+}
+
+// modifyJob атомарно изменяет состояние задачи: fn получает текущее состояние (nil, если
+// задачи нет) и возвращает новое или nil, чтобы ничего не записывать. Ключ читается под WATCH:
+// если его изменил другой обработчик (например, CancelJob) до записи, fn вызывается заново
+// с актуальным состоянием, и запрос отмены не теряется.
+func (p *PubSubClient) modifyJob(ctx context.Context, id string, fn func(job *Job) *Job) error {
+    key := jobKey(id)
+    write := func(tx *redis.Tx) error {
+        var job *Job
+        data, err := tx.Get(ctx, key).Result()
+        if err != nil && err != redis.Nil {
+            return err
+        }
+        if err == nil {
+            job = &Job{}
+            if err := json.Unmarshal([]byte(data), job); err != nil {
+                return err
+            }
+        }
+        job = fn(job)
+        if job == nil {
+            return nil
+        }
+        job.UpdatedAt = time.Now()
+        updated, err := json.Marshal(job)
+        if err != nil {
+            return err
+        }
+        _, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+            pipe.Set(ctx, key, updated, jobTTL)
+            return nil
+        })
+        return err
+    }
+    for i := 0; i < jobWriteRetries; i++ {
+        err := p.redis.Watch(ctx, write, key)
+        if err != redis.TxFailedErr {
+            return err
+        }
+    }
+    return errors.New("не удалось сохранить состояние задачи: ключ одновременно изменяется")
+}
+
+// setJobStatus переводит задачу в состояние status; для завершенных задач запоминает время
+// завершения и ошибку. Отмененная задача остается отмененной.
+func (p *PubSubClient) setJobStatus(ctx context.Context, task SyncTask, status JobStatus, jobErr error) {
+    p.updateJob(ctx, task.JobID, func(job *Job) {
+        if job.Status == JobCancelled && status != JobCancelled {
+            return
+        }
+        now := time.Now()
+        job.Status = status
+        job.Attempt = task.Attempt
+        if status == JobRunning {
+            job.StartedAt = &now
+        }
+        if job.Finished() {
+            job.FinishedAt = &now
+        }
+        if jobErr != nil {
+            job.Error = jobErr.Error()
+        } else if status == JobSucceeded {
+            job.Error = ""
+        }
+    })
+}
+
+// recordProgress сохраняет ход выполнения задачи: счетчики — в ее состоянии, а операции,
+// примененные после уже сохраненных recorded, — в отдельный список (см. JobItems), чтобы
+// состояние задачи не переписывалось со всеми операциями при каждом обновлении.
+// Возвращает число сохраненных операций.
+func (p *PubSubClient) recordProgress(ctx context.Context, id string, pr sync.Progress, recorded int) int {
+    if p.redis == nil || id == "" {
+        return recorded
+    }
+    if len(pr.Items) > recorded {
+        values := make([]interface{}, 0, len(pr.Items)-recorded)
+        for _, item := range pr.Items[recorded:] {
+            data, err := json.Marshal(item)
+            if err != nil {
+                continue
+            }
+            values = append(values, data)
+        }
+        key := jobItemsKey(id)
+        if err := p.redis.RPush(ctx, key, values...).Err(); err == nil {
+            p.redis.Expire(ctx, key, jobTTL)
+            recorded = len(pr.Items)
+        }
+    }
+    pr.Items = nil
+    p.updateJob(ctx, id, func(job *Job) { job.Progress = pr })
+    return recorded
+}
+
+// resetJobItems удаляет операции, сохраненные предыдущей попыткой задачи.
+func (p *PubSubClient) resetJobItems(ctx context.Context, id string) {
+    if p.redis != nil && id != "" {
+        p.redis.Del(ctx, jobItemsKey(id))
+    }
+}
+
+// JobItems возвращает операции, примененные последней попыткой задачи, в порядке выполнения.
+func (p *PubSubClient) JobItems(ctx context.Context, id string) ([]sync.AppliedItem, error) {
+    if p.redis == nil {
+        return nil, nil
+    }
+    values, err := p.redis.LRange(ctx, jobItemsKey(id), 0, -1).Result()
+    if err != nil {
+        return nil, err
+    }
+    items := make([]sync.AppliedItem, 0, len(values))
+    for _, v := range values {
+        var item sync.AppliedItem
+        if err := json.Unmarshal([]byte(v), &item); err != nil {
+            continue
+        }
+        items = append(items, item)
+    }
+    return items, nil
+}
+
+// JobHandler обслуживает /jobs/{id}: GET возвращает состояние задачи с примененными операциями
+// в JSON, DELETE отменяет задачу (см. CancelJob). Обработчик подключается через auth.Require:
+// пользователь работает только со своими задачами, администратор — с задачами всех пользователей.
+func (p *PubSubClient) JobHandler(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    identity := auth.FromContext(ctx)
+    if identity == nil {
+        http.Error(w, auth.ErrUnauthorized.Error(), http.StatusUnauthorized)
+        return
+    }
+    id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs"), "/")
+    if id == "" || strings.Contains(id, "/") {
+        http.Error(w, "Укажите ID задачи: /jobs/{id}", 404)
+        return
+    }
+    if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+        http.Error(w, "Метод не поддерживается", 405)
+        return
+    }
+    job, err := p.Job(ctx, id)
+    if err == nil && !identity.CanAccess(job.ChatID) {
+        // Чужая задача не отличается от несуществующей.
+        err = ErrJobNotFound
+    }
+    if err == nil && r.Method == http.MethodGet {
+        job.Progress.Items, err = p.JobItems(ctx, id)
+    }
+    if err == nil && r.Method == http.MethodDelete {
+        job, err = p.CancelJob(ctx, id)
+        if err == ErrJobFinished {
+            http.Error(w, err.Error(), 409)
+            return
+        }
+    }
+    if err == ErrJobNotFound {
+        http.Error(w, err.Error(), 404)
+        return
+    }
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Ошибка чтения задачи: %v", err), 500)
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(job)
+}
+
+// newID генерирует короткий случайный идентификатор задачи.
+func newID() (string, error) {
+    b := make([]byte, 6)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(b), nil
+}
\ No newline at end of file
@@ -0,0 +1,96 @@
+// pkg/pubsub/park.go
+package pubsub
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "strconv"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+
+    "github.com/Clean1ines/scps/pkg/logging"
+    "github.com/Clean1ines/scps/pkg/sync"
+)
+
+const (
+    // parkedTasksKey — sorted set Redis с отложенными задачами (до сброса квоты или до повтора,
+    // см. retryTask): задача в JSON -> время возобновления (Unix).
+    parkedTasksKey = "scps_parked_tasks"
+    // parkedPollInterval — период проверки отложенных задач, время возобновления которых наступило.
+    parkedPollInterval = 5 * time.Second
+)
+
+// parkTask откладывает задачу до resumeAt (сброс квоты сервиса): задача не считается неудачной
+// и не расходует попытки, а после возобновления использует результаты поиска из контрольной точки.
+func (p *PubSubClient) parkTask(ctx context.Context, logger *logging.Logger, redisClient *redis.Client, task SyncTask, resumeAt time.Time, taskErr error) bool {
+    data, err := json.Marshal(task)
+    if err == nil && p.redis != nil {
+        err = p.redis.ZAdd(ctx, parkedTasksKey, &redis.Z{Score: float64(resumeAt.Unix()), Member: data}).Err()
+    }
+    if err != nil || p.redis == nil {
+        logger.Errorf("Не удалось отложить задачу %s: %v", task.JobID, err)
+        return p.deadLetter(ctx, logger, redisClient, task, taskErr)
+    }
+    logger.Infof("Задача %s отложена до %s: %v", task.JobID, resumeAt.Format(time.RFC3339), taskErr)
+    p.updateJob(ctx, task.JobID, func(job *Job) {
+        job.Status = JobParked
+        job.Error = taskErr.Error()
+        job.ResumeAt = &resumeAt
+    })
+    p.notify(task.ChatID, fmt.Sprintf("Исчерпана суточная квота API. Синхронизация продолжится автоматически после %s.", resumeAt.Local().Format("02.01 15:04")))
+    return true
+}
+
+// resumeParked до отмены ctx возвращает в очередь отложенные задачи, время возобновления
+// которых наступило. Задачу забирает из множества только один экземпляр сервиса; возобновленная
+// задача читает плейлисты заново.
+func (p *PubSubClient) resumeParked(ctx context.Context, logger *logging.Logger) {
+    if p.redis == nil {
+        return
+    }
+    ticker := time.NewTicker(parkedPollInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+        members, err := p.redis.ZRangeByScore(ctx, parkedTasksKey, &redis.ZRangeBy{
+            Min: "-inf",
+            Max: strconv.FormatInt(time.Now().Unix(), 10),
+        }).Result()
+        if err != nil {
+            logger.Errorf("Ошибка чтения отложенных задач: %v", err)
+            continue
+        }
+        for _, member := range members {
+            if removed, err := p.redis.ZRem(ctx, parkedTasksKey, member).Result(); err != nil || removed == 0 {
+                continue
+            }
+            var task SyncTask
+            if err := json.Unmarshal([]byte(member), &task); err != nil {
+                logger.Errorf("Некорректная отложенная задача %q: %v", member, err)
+                continue
+            }
+            if p.cancelRequested(ctx, task.JobID) {
+                // Отложенная задача отменяется сразу при запросе отмены (см. CancelJob).
+                continue
+            }
+            // За время ожидания плейлисты могли измениться: прочитанные страницы сбрасываются,
+            // результаты поиска и журнал примененных изменений сохраняются.
+            if err := sync.ResetPageCursors(ctx, p.redis, task.JobID); err != nil {
+                logger.Errorf("Ошибка сброса прочитанных страниц задачи %s: %v", task.JobID, err)
+            }
+            if _, err := p.PublishTask(ctx, task); err != nil {
+                logger.Errorf("Ошибка возобновления задачи %s: %v", task.JobID, err)
+                // Задача возвращается в множество и будет возобновлена при следующей проверке.
+                p.redis.ZAdd(ctx, parkedTasksKey, &redis.Z{Score: float64(time.Now().Unix()), Member: member})
+                continue
+            }
+            logger.Infof("Задача %s возвращена в очередь (попытка %d)", task.JobID, task.Attempt+1)
+        }
+    }
+}
\ No newline at end of file
@@ -5,74 +5,193 @@ import (
     "context"
     "encoding/json"
     "fmt"
+    gosync "sync"
     "time"
 
-    "cloud.google.com/go/pubsub"
-    "github.com/Clean1ines/scps/pkg/logging"
     "github.com/go-redis/redis/v8"
+
+    "github.com/Clean1ines/scps/pkg/api"
+    "github.com/Clean1ines/scps/pkg/sync"
 )
 
-// PubSubClient оборачивает клиента Pub/Sub и хранит ссылку на Redis.
+// PubSubClient публикует задачи в очередь и хранит ссылку на Redis. Бэкенд очереди
+// (Cloud Pub/Sub, Redis Streams или память процесса) выбирается в NewPubSubClient.
 type PubSubClient struct {
-    client    *pubsub.Client
-    topic     *pubsub.Topic
-    sub       *pubsub.Subscription
-    projectID string
-    redis     *redis.Client
+    queue    Queue
+    redis    *redis.Client
+    mu       gosync.RWMutex
+    notifier Notifier                      // Получатель уведомлений о завершении задач (см. SetNotifier)
+    retry    RetryPolicy                   // Повторы задач, завершившихся ошибкой (см. SetRetryPolicy)
+    running  map[string]context.CancelFunc // Отмена задач, выполняющихся в этом процессе (см. CancelJob)
 }
 
-// NewPubSubClient создает и инициализирует клиента Pub/Sub.
+// NewPubSubClient создает клиента очереди задач с бэкендом из QUEUE_BACKEND
+// ("pubsub" по умолчанию, "redis", "memory").
 func NewPubSubClient(ctx context.Context, projectID string, redisClient *redis.Client) (*PubSubClient, error) {
-    client, err := pubsub.NewClient(ctx, projectID)
+    queue, err := NewQueue(ctx, queueBackendFromEnv(), projectID, redisClient)
     if err != nil {
         return nil, err
     }
-    topic := client.Topic("scps_tasks")
-    sub := client.Subscription("scps_tasks_sub")
+    return NewClientWithQueue(queue, redisClient), nil
+}
+
+// NewClientWithQueue создает клиента поверх готовой очереди.
+func NewClientWithQueue(queue Queue, redisClient *redis.Client) *PubSubClient {
     return &PubSubClient{
-        client:    client,
-        topic:     topic,
-        sub:       sub,
-        projectID: projectID,
-        redis:     redisClient,
-    }, nil
+        queue: queue,
+        redis: redisClient,
+        retry: DefaultRetryPolicy(),
+    }
+}
+
+// Close закрывает очередь задач.
+func (p *PubSubClient) Close() error {
+    return p.queue.Close()
 }
 
 // SyncTask описывает задачу синхронизации плейлистов.
 type SyncTask struct {
-    Type              string `json:"type"`
-    SpotifyPlaylistID string `json:"spotify_playlist_id"`
-    YouTubePlaylistID string `json:"youtube_playlist_id"`
-    ChatID            int64  `json:"chat_id"`
+    Type              string              `json:"type"`
+    SpotifyPlaylistID string              `json:"spotify_playlist_id"`
+    YouTubePlaylistID string              `json:"youtube_playlist_id"`
+    ChatID            int64               `json:"chat_id"`
+    SourcePlatform    string              `json:"source_platform,omitempty"` // Платформа источника; по умолчанию "spotify"
+    Direction         sync.Direction      `json:"direction,omitempty"`       // Направление относительно источника; по умолчанию двустороннее
+    Deletions         sync.DeletionPolicy `json:"deletions,omitempty"`       // Обработка удаленных треков; по умолчанию "ask"
+    PreserveOrder     bool                `json:"preserve_order,omitempty"`  // Синхронизировать порядок треков
+    Attempt           int                 `json:"attempt,omitempty"`         // Номер попытки выполнения, начиная с нуля
+    JobID             string              `json:"job_id,omitempty"`          // ID задачи для отслеживания состояния (см. Job)
+}
+
+// NewSyncTask формирует задачу синхронизации пары pair от имени пользователя chatID.
+func NewSyncTask(chatID int64, pair sync.Pair) SyncTask {
+    task := SyncTask{
+        Type:           TaskTypeSyncPlaylist,
+        ChatID:         chatID,
+        SourcePlatform: pair.SourcePlatform,
+        Direction:      pair.Direction,
+        Deletions:      pair.Deletions,
+        PreserveOrder:  pair.PreserveOrder,
+    }
+    for _, p := range [][2]string{{pair.SourcePlatform, pair.SourcePlaylistID}, {pair.TargetPlatform, pair.TargetPlaylistID}} {
+        switch p[0] {
+        case api.PlatformSpotify:
+            task.SpotifyPlaylistID = p[1]
+        case api.PlatformYouTube:
+            task.YouTubePlaylistID = p[1]
+        }
+    }
+    return task
+}
+
+// Pair возвращает синхронизируемую пару плейлистов задачи.
+func (t SyncTask) Pair() (sync.Pair, error) {
+    direction, err := sync.ParseDirection(string(t.Direction))
+    if err != nil {
+        return sync.Pair{}, err
+    }
+    deletions, err := sync.ParseDeletionPolicy(string(t.Deletions))
+    if err != nil {
+        return sync.Pair{}, err
+    }
+    pair := sync.Pair{
+        SourcePlatform:   api.PlatformSpotify,
+        SourcePlaylistID: t.SpotifyPlaylistID,
+        TargetPlatform:   api.PlatformYouTube,
+        TargetPlaylistID: t.YouTubePlaylistID,
+        Direction:        direction,
+        Deletions:        deletions,
+        PreserveOrder:    t.PreserveOrder,
+    }
+    switch t.SourcePlatform {
+    case "", api.PlatformSpotify:
+    case api.PlatformYouTube:
+        pair.SourcePlatform, pair.TargetPlatform = pair.TargetPlatform, pair.SourcePlatform
+        pair.SourcePlaylistID, pair.TargetPlaylistID = pair.TargetPlaylistID, pair.SourcePlaylistID
+    default:
+        return sync.Pair{}, fmt.Errorf("неизвестная платформа источника: %q", t.SourcePlatform)
+    }
+    return pair, nil
 }
 
-// PublishTask публикует задачу в Pub/Sub.
-func (p *PubSubClient) PublishTask(ctx context.Context, task SyncTask) error {
+// PublishTask публикует задачу в очередь и возвращает ее ID. Новой задаче назначается ID
+// и создается состояние "queued" (см. Job); при повторной публикации ID сохраняется.
+func (p *PubSubClient) PublishTask(ctx context.Context, task SyncTask) (string, error) {
+    if task.JobID == "" {
+        id, err := newID()
+        if err != nil {
+            return "", err
+        }
+        task.JobID = id
+    }
     data, err := json.Marshal(task)
     if err != nil {
-        return err
+        return "", err
+    }
+    if err := p.enqueueJob(ctx, task); err != nil {
+        return "", err
     }
-    result := p.topic.Publish(ctx, &pubsub.Message{Data: data})
-    _, err = result.Get(ctx)
-    return err
+    if err := p.queue.Publish(ctx, data); err != nil {
+        p.setJobStatus(ctx, task, JobFailed, err)
+        return "", err
+    }
+    return task.JobID, nil
+}
+
+// EnqueueSync публикует задачу синхронизации пары pair пользователя chatID и возвращает ее ID
+// (реализует sync.JobQueue для HTTP API).
+func (p *PubSubClient) EnqueueSync(ctx context.Context, chatID int64, pair sync.Pair) (string, error) {
+    return p.PublishTask(ctx, NewSyncTask(chatID, pair))
+}
+
+const (
+    // reportErrorsLimit и reportMatchesLimit ограничивают число последних ошибок и соответствий
+    // в отчете: отчет обновляется при каждой синхронизации и иначе растет без ограничений.
+    reportErrorsLimit  = 20
+    reportMatchesLimit = 50
+)
+
+// SyncReport — накопительный отчет о синхронизациях пользователя.
+type SyncReport struct {
+    SuccessCount int            `json:"success_count"`
+    Errors       []string       `json:"errors"`            // Последние ошибки (не больше reportErrorsLimit)
+    Added        map[string]int `json:"added,omitempty"`   // Платформа -> число добавленных треков
+    Matches      []string       `json:"matches,omitempty"` // Последние найденные соответствия с объяснением оценки
 }
 
 // updateSyncReport обновляет отчет синхронизации в Redis для пользователя.
-func updateSyncReport(ctx context.Context, r *redis.Client, chatID int64, success bool, errMsg string) {
+func updateSyncReport(ctx context.Context, r *redis.Client, chatID int64, plan *sync.Plan, syncErr error) {
     key := fmt.Sprintf("sync_report_%d", chatID)
-    var report struct {
-        SuccessCount int      `json:"success_count"`
-        Errors       []string `json:"errors"`
-    }
+    var report SyncReport
     data, err := r.Get(ctx, key).Result()
     if err == nil {
         json.Unmarshal([]byte(data), &report)
     }
-    if success {
+    if syncErr == nil {
         report.SuccessCount++
     } else {
-        report.Errors = append(report.Errors, errMsg)
+        report.Errors = append(report.Errors, syncErr.Error())
     }
+    if plan != nil && syncErr == nil {
+        if report.Added == nil {
+            report.Added = map[string]int{}
+        }
+        report.Added[plan.Pair.SourcePlatform] += len(plan.AddToSource)
+        report.Added[plan.Pair.TargetPlatform] += len(plan.AddToTarget)
+        for _, m := range append(plan.ResolvedOnTarget, plan.ResolvedOnSource...) {
+            report.Matches = append(report.Matches, fmt.Sprintf("%s → %s: %s", m.Source, m.Match, m.Explanation))
+        }
+    }
+    report.Errors = lastStrings(report.Errors, reportErrorsLimit)
+    report.Matches = lastStrings(report.Matches, reportMatchesLimit)
     newData, _ := json.Marshal(report)
     r.Set(ctx, key, newData, 24*time.Hour)
+}
+
+// lastStrings возвращает не больше n последних элементов list.
+func lastStrings(list []string, n int) []string {
+    if len(list) > n {
+        return list[len(list)-n:]
+    }
+    return list
 }
\ No newline at end of file
@@ -0,0 +1,57 @@
+// pkg/pubsub/queue.go
+package pubsub
+
+import (
+    "context"
+    "fmt"
+    "os"
+
+    "github.com/go-redis/redis/v8"
+)
+
+const (
+    // taskTopic и taskSubscription — имена топика и подписки (группы потребителей) задач.
+    taskTopic        = "scps_tasks"
+    taskSubscription = "scps_tasks_sub"
+)
+
+// Бэкенды очереди задач, выбираемые переменной окружения QUEUE_BACKEND.
+const (
+    QueueBackendPubSub = "pubsub" // Google Cloud Pub/Sub (по умолчанию)
+    QueueBackendRedis  = "redis"  // Redis Streams с группой потребителей
+    QueueBackendMemory = "memory" // Очередь в памяти процесса для разработки и тестов
+)
+
+// HandlerFunc обрабатывает полученное сообщение. Возвращает true, если сообщение нужно
+// подтвердить, и false, если его нужно доставить повторно.
+type HandlerFunc func(ctx context.Context, data []byte) bool
+
+// Queue абстрагирует брокер задач, через который бот передает задачи обработчикам.
+type Queue interface {
+    // Publish помещает сообщение в очередь.
+    Publish(ctx context.Context, data []byte) error
+    // Receive получает сообщения и передает их handler, обрабатывая до concurrency сообщений
+    // одновременно. Блокируется до отмены ctx или ошибки брокера.
+    Receive(ctx context.Context, concurrency int, handler HandlerFunc) error
+    // Close освобождает ресурсы очереди.
+    Close() error
+}
+
+// NewQueue создает очередь задач выбранного бэкенда.
+func NewQueue(ctx context.Context, backend, projectID string, redisClient *redis.Client) (Queue, error) {
+    switch backend {
+    case "", QueueBackendPubSub:
+        return newCloudQueue(ctx, projectID)
+    case QueueBackendRedis:
+        return newRedisQueue(ctx, redisClient)
+    case QueueBackendMemory:
+        return NewMemoryQueue(), nil
+    default:
+        return nil, fmt.Errorf("неизвестный бэкенд очереди: %q", backend)
+    }
+}
+
+// queueBackendFromEnv читает бэкенд очереди из QUEUE_BACKEND.
+func queueBackendFromEnv() string {
+    return os.Getenv("QUEUE_BACKEND")
+}
@@ -0,0 +1,55 @@
+// pkg/pubsub/queue_cloud.go
+package pubsub
+
+import (
+    "context"
+
+    "cloud.google.com/go/pubsub"
+)
+
+// cloudQueue — очередь задач в Google Cloud Pub/Sub.
+type cloudQueue struct {
+    client *pubsub.Client
+    topic  *pubsub.Topic
+    sub    *pubsub.Subscription
+}
+
+// newCloudQueue подключается к топику scps_tasks и подписке scps_tasks_sub проекта.
+func newCloudQueue(ctx context.Context, projectID string) (*cloudQueue, error) {
+    client, err := pubsub.NewClient(ctx, projectID)
+    if err != nil {
+        return nil, err
+    }
+    return &cloudQueue{
+        client: client,
+        topic:  client.Topic(taskTopic),
+        sub:    client.Subscription(taskSubscription),
+    }, nil
+}
+
+// Publish публикует сообщение и ждет подтверждения от Pub/Sub.
+func (q *cloudQueue) Publish(ctx context.Context, data []byte) error {
+    result := q.topic.Publish(ctx, &pubsub.Message{Data: data})
+    _, err := result.Get(ctx)
+    return err
+}
+
+// Receive получает сообщения подписки; число одновременно обрабатываемых сообщений
+// ограничивается через MaxOutstandingMessages.
+func (q *cloudQueue) Receive(ctx context.Context, concurrency int, handler HandlerFunc) error {
+    q.sub.ReceiveSettings.NumGoroutines = 1
+    q.sub.ReceiveSettings.MaxOutstandingMessages = concurrency
+    return q.sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+        if handler(ctx, msg.Data) {
+            msg.Ack()
+        } else {
+            msg.Nack()
+        }
+    })
+}
+
+// Close останавливает публикацию и закрывает клиента.
+func (q *cloudQueue) Close() error {
+    q.topic.Stop()
+    return q.client.Close()
+}
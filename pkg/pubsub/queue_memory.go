@@ -0,0 +1,73 @@
+// pkg/pubsub/queue_memory.go
+package pubsub
+
+import (
+    "context"
+    "errors"
+    gosync "sync"
+)
+
+// memoryQueueSize — емкость буфера очереди в памяти.
+const memoryQueueSize = 1024
+
+// MemoryQueue — очередь задач в памяти процесса. Неподтвержденные сообщения
+// возвращаются в конец очереди.
+type MemoryQueue struct {
+    messages  chan []byte
+    closed    chan struct{}
+    closeOnce gosync.Once
+}
+
+// NewMemoryQueue создает пустую очередь в памяти.
+func NewMemoryQueue() *MemoryQueue {
+    return &MemoryQueue{
+        messages: make(chan []byte, memoryQueueSize),
+        closed:   make(chan struct{}),
+    }
+}
+
+// Publish помещает сообщение в очередь; блокируется, если буфер заполнен.
+func (q *MemoryQueue) Publish(ctx context.Context, data []byte) error {
+    select {
+    case <-q.closed:
+        return errors.New("очередь закрыта")
+    case <-ctx.Done():
+        return ctx.Err()
+    case q.messages <- data:
+        return nil
+    }
+}
+
+// Receive обрабатывает сообщения в concurrency горутинах до отмены ctx или закрытия очереди.
+func (q *MemoryQueue) Receive(ctx context.Context, concurrency int, handler HandlerFunc) error {
+    if concurrency <= 0 {
+        concurrency = 1
+    }
+    var wg gosync.WaitGroup
+    for i := 0; i < concurrency; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for {
+                select {
+                case <-ctx.Done():
+                    return
+                case <-q.closed:
+                    return
+                case data := <-q.messages:
+                    if !handler(ctx, data) {
+                        q.Publish(ctx, data)
+                    }
+                }
+            }
+        }()
+    }
+    wg.Wait()
+    return nil
+}
+
+// Close прекращает получение сообщений.
+func (q *MemoryQueue) Close() error {
+    q.closeOnce.Do(func() { close(q.closed) })
+    return nil
+}
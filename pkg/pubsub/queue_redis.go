@@ -0,0 +1,173 @@
+// pkg/pubsub/queue_redis.go
+package pubsub
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "strings"
+    gosync "sync"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+const (
+    // redisBlockTimeout — время ожидания новых сообщений одним вызовом XREADGROUP.
+    redisBlockTimeout = 5 * time.Second
+    // redisClaimIdle — время, после которого сообщение, не подтвержденное упавшим обработчиком,
+    // забирается другим обработчиком. Работающий обработчик продлевает сообщение каждые
+    // redisHeartbeatInterval, поэтому долгая синхронизация не забирается.
+    redisClaimIdle = 5 * time.Minute
+    // redisHeartbeatInterval — период продления сообщения, которое обрабатывается.
+    redisHeartbeatInterval = time.Minute
+    // redisFinishTimeout — время на подтверждение или повторную публикацию сообщения после
+    // обработки, в том числе при остановке обработчиков.
+    redisFinishTimeout = 5 * time.Second
+    // redisDataField — поле записи потока с телом сообщения.
+    redisDataField = "data"
+)
+
+// redisQueue — очередь задач в Redis Streams: поток scps_tasks и группа потребителей scps_tasks_sub.
+type redisQueue struct {
+    client   *redis.Client
+    consumer string
+}
+
+// newRedisQueue создает группу потребителей (и поток, если его нет).
+func newRedisQueue(ctx context.Context, client *redis.Client) (*redisQueue, error) {
+    err := client.XGroupCreateMkStream(ctx, taskTopic, taskSubscription, "0").Err()
+    if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+        return nil, err
+    }
+    host, _ := os.Hostname()
+    return &redisQueue{
+        client:   client,
+        consumer: fmt.Sprintf("%s-%d", host, os.Getpid()),
+    }, nil
+}
+
+// Publish добавляет сообщение в поток.
+func (q *redisQueue) Publish(ctx context.Context, data []byte) error {
+    return q.client.XAdd(ctx, &redis.XAddArgs{
+        Stream: taskTopic,
+        Values: map[string]interface{}{redisDataField: data},
+    }).Err()
+}
+
+// Receive читает сообщения группы в concurrency горутинах. Подтвержденные сообщения удаляются
+// из потока, неподтвержденные публикуются заново. Сообщения, зависшие у упавших обработчиков
+// дольше redisClaimIdle, забираются в периоды простоя.
+func (q *redisQueue) Receive(ctx context.Context, concurrency int, handler HandlerFunc) error {
+    if concurrency <= 0 {
+        concurrency = 1
+    }
+    var wg gosync.WaitGroup
+    errs := make(chan error, concurrency)
+    for i := 0; i < concurrency; i++ {
+        wg.Add(1)
+        go func(consumer string) {
+            defer wg.Done()
+            for ctx.Err() == nil {
+                msgs, err := q.next(ctx, consumer)
+                if err != nil {
+                    if ctx.Err() == nil {
+                        errs <- err
+                    }
+                    return
+                }
+                for _, msg := range msgs {
+                    q.handle(ctx, consumer, msg, handler)
+                }
+            }
+        }(fmt.Sprintf("%s-%d", q.consumer, i))
+    }
+    wg.Wait()
+    close(errs)
+    return <-errs
+}
+
+// next возвращает новое сообщение группы или, если новых нет, зависшее сообщение.
+func (q *redisQueue) next(ctx context.Context, consumer string) ([]redis.XMessage, error) {
+    streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+        Group:    taskSubscription,
+        Consumer: consumer,
+        Streams:  []string{taskTopic, ">"},
+        Count:    1,
+        Block:    redisBlockTimeout,
+    }).Result()
+    if err != nil && err != redis.Nil {
+        return nil, err
+    }
+    if len(streams) > 0 && len(streams[0].Messages) > 0 {
+        return streams[0].Messages, nil
+    }
+    msgs, _, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+        Stream:   taskTopic,
+        Group:    taskSubscription,
+        Consumer: consumer,
+        MinIdle:  redisClaimIdle,
+        Start:    "0-0",
+        Count:    1,
+    }).Result()
+    if err == redis.Nil {
+        return nil, nil
+    }
+    return msgs, err
+}
+
+// handle передает сообщение обработчику и подтверждает его или публикует заново. Пока
+// обработчик работает, сообщение продлевается, чтобы его не забрал другой обработчик.
+func (q *redisQueue) handle(ctx context.Context, consumer string, msg redis.XMessage, handler HandlerFunc) {
+    data, _ := msg.Values[redisDataField].(string)
+    stop := q.heartbeat(ctx, consumer, msg.ID)
+    ok := handler(ctx, []byte(data))
+    stop()
+    // Контекст обработчиков отменяется при остановке, а результат обработки нужно сохранить.
+    finishCtx, cancel := context.WithTimeout(context.Background(), redisFinishTimeout)
+    defer cancel()
+    if !ok {
+        if err := q.Publish(finishCtx, []byte(data)); err != nil {
+            // Сообщение остается неподтвержденным и будет забрано после redisClaimIdle.
+            return
+        }
+    }
+    q.client.XAck(finishCtx, taskTopic, taskSubscription, msg.ID)
+    q.client.XDel(finishCtx, taskTopic, msg.ID)
+}
+
+// heartbeat каждые redisHeartbeatInterval сбрасывает время простоя сообщения id (XCLAIM JUSTID
+// тем же обработчиком) до вызова возвращаемой функции остановки.
+func (q *redisQueue) heartbeat(ctx context.Context, consumer, id string) func() {
+    done := make(chan struct{})
+    stopped := make(chan struct{})
+    go func() {
+        defer close(stopped)
+        ticker := time.NewTicker(redisHeartbeatInterval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-done:
+                return
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                q.client.XClaimJustID(ctx, &redis.XClaimArgs{
+                    Stream:   taskTopic,
+                    Group:    taskSubscription,
+                    Consumer: consumer,
+                    Messages: []string{id},
+                })
+            }
+        }
+    }()
+    return func() {
+        close(done)
+        <-stopped
+    }
+}
+
+// Close ничего не делает: клиент Redis принадлежит вызывающему коду.
+func (q *redisQueue) Close() error {
+    return nil
+}
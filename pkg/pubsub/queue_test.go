@@ -0,0 +1,219 @@
+// pkg/pubsub/queue_test.go
+package pubsub
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    gosync "sync"
+    "testing"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+
+    "github.com/Clean1ines/scps/pkg/api"
+    "github.com/Clean1ines/scps/pkg/auth"
+    "github.com/Clean1ines/scps/pkg/logging"
+    "github.com/Clean1ines/scps/pkg/sync"
+)
+
+func TestMemoryQueueRedeliversNacked(t *testing.T) {
+    q := NewMemoryQueue()
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if err := q.Publish(ctx, []byte("task")); err != nil {
+        t.Fatalf("Ошибка публикации: %v", err)
+    }
+    attempts := 0
+    done := make(chan struct{})
+    go q.Receive(ctx, 2, func(ctx context.Context, data []byte) bool {
+        attempts++
+        if attempts < 3 {
+            return false
+        }
+        close(done)
+        return true
+    })
+    select {
+    case <-done:
+    case <-ctx.Done():
+        t.Fatalf("Сообщение не доставлено повторно, попыток: %d", attempts)
+    }
+    q.Close()
+}
+
+// recordingNotifier запоминает отправленные уведомления.
+type recordingNotifier struct {
+    mu       gosync.Mutex
+    messages map[int64][]string
+}
+
+func (n *recordingNotifier) Notify(chatID int64, text string) {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    if n.messages == nil {
+        n.messages = map[int64][]string{}
+    }
+    n.messages[chatID] = append(n.messages[chatID], text)
+}
+
+func TestWorkersDispatchByType(t *testing.T) {
+    calls := make(chan SyncTask, 4)
+    failures := 1
+    RegisterHandler("test_task", func(ctx context.Context, redisClient *redis.Client, logger *logging.Logger, task SyncTask) (*sync.Plan, error) {
+        calls <- task
+        if failures > 0 {
+            failures--
+            return nil, errors.New("временная ошибка")
+        }
+        return nil, nil
+    })
+    client := NewClientWithQueue(NewMemoryQueue(), nil)
+    client.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond})
+    notifier := &recordingNotifier{}
+    client.SetNotifier(notifier)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    go StartWorkers(ctx, client, logging.NewStdLogger(), nil)
+
+    if _, err := client.PublishTask(ctx, SyncTask{Type: "unknown_task", ChatID: 7}); err != nil {
+        t.Fatalf("Ошибка публикации: %v", err)
+    }
+    jobID, err := client.PublishTask(ctx, SyncTask{Type: "test_task", SpotifyPlaylistID: "p1"})
+    if err != nil || jobID == "" {
+        t.Fatalf("Ошибка публикации: %v (ID задачи %q)", err, jobID)
+    }
+    // Первая попытка завершается ошибкой, задача должна быть опубликована повторно.
+    for i := 0; i < 2; i++ {
+        select {
+        case task := <-calls:
+            if task.SpotifyPlaylistID != "p1" || task.Attempt != i || task.JobID != jobID {
+                t.Fatalf("Неверная задача: %+v", task)
+            }
+        case <-ctx.Done():
+            t.Fatalf("Задача выполнена %d раз, ожидалось 2", i)
+        }
+    }
+    select {
+    case task := <-calls:
+        t.Fatalf("Лишний запуск задачи: %+v", task)
+    case <-time.After(100 * time.Millisecond):
+    }
+    notifier.mu.Lock()
+    if len(notifier.messages[7]) != 1 {
+        t.Errorf("Ожидалось уведомление о неизвестном типе задачи, получено: %v", notifier.messages)
+    }
+    notifier.mu.Unlock()
+    client.Close()
+}
+
+func TestRetryPolicy(t *testing.T) {
+    policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+    for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+        delay := policy.Backoff(attempt, errors.New("сетевая ошибка"))
+        if delay < max/2 || delay > max {
+            t.Errorf("Попытка %d: задержка %v вне [%v, %v]", attempt, delay, max/2, max)
+        }
+    }
+    rateLimited := &api.StatusError{StatusCode: 429, RetryAfter: time.Minute}
+    if delay := policy.Backoff(0, fmt.Errorf("не выполнено: %w", rateLimited)); delay != time.Minute {
+        t.Errorf("Retry-After не учтен: %v", delay)
+    }
+    excessive := &api.StatusError{StatusCode: 503, RetryAfter: 24 * time.Hour}
+    if delay := policy.Backoff(0, excessive); delay != defaultMaxRetryAfter {
+        t.Errorf("Retry-After не ограничен: %v", delay)
+    }
+    if !policy.ShouldRetry(1, rateLimited) || policy.ShouldRetry(2, rateLimited) {
+        t.Errorf("Неверное число попыток")
+    }
+    if policy.ShouldRetry(0, &api.StatusError{StatusCode: 404}) {
+        t.Errorf("Ответ 404 не должен повторяться")
+    }
+    if policy.ShouldRetry(0, Permanent(errors.New("неверная задача"))) {
+        t.Errorf("Неисправимая ошибка не должна повторяться")
+    }
+}
+
+func TestQuotaErrorParksUntilReset(t *testing.T) {
+    quota := fmt.Errorf("не выполнено: %w", &api.PartialError{Applied: 3, Err: &api.StatusError{StatusCode: 403, Reason: "quotaExceeded"}})
+    now := time.Date(2024, 3, 5, 20, 30, 0, 0, time.UTC) // 12:30 по тихоокеанскому времени
+    resumeAt, ok := api.QuotaResetAt(quota, now)
+    if !ok {
+        t.Fatalf("Исчерпание квоты не распознано")
+    }
+    if want := time.Date(2024, 3, 6, 8, 0, 0, 0, time.UTC); !resumeAt.Equal(want) {
+        t.Errorf("Время сброса квоты %v, ожидалось %v", resumeAt.UTC(), want)
+    }
+    if _, ok := api.QuotaResetAt(&api.StatusError{StatusCode: 403, Reason: "forbidden"}, now); ok {
+        t.Errorf("Запрет доступа принят за исчерпание квоты")
+    }
+    if DefaultRetryPolicy().ShouldRetry(0, quota) {
+        t.Errorf("Исчерпание квоты не должно повторяться до сброса")
+    }
+}
+
+func TestCancelRunningJob(t *testing.T) {
+    started := make(chan struct{})
+    RegisterHandler("blocking_task", func(ctx context.Context, redisClient *redis.Client, logger *logging.Logger, task SyncTask) (*sync.Plan, error) {
+        close(started)
+        <-ctx.Done()
+        return nil, ctx.Err()
+    })
+    client := NewClientWithQueue(NewMemoryQueue(), nil)
+    notifier := &recordingNotifier{}
+    client.SetNotifier(notifier)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    go StartWorkers(ctx, client, logging.NewStdLogger(), nil)
+
+    jobID, err := client.PublishTask(ctx, SyncTask{Type: "blocking_task", ChatID: 9})
+    if err != nil {
+        t.Fatalf("Ошибка публикации: %v", err)
+    }
+    select {
+    case <-started:
+    case <-ctx.Done():
+        t.Fatalf("Задача не запущена")
+    }
+    if _, err := client.CancelJob(ctx, jobID); err != nil {
+        t.Fatalf("Ошибка отмены: %v", err)
+    }
+    for ctx.Err() == nil {
+        notifier.mu.Lock()
+        messages := notifier.messages[9]
+        notifier.mu.Unlock()
+        if len(messages) > 0 {
+            if !strings.HasPrefix(messages[0], "Синхронизация отменена") {
+                t.Errorf("Неверное уведомление: %q", messages[0])
+            }
+            break
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+    if ctx.Err() != nil {
+        t.Fatalf("Нет уведомления об отмене")
+    }
+    if _, err := client.CancelJob(ctx, jobID); err != ErrJobNotFound {
+        t.Errorf("Повторная отмена завершенной задачи: %v", err)
+    }
+    client.Close()
+}
+
+func TestJobHandlerRequiresIdentity(t *testing.T) {
+    client := NewClientWithQueue(NewMemoryQueue(), nil)
+    defer client.Close()
+    w := httptest.NewRecorder()
+    client.JobHandler(w, httptest.NewRequest("GET", "/jobs/abc", nil))
+    if w.Code != http.StatusUnauthorized {
+        t.Errorf("Запрос без авторизации: статус %d, ожидался 401", w.Code)
+    }
+    req := httptest.NewRequest("DELETE", "/jobs/abc", nil)
+    w = httptest.NewRecorder()
+    client.JobHandler(w, req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{ChatID: 7})))
+    if w.Code != http.StatusNotFound {
+        t.Errorf("Отмена неизвестной задачи: статус %d, ожидался 404", w.Code)
+    }
+}
\ No newline at end of file
@@ -0,0 +1,116 @@
+// pkg/pubsub/retry.go
+package pubsub
+
+import (
+    "errors"
+    "math/rand"
+    "os"
+    "strconv"
+    "time"
+
+    "github.com/Clean1ines/scps/pkg/api"
+)
+
+const (
+    // defaultMaxAttempts — число попыток выполнения задачи, если TASK_MAX_ATTEMPTS не задан.
+    defaultMaxAttempts = 5
+    // defaultBaseDelay — задержка перед первым повтором.
+    defaultBaseDelay = 2 * time.Second
+    // defaultMaxDelay — верхняя граница задержки без учета Retry-After.
+    defaultMaxDelay = 5 * time.Minute
+    // defaultMaxRetryAfter — верхняя граница задержки, запрошенной сервисом в Retry-After.
+    defaultMaxRetryAfter = 30 * time.Minute
+)
+
+// RetryPolicy задает повторы задач, завершившихся временной ошибкой.
+type RetryPolicy struct {
+    MaxAttempts   int           // Число попыток, после которого задача попадает в хранилище недоставленных задач
+    BaseDelay     time.Duration // Задержка перед первым повтором; удваивается с каждой попыткой
+    MaxDelay      time.Duration // Верхняя граница задержки
+    MaxRetryAfter time.Duration // Верхняя граница задержки из Retry-After; 0 — defaultMaxRetryAfter
+}
+
+// DefaultRetryPolicy возвращает политику повторов по умолчанию; число попыток читается из TASK_MAX_ATTEMPTS.
+func DefaultRetryPolicy() RetryPolicy {
+    policy := RetryPolicy{
+        MaxAttempts:   defaultMaxAttempts,
+        BaseDelay:     defaultBaseDelay,
+        MaxDelay:      defaultMaxDelay,
+        MaxRetryAfter: defaultMaxRetryAfter,
+    }
+    if v, err := strconv.Atoi(os.Getenv("TASK_MAX_ATTEMPTS")); err == nil && v > 0 {
+        policy.MaxAttempts = v
+    }
+    return policy
+}
+
+// SetRetryPolicy задает политику повторов задач.
+func (p *PubSubClient) SetRetryPolicy(policy RetryPolicy) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.retry = policy
+}
+
+// retryPolicy возвращает текущую политику повторов.
+func (p *PubSubClient) retryPolicy() RetryPolicy {
+    p.mu.RLock()
+    defer p.mu.RUnlock()
+    return p.retry
+}
+
+// ShouldRetry сообщает, нужно ли повторить задачу после попытки attempt (с нуля), завершившейся ошибкой err.
+func (r RetryPolicy) ShouldRetry(attempt int, err error) bool {
+    return attempt+1 < r.MaxAttempts && !IsPermanent(err) && api.IsRetryable(err)
+}
+
+// Backoff возвращает задержку перед повтором после попытки attempt (с нуля): экспоненциальная
+// задержка BaseDelay*2^attempt, ограниченная MaxDelay, со случайной составляющей в ее второй
+// половине, чтобы повторы разных задач не совпадали. Если сервис указал в Retry-After больший
+// интервал, используется он, но не больше MaxRetryAfter: ошибочный или чрезмерный заголовок
+// не должен откладывать задачу на неопределенный срок.
+func (r RetryPolicy) Backoff(attempt int, err error) time.Duration {
+    delay := r.BaseDelay
+    for i := 0; i < attempt && delay < r.MaxDelay; i++ {
+        delay *= 2
+    }
+    if delay > r.MaxDelay {
+        delay = r.MaxDelay
+    }
+    if delay > 1 {
+        delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+    }
+    maxRetryAfter := r.MaxRetryAfter
+    if maxRetryAfter <= 0 {
+        maxRetryAfter = defaultMaxRetryAfter
+    }
+    if retryAfter := api.RetryAfter(err); retryAfter > delay {
+        delay = retryAfter
+        if delay > maxRetryAfter {
+            delay = maxRetryAfter
+        }
+    }
+    return delay
+}
+
+// permanentError — ошибка, повтор которой заведомо не поможет.
+type permanentError struct {
+    err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent помечает ошибку обработчика как неисправимую: задача сразу попадает
+// в хранилище недоставленных задач без повторов.
+func Permanent(err error) error {
+    if err == nil {
+        return nil
+    }
+    return &permanentError{err: err}
+}
+
+// IsPermanent сообщает, помечена ли ошибка через Permanent.
+func IsPermanent(err error) bool {
+    var p *permanentError
+    return errors.As(err, &p)
+}
\ No newline at end of file
@@ -0,0 +1,264 @@
+// pkg/pubsub/worker.go
+package pubsub
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "os"
+    "strconv"
+    gosync "sync"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+
+    "github.com/Clean1ines/scps/pkg/api"
+    "github.com/Clean1ines/scps/pkg/logging"
+    "github.com/Clean1ines/scps/pkg/sync"
+)
+
+const (
+    // TaskTypeSyncPlaylist — задача синхронизации пары плейлистов.
+    TaskTypeSyncPlaylist = "sync_playlist"
+    // defaultWorkerCount — число одновременно обрабатываемых задач, если WORKER_COUNT не задан.
+    defaultWorkerCount = 4
+)
+
+// TaskHandler выполняет задачу одного типа. Для задач синхронизации возвращает примененный план.
+type TaskHandler func(ctx context.Context, redisClient *redis.Client, logger *logging.Logger, task SyncTask) (*sync.Plan, error)
+
+// Notifier отправляет пользователю сообщение о результате задачи.
+type Notifier interface {
+    Notify(chatID int64, text string)
+}
+
+var (
+    handlersMu gosync.RWMutex
+    handlers   = map[string]TaskHandler{
+        TaskTypeSyncPlaylist: handleSyncPlaylist,
+    }
+)
+
+// RegisterHandler регистрирует обработчик задач типа taskType, заменяя существующий.
+func RegisterHandler(taskType string, h TaskHandler) {
+    handlersMu.Lock()
+    defer handlersMu.Unlock()
+    handlers[taskType] = h
+}
+
+// handlerFor возвращает обработчик задач типа taskType.
+func handlerFor(taskType string) (TaskHandler, bool) {
+    handlersMu.RLock()
+    defer handlersMu.RUnlock()
+    h, ok := handlers[taskType]
+    return h, ok
+}
+
+// SetNotifier задает получателя уведомлений о завершении задач (Telegram-бот).
+func (p *PubSubClient) SetNotifier(n Notifier) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.notifier = n
+}
+
+// notify отправляет уведомление, если получатель задан и задача пришла из чата.
+func (p *PubSubClient) notify(chatID int64, text string) {
+    p.mu.RLock()
+    n := p.notifier
+    p.mu.RUnlock()
+    if n != nil && chatID != 0 {
+        n.Notify(chatID, text)
+    }
+}
+
+// StartWorkers получает задачи из очереди (подписка scps_tasks_sub) и выполняет их пулом из
+// WORKER_COUNT обработчиков до отмены ctx. Задачи, завершившиеся временной ошибкой, публикуются
+// повторно с задержкой по политике повторов (см. RetryPolicy); после исчерпания попыток или при
+// неисправимой ошибке задача попадает в хранилище недоставленных задач (см. DeadLetters).
+// Задача, исчерпавшая суточную квоту сервиса, откладывается до ее сброса без расхода попыток.
+// Выполнение задачи, отмененной через CancelJob, прерывается отменой ее контекста.
+func StartWorkers(ctx context.Context, p *PubSubClient, logger *logging.Logger, redisClient *redis.Client) {
+    workers := workerCountFromEnv()
+    logger.Infof("Запуск обработчиков задач: %d", workers)
+    go p.watchCancellations(ctx, logger)
+    go p.resumeParked(ctx, logger)
+    err := p.queue.Receive(ctx, workers, func(ctx context.Context, data []byte) bool {
+        return p.handleMessage(ctx, logger, redisClient, data)
+    })
+    if err != nil {
+        logger.Errorf("Ошибка получения задач из очереди: %v", err)
+    }
+}
+
+// handleMessage разбирает и выполняет задачу. Возвращает false, если сообщение нужно вернуть
+// в очередь (не удалось запланировать повтор или сохранить задачу как недоставленную).
+func (p *PubSubClient) handleMessage(ctx context.Context, logger *logging.Logger, redisClient *redis.Client, data []byte) bool {
+    var task SyncTask
+    if err := json.Unmarshal(data, &task); err != nil {
+        // Повтор не поможет: сообщение подтверждается, чтобы не получать его снова.
+        logger.Errorf("Некорректная задача %q: %v", string(data), err)
+        return true
+    }
+    handler, ok := handlerFor(task.Type)
+    if !ok {
+        logger.Errorf("Неизвестный тип задачи: %q", task.Type)
+        p.setJobStatus(ctx, task, JobFailed, fmt.Errorf("неизвестный тип задачи: %s", task.Type))
+        p.notify(task.ChatID, fmt.Sprintf("Неизвестный тип задачи: %s", task.Type))
+        return true
+    }
+    if job, err := p.Job(ctx, task.JobID); err == nil && job.Finished() {
+        // Повторная доставка завершенной задачи (например, после сбоя до подтверждения сообщения)
+        // не должна выполнять ее снова; отмененная задача уже отмечена и пользователь уведомлен.
+        logger.Infof("Задача %s уже %s, повторная доставка пропущена", task.JobID, job.Status.Title())
+        return true
+    }
+    if p.cancelRequested(ctx, task.JobID) {
+        return p.cancelled(ctx, logger, task, sync.Progress{})
+    }
+    jobCtx, cancel := context.WithCancel(ctx)
+    defer cancel()
+    p.trackRunning(task.JobID, cancel)
+    defer p.untrackRunning(task.JobID)
+    // Отмена могла быть запрошена до регистрации задачи как выполняющейся.
+    if p.cancelRequested(ctx, task.JobID) {
+        cancel()
+    }
+    p.setJobStatus(ctx, task, JobRunning, nil)
+    p.resetJobItems(ctx, task.JobID)
+    var progress sync.Progress
+    recorded := 0
+    // Повторы задачи продолжают с контрольной точки и пропускают изменения плейлистов,
+    // записанные в журнал задачи предыдущими попытками.
+    syncCtx := sync.WithJob(jobCtx, task.JobID)
+    syncCtx = sync.WithProgress(syncCtx, func(pr sync.Progress) {
+        progress = pr
+        recorded = p.recordProgress(ctx, task.JobID, pr, recorded)
+    })
+    plan, err := handler(syncCtx, redisClient, logger, task)
+    if err != nil {
+        if ctx.Err() != nil {
+            // Обработчики останавливаются: задача возвращается в очередь и будет выполнена заново.
+            p.setJobStatus(context.Background(), task, JobQueued, nil)
+            return false
+        }
+        if jobCtx.Err() != nil {
+            return p.cancelled(ctx, logger, task, progress)
+        }
+        logger.Errorf("Ошибка выполнения задачи %s для чата %d (попытка %d): %v", task.Type, task.ChatID, task.Attempt+1, err)
+        if resumeAt, ok := api.QuotaResetAt(err, time.Now()); ok {
+            // Повторы до сброса квоты бесполезны: задача откладывается и продолжится с контрольной точки.
+            return p.parkTask(ctx, logger, redisClient, task, resumeAt, err)
+        }
+        if policy := p.retryPolicy(); policy.ShouldRetry(task.Attempt, err) {
+            return p.retryTask(ctx, logger, task, err, policy.Backoff(task.Attempt, err))
+        }
+        return p.deadLetter(ctx, logger, redisClient, task, err)
+    }
+    p.setJobStatus(ctx, task, JobSucceeded, nil)
+    if task.ChatID != 0 {
+        updateSyncReport(ctx, redisClient, task.ChatID, plan, nil)
+    }
+    p.notify(task.ChatID, completionText(plan))
+    return true
+}
+
+// retryTask планирует повтор задачи со следующим номером попытки через delay. Задача
+// сохраняется в множестве отложенных задач и возвращается в очередь по наступлении времени
+// повтора (см. resumeParked), а сообщение подтверждается сразу: ожидание не занимает
+// обработчик, и сообщение не будет забрано другим экземпляром как зависшее. Без Redis
+// повтор публикуется по таймеру процесса.
+func (p *PubSubClient) retryTask(ctx context.Context, logger *logging.Logger, task SyncTask, taskErr error, delay time.Duration) bool {
+    retryAt := time.Now().Add(delay)
+    logger.Infof("Повтор задачи %s для чата %d через %v", task.Type, task.ChatID, delay)
+    p.setJobStatus(ctx, task, JobQueued, taskErr)
+    task.Attempt++
+    if p.redis == nil {
+        time.AfterFunc(delay, func() {
+            if _, err := p.PublishTask(ctx, task); err != nil {
+                logger.Errorf("Ошибка публикации повтора задачи %s: %v", task.Type, err)
+            }
+        })
+        return true
+    }
+    data, err := json.Marshal(task)
+    if err == nil {
+        err = p.redis.ZAdd(ctx, parkedTasksKey, &redis.Z{Score: float64(retryAt.Unix()), Member: data}).Err()
+    }
+    if err != nil {
+        logger.Errorf("Ошибка планирования повтора задачи %s: %v", task.Type, err)
+        return false
+    }
+    p.updateJob(ctx, task.JobID, func(job *Job) { job.ResumeAt = &retryAt })
+    return true
+}
+
+// cancelled отмечает задачу отмененной и сообщает пользователю, какие изменения успели
+// примениться до отмены.
+func (p *PubSubClient) cancelled(ctx context.Context, logger *logging.Logger, task SyncTask, progress sync.Progress) bool {
+    logger.Infof("Задача %s для чата %d отменена, применено %d из %d", task.JobID, task.ChatID, progress.Applied, progress.Total)
+    p.setJobStatus(ctx, task, JobCancelled, nil)
+    text := "Синхронизация отменена."
+    if progress.Applied > 0 {
+        text += fmt.Sprintf("\nДо отмены применено изменений: %d из %d", progress.Applied, progress.Total)
+        if task.JobID != "" {
+            text += fmt.Sprintf("\nПодробности: /status %s", task.JobID)
+        }
+    }
+    p.notify(task.ChatID, text)
+    return true
+}
+
+// deadLetter сохраняет задачу как недоставленную и сообщает пользователю об ошибке.
+func (p *PubSubClient) deadLetter(ctx context.Context, logger *logging.Logger, redisClient *redis.Client, task SyncTask, taskErr error) bool {
+    p.setJobStatus(ctx, task, JobFailed, taskErr)
+    if task.ChatID != 0 {
+        updateSyncReport(ctx, redisClient, task.ChatID, nil, taskErr)
+    }
+    // Задача больше не повторяется: контрольная точка не нужна, а повторная публикация
+    // (см. ReplayDeadLetter) читает плейлисты заново.
+    if err := sync.DeleteCheckpoint(ctx, redisClient, task.JobID); err != nil {
+        logger.Errorf("Ошибка удаления контрольной точки задачи %s: %v", task.JobID, err)
+    }
+    dl, err := p.saveDeadLetter(ctx, task, taskErr)
+    if err != nil {
+        logger.Errorf("Ошибка сохранения недоставленной задачи %s: %v", task.Type, err)
+        p.notify(task.ChatID, fmt.Sprintf("Ошибка синхронизации: %v", taskErr))
+        return p.redis == nil
+    }
+    logger.Errorf("Задача %s перемещена в недоставленные (%s) после %d попыток", task.Type, dl.ID, dl.Attempts)
+    p.notify(task.ChatID, fmt.Sprintf("Ошибка синхронизации после %d попыток: %v\nПовторить: /replay %s", dl.Attempts, taskErr, dl.ID))
+    return true
+}
+
+// completionText формирует уведомление о завершенной синхронизации.
+func completionText(plan *sync.Plan) string {
+    text := "Синхронизация завершена.\n"
+    if plan != nil {
+        pair := plan.Pair
+        text += fmt.Sprintf("Добавлено на %s: %d, на %s: %d\n", pair.TargetPlatform, len(plan.AddToTarget), pair.SourcePlatform, len(plan.AddToSource))
+        if removed := len(plan.RemoveFromSource) + len(plan.RemoveFromTarget); removed > 0 {
+            text += fmt.Sprintf("Удалено: %d\n", removed)
+        }
+        if plan.HasPendingDeletions() {
+            text += "Есть удаления, ожидающие подтверждения.\n"
+        }
+    }
+    return text + "Подробности: /report"
+}
+
+// handleSyncPlaylist синхронизирует пару плейлистов из задачи.
+func handleSyncPlaylist(ctx context.Context, redisClient *redis.Client, logger *logging.Logger, task SyncTask) (*sync.Plan, error) {
+    pair, err := task.Pair()
+    if err != nil {
+        return nil, Permanent(err)
+    }
+    return sync.RunPairSync(sync.WithUser(ctx, task.ChatID), redisClient, sync.DefaultRegistry(redisClient, task.ChatID), pair, logger)
+}
+
+// workerCountFromEnv читает число обработчиков задач из WORKER_COUNT.
+func workerCountFromEnv() int {
+    if v, err := strconv.Atoi(os.Getenv("WORKER_COUNT")); err == nil && v > 0 {
+        return v
+    }
+    return defaultWorkerCount
+}
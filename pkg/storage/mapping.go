@@ -0,0 +1,158 @@
+// pkg/storage/mapping.go
+package storage
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+const (
+    // mappingKeyPrefix — префикс ключей общей таблицы соответствий, найденных автоматически.
+    mappingKeyPrefix = "track_map:"
+    // userMappingKeyPrefix — префикс ключей соответствий, исправленных пользователем:
+    // track_map_user:<chatID>:<платформа>:<ID>. Исправления действуют только для их автора.
+    userMappingKeyPrefix = "track_map_user:"
+    // mappingWriteRetries — число попыток записи соответствия при одновременном изменении ключей.
+    mappingWriteRetries = 5
+)
+
+// TrackMapping связывает один и тот же трек на разных платформах.
+type TrackMapping struct {
+    IDs        map[string]string `json:"ids"`            // Платформа ("spotify", "youtube") -> ID трека
+    ISRC       string            `json:"isrc,omitempty"` // Международный код записи, если известен
+    Confidence float64           `json:"confidence"`     // Оценка сходства, с которой найдено соответствие
+    Manual     bool              `json:"manual"`         // Соответствие задано или исправлено пользователем
+    UpdatedAt  int64             `json:"updated_at"`
+}
+
+// mappingKey формирует ключ соответствия для трека на платформе.
+func mappingKey(platform, id string) string {
+    return mappingKeyPrefix + platform + ":" + id
+}
+
+// userMappingKey формирует ключ соответствия, исправленного пользователем chatID.
+func userMappingKey(chatID int64, platform, id string) string {
+    return fmt.Sprintf("%s%d:%s:%s", userMappingKeyPrefix, chatID, platform, id)
+}
+
+// GetTrackMapping возвращает соответствие для трека на платформе или nil, если оно не сохранено.
+func GetTrackMapping(ctx context.Context, r *redis.Client, platform, id string) (*TrackMapping, error) {
+    return getMapping(ctx, r, mappingKey(platform, id))
+}
+
+// GetTrackMappingByISRC возвращает соответствие по коду ISRC или nil, если оно не сохранено.
+func GetTrackMappingByISRC(ctx context.Context, r *redis.Client, isrc string) (*TrackMapping, error) {
+    if isrc == "" {
+        return nil, nil
+    }
+    return GetTrackMapping(ctx, r, "isrc", isrc)
+}
+
+// FindTrackMapping возвращает соответствие трека id платформы platform для пользователя chatID:
+// сначала исправленное пользователем, затем из общей таблицы по ID и по коду ISRC.
+// Возвращает nil, если соответствие не найдено; chatID 0 означает только общую таблицу.
+func FindTrackMapping(ctx context.Context, r *redis.Client, chatID int64, platform, id, isrc string) (*TrackMapping, error) {
+    if chatID != 0 {
+        m, err := getMapping(ctx, r, userMappingKey(chatID, platform, id))
+        if err != nil || m != nil {
+            return m, err
+        }
+    }
+    m, err := GetTrackMapping(ctx, r, platform, id)
+    if err != nil || m != nil {
+        return m, err
+    }
+    return GetTrackMappingByISRC(ctx, r, isrc)
+}
+
+// SaveTrackMapping сохраняет найденное автоматически соответствие в общую таблицу под ключом
+// каждого из его ID.
+func SaveTrackMapping(ctx context.Context, r *redis.Client, m *TrackMapping) error {
+    m.Manual = false
+    return writeTrackMapping(ctx, r, m, func(platform, id string) string {
+        return mappingKey(platform, id)
+    })
+}
+
+// CorrectTrackMapping сохраняет соответствие, заданное пользователем chatID. Исправление
+// имеет приоритет над общей таблицей только для этого пользователя (см. FindTrackMapping).
+func CorrectTrackMapping(ctx context.Context, r *redis.Client, chatID int64, m *TrackMapping) error {
+    m.Manual = true
+    m.Confidence = 1
+    return writeTrackMapping(ctx, r, m, func(platform, id string) string {
+        return userMappingKey(chatID, platform, id)
+    })
+}
+
+// getMapping читает соответствие по ключу key или возвращает nil, если его нет.
+func getMapping(ctx context.Context, r redis.Cmdable, key string) (*TrackMapping, error) {
+    data, err := r.Get(ctx, key).Result()
+    if err == redis.Nil {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    var m TrackMapping
+    if err := json.Unmarshal([]byte(data), &m); err != nil {
+        return nil, err
+    }
+    return &m, nil
+}
+
+// writeTrackMapping записывает соответствие под ключами keyFor и удаляет ссылки на ID, которые
+// из него исчезли. Запись выполняется в транзакции с WATCH ключей соответствия: если ключ
+// изменен другим обработчиком после чтения, запись повторяется с актуальными данными.
+func writeTrackMapping(ctx context.Context, r *redis.Client, m *TrackMapping, keyFor func(platform, id string) string) error {
+    m.UpdatedAt = time.Now().Unix()
+    data, err := json.Marshal(m)
+    if err != nil {
+        return err
+    }
+    keys := []string{}
+    for platform, id := range m.IDs {
+        keys = append(keys, keyFor(platform, id))
+    }
+    if m.ISRC != "" {
+        keys = append(keys, keyFor("isrc", m.ISRC))
+    }
+    write := func(tx *redis.Tx) error {
+        stale := []string{}
+        for platform, id := range m.IDs {
+            existing, err := getMapping(ctx, tx, keyFor(platform, id))
+            if err != nil {
+                return err
+            }
+            if existing == nil {
+                continue
+            }
+            for p, oldID := range existing.IDs {
+                if newID, ok := m.IDs[p]; ok && newID != oldID {
+                    stale = append(stale, keyFor(p, oldID))
+                }
+            }
+        }
+        _, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+            for _, key := range stale {
+                pipe.Del(ctx, key)
+            }
+            for _, key := range keys {
+                pipe.Set(ctx, key, data, 0)
+            }
+            return nil
+        })
+        return err
+    }
+    for i := 0; i < mappingWriteRetries; i++ {
+        err := r.Watch(ctx, write, keys...)
+        if err != redis.TxFailedErr {
+            return err
+        }
+    }
+    return errors.New("не удалось сохранить соответствие: ключи одновременно изменяются")
+}
\ No newline at end of file
@@ -8,6 +8,9 @@ import (
     "github.com/go-redis/redis/v8"
 )
 
+// RedisClient — клиент Redis, используемый всеми модулями приложения.
+type RedisClient = redis.Client
+
 // NewRedisClient создает клиент Redis и проверяет соединение.
 func NewRedisClient(address string) (*redis.Client, error) {
     client := redis.NewClient(&redis.Options{
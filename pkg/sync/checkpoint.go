@@ -0,0 +1,236 @@
+// pkg/sync/checkpoint.go
+package sync
+
+import (
+    "context"
+    "encoding/json"
+    "sort"
+    "strconv"
+    "strings"
+    gosync "sync"
+
+    "github.com/Clean1ines/scps/pkg/api"
+    "github.com/Clean1ines/scps/pkg/logging"
+    "github.com/Clean1ines/scps/pkg/matching"
+    "github.com/Clean1ines/scps/pkg/storage"
+)
+
+const (
+    // checkpointKeyPrefix — префикс хэшей Redis с контрольными точками задач: sync_checkpoint:<ID задачи>.
+    checkpointKeyPrefix = "sync_checkpoint:"
+    // checkpointPagesKeyPrefix — префикс хэшей Redis с прочитанными страницами плейлистов задач:
+    // sync_checkpoint_pages:<ID задачи>, поле <платформа>:<ID плейлиста>:<номер страницы>.
+    checkpointPagesKeyPrefix = "sync_checkpoint_pages:"
+    // checkpointSearchPrefix — префикс полей контрольной точки с результатами поиска.
+    checkpointSearchPrefix = "search:"
+)
+
+// searchResult — результат поиска соответствия трека, сохраненный в контрольной точке.
+type searchResult struct {
+    Match  *api.Track           `json:"match,omitempty"` // nil — поиск ничего не нашел
+    Result matching.MatchResult `json:"result"`
+}
+
+// Checkpoint — промежуточные результаты синхронизации задачи: прочитанные страницы плейлистов
+// и результаты поиска соответствий. Задача, прерванная на середине (перезапуск экземпляра),
+// продолжает с места остановки, а примененные изменения плейлистов пропускаются по журналу
+// (см. Journal). Контрольная точка удаляется после успешной синхронизации и после окончательной
+// неудачи задачи; прочитанные страницы сбрасываются при возобновлении отложенной задачи
+// (см. ResetPageCursors), чтобы она не работала с устаревшим содержимым плейлистов.
+type Checkpoint struct {
+    ctx      context.Context
+    redis    *storage.RedisClient
+    key      string
+    pagesKey string
+    logger   *logging.Logger
+    mu       gosync.Mutex
+    pages    map[string]*api.PageCursor
+    counts   map[string]int // Число сохраненных страниц плейлиста
+    searches map[string]*searchResult
+}
+
+type checkpointKey struct{}
+
+// loadCheckpoint загружает контрольную точку задачи из контекста (см. WithJob) или возвращает
+// nil, если задача не задана.
+func loadCheckpoint(ctx context.Context, redisClient *storage.RedisClient, logger *logging.Logger) (*Checkpoint, error) {
+    jobID := jobIDFrom(ctx)
+    if jobID == "" || redisClient == nil {
+        return nil, nil
+    }
+    c := &Checkpoint{
+        ctx:      ctx,
+        redis:    redisClient,
+        key:      checkpointKeyPrefix + jobID,
+        pagesKey: checkpointPagesKeyPrefix + jobID,
+        logger:   logger,
+        pages:    map[string]*api.PageCursor{},
+        counts:   map[string]int{},
+        searches: map[string]*searchResult{},
+    }
+    fields, err := redisClient.HGetAll(ctx, c.key).Result()
+    if err != nil {
+        return nil, err
+    }
+    for field, value := range fields {
+        if strings.HasPrefix(field, checkpointSearchPrefix) {
+            var found searchResult
+            if json.Unmarshal([]byte(value), &found) == nil {
+                c.searches[strings.TrimPrefix(field, checkpointSearchPrefix)] = &found
+            }
+        }
+    }
+    pages, err := redisClient.HGetAll(ctx, c.pagesKey).Result()
+    if err != nil {
+        return nil, err
+    }
+    c.loadPages(pages)
+    if len(fields) > 0 || len(pages) > 0 {
+        logger.Infof("Задача %s продолжается с контрольной точки: страниц плейлистов %d, результатов поиска %d", jobID, len(pages), len(c.searches))
+    }
+    return c, nil
+}
+
+// loadPages собирает состояние чтения плейлистов из сохраненных страниц. Страницы плейлиста
+// применяются по порядку номеров; если страница пропущена, последующие не используются.
+func (c *Checkpoint) loadPages(fields map[string]string) {
+    byPlaylist := map[string]map[int]*api.Page{}
+    for field, value := range fields {
+        i := strings.LastIndex(field, ":")
+        if i < 0 {
+            continue
+        }
+        n, err := strconv.Atoi(field[i+1:])
+        if err != nil {
+            continue
+        }
+        var page api.Page
+        if json.Unmarshal([]byte(value), &page) != nil {
+            continue
+        }
+        playlist := field[:i]
+        if byPlaylist[playlist] == nil {
+            byPlaylist[playlist] = map[int]*api.Page{}
+        }
+        byPlaylist[playlist][n] = &page
+    }
+    for playlist, pages := range byPlaylist {
+        numbers := make([]int, 0, len(pages))
+        for n := range pages {
+            numbers = append(numbers, n)
+        }
+        sort.Ints(numbers)
+        cursor := &api.PageCursor{}
+        count := 0
+        for _, n := range numbers {
+            if n != count {
+                break
+            }
+            cursor.Apply(pages[n])
+            count++
+        }
+        if count > 0 {
+            c.pages[playlist] = cursor
+            c.counts[playlist] = count
+        }
+    }
+}
+
+// attach возвращает контекст, при синхронизации с которым используется контрольная точка.
+func (c *Checkpoint) attach(ctx context.Context) context.Context {
+    return api.WithPageCheckpointer(context.WithValue(ctx, checkpointKey{}, c), c)
+}
+
+// checkpointFrom возвращает контрольную точку из контекста или nil.
+func checkpointFrom(ctx context.Context) *Checkpoint {
+    c, _ := ctx.Value(checkpointKey{}).(*Checkpoint)
+    return c
+}
+
+// LoadCursor возвращает копию сохраненного состояния чтения плейлиста (реализует api.PageCheckpointer).
+func (c *Checkpoint) LoadCursor(platform, playlistID string) *api.PageCursor {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    cursor := c.pages[platform+":"+playlistID]
+    if cursor == nil || cursor.List == nil {
+        return nil
+    }
+    list := *cursor.List
+    list.Tracks = append([]api.Track{}, cursor.List.Tracks...)
+    return &api.PageCursor{List: &list, Next: cursor.Next, Read: cursor.Read, Done: cursor.Done}
+}
+
+// SavePage сохраняет очередную страницу плейлиста отдельным полем, не перезаписывая
+// прочитанные ранее (реализует api.PageCheckpointer).
+func (c *Checkpoint) SavePage(platform, playlistID string, page *api.Page) {
+    playlist := platform + ":" + playlistID
+    c.mu.Lock()
+    cursor := c.pages[playlist]
+    if cursor == nil {
+        cursor = &api.PageCursor{}
+        c.pages[playlist] = cursor
+    }
+    cursor.Apply(page)
+    n := c.counts[playlist]
+    c.counts[playlist] = n + 1
+    c.mu.Unlock()
+    c.save(c.pagesKey, playlist+":"+strconv.Itoa(n), page)
+}
+
+// search возвращает сохраненный результат поиска соответствия трека. Nil-точка пуста.
+func (c *Checkpoint) search(fromPlatform, trackID, toPlatform string) (*searchResult, bool) {
+    if c == nil {
+        return nil, false
+    }
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    found, ok := c.searches[fromPlatform+":"+trackID+":"+toPlatform]
+    return found, ok
+}
+
+// saveSearch сохраняет результат поиска соответствия трека.
+func (c *Checkpoint) saveSearch(fromPlatform, trackID, toPlatform string, found *searchResult) {
+    if c == nil {
+        return
+    }
+    key := fromPlatform + ":" + trackID + ":" + toPlatform
+    c.mu.Lock()
+    c.searches[key] = found
+    c.mu.Unlock()
+    c.save(c.key, checkpointSearchPrefix+key, found)
+}
+
+// save записывает поле field хэша key контрольной точки. Ошибки только логируются: без
+// контрольной точки задача выполнится заново целиком.
+func (c *Checkpoint) save(key, field string, value interface{}) {
+    data, err := json.Marshal(value)
+    if err == nil {
+        pipe := c.redis.TxPipeline()
+        pipe.HSet(c.ctx, key, field, data)
+        pipe.Expire(c.ctx, key, journalTTL)
+        _, err = pipe.Exec(c.ctx)
+    }
+    if err != nil && c.ctx.Err() == nil {
+        c.logger.Errorf("Ошибка сохранения контрольной точки %s: %v", key, err)
+    }
+}
+
+// ResetPageCursors удаляет прочитанные страницы плейлистов из контрольной точки задачи jobID.
+// Вызывается перед возобновлением отложенной или повторной публикацией недоставленной задачи:
+// плейлисты за это время могли измениться, и их нужно прочитать заново. Результаты поиска
+// соответствий сохраняются.
+func ResetPageCursors(ctx context.Context, redisClient *storage.RedisClient, jobID string) error {
+    if redisClient == nil || jobID == "" {
+        return nil
+    }
+    return redisClient.Del(ctx, checkpointPagesKeyPrefix+jobID).Err()
+}
+
+// DeleteCheckpoint удаляет контрольную точку задачи jobID после успешной синхронизации
+// или окончательной неудачи задачи.
+func DeleteCheckpoint(ctx context.Context, redisClient *storage.RedisClient, jobID string) error {
+    if redisClient == nil || jobID == "" {
+        return nil
+    }
+    return redisClient.Del(ctx, checkpointKeyPrefix+jobID, checkpointPagesKeyPrefix+jobID).Err()
+}
\ No newline at end of file
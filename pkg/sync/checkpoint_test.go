@@ -0,0 +1,56 @@
+// pkg/sync/checkpoint_test.go
+package sync
+
+import (
+    "encoding/json"
+    "testing"
+
+    "github.com/Clean1ines/scps/pkg/api"
+)
+
+func TestCheckpointAssemblesPages(t *testing.T) {
+    page := func(next string, done bool, ids ...string) string {
+        p := api.Page{Total: 5, Next: next, Done: done}
+        for _, id := range ids {
+            p.Tracks = append(p.Tracks, api.Track{ID: id})
+        }
+        data, _ := json.Marshal(p)
+        return string(data)
+    }
+    c := &Checkpoint{pages: map[string]*api.PageCursor{}, counts: map[string]int{}}
+    c.loadPages(map[string]string{
+        "spotify:p1:1": page("n2", false, "t3", "t4"),
+        "spotify:p1:0": page("n1", false, "t1", "t2"),
+        // Страница 1 плейлиста p2 не сохранилась: страница 2 не используется
+        "youtube:p2:0": page("y1", false, "v1"),
+        "youtube:p2:2": page("", true, "v3"),
+    })
+    check := func(platform, playlistID, next string, want ...string) {
+        cursor := c.LoadCursor(platform, playlistID)
+        if cursor == nil {
+            t.Fatalf("Нет состояния чтения %s:%s", platform, playlistID)
+        }
+        ids := []string{}
+        for _, track := range cursor.List.Tracks {
+            ids = append(ids, track.ID)
+        }
+        if len(ids) != len(want) || cursor.Next != next || cursor.Done {
+            t.Fatalf("%s:%s: треки %v, next %q; ожидались %v, next %q", platform, playlistID, ids, cursor.Next, want, next)
+        }
+        for i := range want {
+            if ids[i] != want[i] {
+                t.Fatalf("%s:%s: треки %v, ожидались %v", platform, playlistID, ids, want)
+            }
+        }
+    }
+    check(api.PlatformSpotify, "p1", "n2", "t1", "t2", "t3", "t4")
+    check(api.PlatformYouTube, "p2", "y1", "v1")
+    if c.counts["youtube:p2"] != 1 {
+        t.Errorf("Следующая страница p2 должна сохраниться под номером 1, получено %d", c.counts["youtube:p2"])
+    }
+
+    // Изменение возвращенного состояния не затрагивает контрольную точку.
+    cursor := c.LoadCursor(api.PlatformSpotify, "p1")
+    cursor.List.Tracks = append(cursor.List.Tracks, api.Track{ID: "t5"})
+    check(api.PlatformSpotify, "p1", "n2", "t1", "t2", "t3", "t4")
+}
\ No newline at end of file
@@ -0,0 +1,50 @@
+// pkg/sync/direction.go
+package sync
+
+import "fmt"
+
+// Direction задает направление синхронизации пары плейлистов.
+type Direction string
+
+const (
+    // DirectionSourceToTarget — треки источника добавляются в целевой плейлист, источник не меняется.
+    DirectionSourceToTarget Direction = "source_to_target"
+    // DirectionTargetToSource — треки целевого плейлиста добавляются в источник, цель не меняется.
+    DirectionTargetToSource Direction = "target_to_source"
+    // DirectionBidirectional — оба плейлиста дополняются до объединения.
+    DirectionBidirectional Direction = "bidirectional"
+)
+
+// ParseDirection разбирает направление синхронизации; пустая строка означает двустороннюю синхронизацию.
+func ParseDirection(s string) (Direction, error) {
+    switch d := Direction(s); d {
+    case "":
+        return DirectionBidirectional, nil
+    case DirectionSourceToTarget, DirectionTargetToSource, DirectionBidirectional:
+        return d, nil
+    default:
+        return "", fmt.Errorf("неизвестное направление синхронизации: %q", s)
+    }
+}
+
+// ToTarget сообщает, добавляются ли треки в целевой плейлист.
+func (d Direction) ToTarget() bool {
+    return d != DirectionTargetToSource
+}
+
+// ToSource сообщает, добавляются ли треки в исходный плейлист.
+func (d Direction) ToSource() bool {
+    return d != DirectionSourceToTarget
+}
+
+// Arrow возвращает обозначение направления для сообщений: "->", "<-" или "<->".
+func (d Direction) Arrow() string {
+    switch d {
+    case DirectionSourceToTarget:
+        return "->"
+    case DirectionTargetToSource:
+        return "<-"
+    default:
+        return "<->"
+    }
+}
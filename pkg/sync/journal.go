@@ -0,0 +1,86 @@
+// pkg/sync/journal.go
+package sync
+
+import (
+    "context"
+    "time"
+
+    "github.com/Clean1ines/scps/pkg/storage"
+)
+
+const (
+    // journalKeyPrefix — префикс хэшей Redis с журналом операций задачи: sync_journal:<ID задачи>.
+    journalKeyPrefix = "sync_journal:"
+    // journalTTL — время хранения журнала; должно превышать время жизни задачи с повторами.
+    journalTTL = 7 * 24 * time.Hour
+)
+
+// Journal — журнал операций над плейлистами, примененных в рамках одной задачи. Повторное
+// или возобновленное выполнение задачи пропускает операции, уже записанные в журнал, поэтому
+// итоговые плейлисты не зависят от числа запусков. Операция записывается после успешного
+// ответа сервиса; если процесс упадет между ответом и записью, операция будет повторена.
+type Journal struct {
+    redis *storage.RedisClient
+    key   string
+    done  map[string]bool
+}
+
+type jobKey struct{}
+
+// WithJob возвращает контекст синхронизации в рамках задачи jobID: операции над плейлистами
+// записываются в журнал задачи, а прочитанные страницы и результаты поиска — в ее контрольную
+// точку (см. Checkpoint). Пустой jobID отключает журнал и контрольные точки.
+func WithJob(ctx context.Context, jobID string) context.Context {
+    return context.WithValue(ctx, jobKey{}, jobID)
+}
+
+// jobIDFrom возвращает ID задачи из контекста или "".
+func jobIDFrom(ctx context.Context) string {
+    jobID, _ := ctx.Value(jobKey{}).(string)
+    return jobID
+}
+
+// loadJournal загружает журнал задачи из контекста или возвращает nil, если задача не задана.
+func loadJournal(ctx context.Context, redisClient *storage.RedisClient) (*Journal, error) {
+    jobID := jobIDFrom(ctx)
+    if jobID == "" || redisClient == nil {
+        return nil, nil
+    }
+    j := &Journal{redis: redisClient, key: journalKeyPrefix + jobID, done: map[string]bool{}}
+    entries, err := redisClient.HKeys(ctx, j.key).Result()
+    if err != nil {
+        return nil, err
+    }
+    for _, e := range entries {
+        j.done[e] = true
+    }
+    return j, nil
+}
+
+// journalEntry формирует ключ операции в журнале.
+func journalEntry(operation, platform, playlistID, trackID string) string {
+    return operation + ":" + platform + ":" + playlistID + ":" + trackID
+}
+
+// Applied сообщает, записана ли операция в журнал. Nil-журнал не содержит операций.
+func (j *Journal) Applied(operation, platform, playlistID, trackID string) bool {
+    return j != nil && j.done[journalEntry(operation, platform, playlistID, trackID)]
+}
+
+// Record записывает примененные операции над треками с ID trackIDs.
+func (j *Journal) Record(ctx context.Context, operation, platform, playlistID string, trackIDs []string) error {
+    if j == nil || len(trackIDs) == 0 {
+        return nil
+    }
+    values := make([]interface{}, 0, 2*len(trackIDs))
+    for _, id := range trackIDs {
+        entry := journalEntry(operation, platform, playlistID, id)
+        j.done[entry] = true
+        values = append(values, entry, time.Now().Unix())
+    }
+    pipe := j.redis.TxPipeline()
+    pipe.HSet(ctx, j.key, values...)
+    pipe.Expire(ctx, j.key, journalTTL)
+    _, err := pipe.Exec(ctx)
+    return err
+}
\ No newline at end of file
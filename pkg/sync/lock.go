@@ -0,0 +1,232 @@
+// pkg/sync/lock.go
+package sync
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "sort"
+    gosync "sync"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+
+    "github.com/Clean1ines/scps/pkg/logging"
+    "github.com/Clean1ines/scps/pkg/storage"
+)
+
+const (
+    // lockKeyPrefix — префикс ключей блокировок пар плейлистов.
+    lockKeyPrefix = "sync_lock:"
+    // fenceKeyPrefix — префикс счетчиков fencing-токенов пар плейлистов.
+    fenceKeyPrefix = "sync_fence:"
+    // lockLease — срок аренды блокировки; продлевается, пока синхронизация выполняется.
+    lockLease = 30 * time.Second
+    // lockRenewInterval — период продления аренды.
+    lockRenewInterval = 10 * time.Second
+    // lockWaitTimeout — максимальное время ожидания блокировки в режиме LockWait.
+    lockWaitTimeout = 2 * time.Minute
+    // lockPollInterval — период повторных попыток захвата блокировки в режиме LockWait.
+    lockPollInterval = time.Second
+)
+
+var (
+    // ErrPairLocked возвращается, если пара плейлистов уже синхронизируется.
+    ErrPairLocked = errors.New("синхронизация этой пары плейлистов уже выполняется")
+    // ErrLeaseLost возвращается, если аренда блокировки истекла во время синхронизации
+    // (например, из-за недоступности Redis) и изменения плейлистов остановлены.
+    ErrLeaseLost = errors.New("блокировка пары плейлистов потеряна, синхронизация остановлена")
+)
+
+// LockMode определяет поведение синхронизации, если пара плейлистов уже синхронизируется.
+type LockMode string
+
+const (
+    // LockWait — дождаться завершения текущей синхронизации (не дольше lockWaitTimeout).
+    LockWait LockMode = "wait"
+    // LockReject — сразу вернуть ErrPairLocked.
+    LockReject LockMode = "reject"
+    // LockCoalesce — пропустить синхронизацию: выполняющаяся синхронизация сделает ту же работу.
+    LockCoalesce LockMode = "coalesce"
+)
+
+// acquireScript захватывает блокировку и выдает следующий fencing-токен.
+var acquireScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+    return redis.call("INCR", KEYS[2])
+end
+return 0`)
+
+// renewScript продлевает аренду, если блокировка все еще принадлежит владельцу токена.
+var renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+    return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseScript снимает блокировку, если она принадлежит владельцу токена.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+    return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// fencedSetScript записывает значение, только если fencing-токен не меньше токена последней записи.
+var fencedSetScript = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[2]) or "0")
+if tonumber(ARGV[2]) < current then
+    return 0
+end
+redis.call("SET", KEYS[1], ARGV[1])
+redis.call("SET", KEYS[2], ARGV[2])
+return 1`)
+
+// Lease — захваченная блокировка пары плейлистов. Fence монотонно растет с каждым захватом
+// и защищает сохранение снимка от записи синхронизацией, потерявшей блокировку.
+type Lease struct {
+    Fence int64
+
+    redis  *storage.RedisClient
+    key    string
+    token  string
+    mu     gosync.Mutex
+    lost   bool
+    cancel context.CancelFunc
+    done   chan struct{}
+}
+
+type leaseKey struct{}
+type lockModeKey struct{}
+
+// WithLockMode возвращает контекст, при синхронизации с которым занятая пара плейлистов
+// обрабатывается в режиме mode. По умолчанию используется LockWait.
+func WithLockMode(ctx context.Context, mode LockMode) context.Context {
+    return context.WithValue(ctx, lockModeKey{}, mode)
+}
+
+// lockModeFrom возвращает режим блокировки из контекста.
+func lockModeFrom(ctx context.Context) LockMode {
+    if mode, ok := ctx.Value(lockModeKey{}).(LockMode); ok {
+        return mode
+    }
+    return LockWait
+}
+
+// leaseFrom возвращает блокировку, под которой выполняется синхронизация, или nil.
+func leaseFrom(ctx context.Context) *Lease {
+    lease, _ := ctx.Value(leaseKey{}).(*Lease)
+    return lease
+}
+
+// pairLockKey формирует ключ блокировки пары, не зависящий от того, какой плейлист источник.
+func pairLockKey(pair Pair) string {
+    ends := []string{pair.SourcePlatform + ":" + pair.SourcePlaylistID, pair.TargetPlatform + ":" + pair.TargetPlaylistID}
+    sort.Strings(ends)
+    return ends[0] + "|" + ends[1]
+}
+
+// lockPair захватывает блокировку пары в режиме из контекста и запускает продление аренды.
+// Возвращает контекст синхронизации, который отменяется при потере блокировки. Если пара
+// занята, возвращает ErrPairLocked (в режиме LockWait — по истечении lockWaitTimeout).
+func lockPair(ctx context.Context, redisClient *storage.RedisClient, pair Pair, logger *logging.Logger) (context.Context, *Lease, error) {
+    token, err := newLockToken()
+    if err != nil {
+        return nil, nil, err
+    }
+    key := pairLockKey(pair)
+    lease := &Lease{redis: redisClient, key: lockKeyPrefix + key, token: token, done: make(chan struct{})}
+    mode := lockModeFrom(ctx)
+    deadline := time.Now().Add(lockWaitTimeout)
+    for {
+        fence, err := acquireScript.Run(ctx, redisClient, []string{lease.key, fenceKeyPrefix + key}, token, lockLease.Milliseconds()).Int64()
+        if err != nil {
+            return nil, nil, fmt.Errorf("ошибка захвата блокировки пары: %w", err)
+        }
+        if fence > 0 {
+            lease.Fence = fence
+            break
+        }
+        if mode != LockWait || time.Now().After(deadline) {
+            return nil, nil, ErrPairLocked
+        }
+        select {
+        case <-ctx.Done():
+            return nil, nil, ctx.Err()
+        case <-time.After(lockPollInterval):
+        }
+    }
+    lockCtx, cancel := context.WithCancel(context.WithValue(ctx, leaseKey{}, lease))
+    lease.cancel = cancel
+    go lease.keepAlive(lockCtx, logger)
+    return lockCtx, lease, nil
+}
+
+// keepAlive продлевает аренду до освобождения блокировки. Если продлить не удалось,
+// блокировка считается потерянной и контекст синхронизации отменяется.
+func (l *Lease) keepAlive(ctx context.Context, logger *logging.Logger) {
+    defer close(l.done)
+    ticker := time.NewTicker(lockRenewInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            renewed, err := renewScript.Run(ctx, l.redis, []string{l.key}, l.token, lockLease.Milliseconds()).Int64()
+            if ctx.Err() != nil {
+                return
+            }
+            if err != nil || renewed == 0 {
+                logger.Errorf("Не удалось продлить блокировку %s: %v", l.key, err)
+                l.mu.Lock()
+                l.lost = true
+                l.mu.Unlock()
+                l.cancel()
+                return
+            }
+        }
+    }
+}
+
+// Lost сообщает, потеряна ли блокировка.
+func (l *Lease) Lost() bool {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return l.lost
+}
+
+// Release останавливает продление аренды и снимает блокировку.
+func (l *Lease) Release(ctx context.Context) {
+    l.cancel()
+    <-l.done
+    releaseScript.Run(ctx, l.redis, []string{l.key}, l.token)
+}
+
+// fencedSet сохраняет значение key с проверкой fencing-токена блокировки из контекста: запись
+// синхронизации, чья блокировка уже перешла к другой, отклоняется. Без блокировки значение
+// сохраняется без проверки.
+func fencedSet(ctx context.Context, redisClient *storage.RedisClient, key string, value []byte) error {
+    lease := leaseFrom(ctx)
+    if lease == nil {
+        return redisClient.Set(ctx, key, value, 0).Err()
+    }
+    ok, err := fencedSetScript.Run(ctx, redisClient, []string{key, key + ":fence"}, value, lease.Fence).Int64()
+    if err != nil {
+        return err
+    }
+    if ok == 0 {
+        return ErrLeaseLost
+    }
+    return nil
+}
+
+// newLockToken генерирует случайный идентификатор владельца блокировки.
+func newLockToken() (string, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(b), nil
+}
\ No newline at end of file
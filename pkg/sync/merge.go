@@ -0,0 +1,204 @@
+// pkg/sync/merge.go
+package sync
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+
+    "github.com/Clean1ines/scps/pkg/api"
+    "github.com/Clean1ines/scps/pkg/logging"
+    "github.com/Clean1ines/scps/pkg/matching"
+    "github.com/Clean1ines/scps/pkg/storage"
+)
+
+// snapshotKeyPrefix — префикс ключей снимков плейлистов после последней успешной синхронизации.
+const snapshotKeyPrefix = "sync_snapshot:"
+
+// DeletionPolicy определяет, как обрабатываются треки, удаленные с одной стороны после прошлой синхронизации.
+type DeletionPolicy string
+
+const (
+    // DeletionPropagate — трек удаляется и с другой стороны.
+    DeletionPropagate DeletionPolicy = "propagate"
+    // DeletionIgnore — удаление не учитывается: трек снова добавляется из другого плейлиста.
+    DeletionIgnore DeletionPolicy = "ignore"
+    // DeletionAsk — трек не добавляется обратно и не удаляется, пока пользователь не подтвердит удаление.
+    DeletionAsk DeletionPolicy = "ask"
+)
+
+// ParseDeletionPolicy разбирает политику удаления; пустая строка означает DeletionAsk.
+func ParseDeletionPolicy(s string) (DeletionPolicy, error) {
+    switch p := DeletionPolicy(s); p {
+    case "":
+        return DeletionAsk, nil
+    case DeletionPropagate, DeletionIgnore, DeletionAsk:
+        return p, nil
+    default:
+        return "", fmt.Errorf("неизвестная политика удаления: %q", s)
+    }
+}
+
+// Snapshot — состояние обоих плейлистов пары после последней успешной синхронизации.
+type Snapshot struct {
+    Source    []api.Track `json:"source"`
+    Target    []api.Track `json:"target"`
+    CreatedAt int64       `json:"created_at"`
+}
+
+// snapshotKey формирует ключ снимка для пары плейлистов.
+func snapshotKey(pair Pair) string {
+    return fmt.Sprintf("%s%s:%s:%s:%s", snapshotKeyPrefix, pair.SourcePlatform, pair.SourcePlaylistID, pair.TargetPlatform, pair.TargetPlaylistID)
+}
+
+// loadSnapshot возвращает снимок пары или nil, если пара еще не синхронизировалась.
+func loadSnapshot(ctx context.Context, redisClient *storage.RedisClient, pair Pair) (*Snapshot, error) {
+    data, err := redisClient.Get(ctx, snapshotKey(pair)).Result()
+    if err == redis.Nil {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    var s Snapshot
+    if err := json.Unmarshal([]byte(data), &s); err != nil {
+        return nil, err
+    }
+    return &s, nil
+}
+
+// saveSnapshot сохраняет снимок пары без срока жизни. Снимок синхронизации, потерявшей
+// блокировку пары, не сохраняется (см. fencedSet).
+func saveSnapshot(ctx context.Context, redisClient *storage.RedisClient, pair Pair, s *Snapshot) error {
+    s.CreatedAt = time.Now().Unix()
+    data, err := json.Marshal(s)
+    if err != nil {
+        return err
+    }
+    return fencedSet(ctx, redisClient, snapshotKey(pair), data)
+}
+
+// deletedSince возвращает треки снимка, которых больше нет в плейлисте.
+func deletedSince(snapshot, current []api.Track) []api.Track {
+    present := trackIDs(current)
+    deleted := []api.Track{}
+    for _, t := range snapshot {
+        if !present[t.ID] {
+            deleted = append(deleted, t)
+        }
+    }
+    return deleted
+}
+
+// mappingLookup возвращает сохраненное соответствие трека платформы platform или nil.
+type mappingLookup func(platform string, track api.Track) (*storage.TrackMapping, error)
+
+// mergeResult — результат трехстороннего сравнения плейлистов пары со снимком прошлой синхронизации.
+type mergeResult struct {
+    fromSource, fromTarget             []api.Track // Треки, которые можно добавить на другую сторону
+    removeFromSource, removeFromTarget []api.Track // Удаления, распространяемые с другой стороны
+    pendingOnSource, pendingOnTarget   []api.Track // Удаления, ожидающие подтверждения пользователя
+    keptOnSource, keptOnTarget         []api.Track // Похожие на удаленные треки: не удаляются и не добавляются обратно
+    deletedSource, deletedTarget       []api.Track // Удаленные треки, которые остаются в снимке
+}
+
+// mergeSnapshot сравнивает плейлисты source и target пары со снимком snapshot и распределяет
+// треки, удаленные с одной из сторон, согласно pair.Deletions. Удаление распространяется только
+// на трек с тем же ID или связанный с удаленным через таблицу соответствий: трек, найденный
+// нечетким сравнением, может оказаться другой записью, поэтому он не удаляется, а только
+// не добавляется обратно. Без снимка или с политикой DeletionIgnore удаления не учитываются.
+func mergeSnapshot(snapshot *Snapshot, pair Pair, source, target []api.Track, lookup mappingLookup, logger *logging.Logger) *mergeResult {
+    m := &mergeResult{fromSource: source, fromTarget: target}
+    if snapshot == nil || pair.Deletions == DeletionIgnore {
+        return m
+    }
+    deletedSource := deletedSince(snapshot.Source, source)
+    inTarget, similarInTarget := counterparts(pair.SourcePlatform, deletedSource, pair.TargetPlatform, target, lookup, logger)
+    m.fromTarget = withoutTracks(withoutTracks(target, inTarget), similarInTarget)
+    m.keptOnTarget = similarInTarget
+    if pair.Deletions == DeletionPropagate && pair.Direction.ToTarget() {
+        m.removeFromTarget = inTarget
+    } else {
+        m.pendingOnTarget = inTarget
+    }
+    if len(m.pendingOnTarget)+len(m.keptOnTarget) > 0 {
+        m.deletedSource = deletedSource
+    }
+    deletedTarget := deletedSince(snapshot.Target, target)
+    inSource, similarInSource := counterparts(pair.TargetPlatform, deletedTarget, pair.SourcePlatform, source, lookup, logger)
+    m.fromSource = withoutTracks(withoutTracks(source, inSource), similarInSource)
+    m.keptOnSource = similarInSource
+    if pair.Deletions == DeletionPropagate && pair.Direction.ToSource() {
+        m.removeFromSource = inSource
+    } else {
+        m.pendingOnSource = inSource
+    }
+    if len(m.pendingOnSource)+len(m.keptOnSource) > 0 {
+        m.deletedTarget = deletedTarget
+    }
+    return m
+}
+
+// counterparts находит в плейлисте other треки, соответствующие удаленным трекам платформы
+// fromPlatform. Возвращает треки с тем же ID или связанные через таблицу соответствий и,
+// отдельно, треки, найденные только нечетким сравнением.
+func counterparts(fromPlatform string, deleted []api.Track, otherPlatform string, other []api.Track, lookup mappingLookup, logger *logging.Logger) ([]api.Track, []api.Track) {
+    byID := map[string]api.Track{}
+    for _, t := range other {
+        byID[t.ID] = t
+    }
+    found := map[string]bool{}
+    collect := func(result []api.Track, id string) []api.Track {
+        if t, ok := byID[id]; ok && !found[id] {
+            found[id] = true
+            result = append(result, t)
+        }
+        return result
+    }
+    exact := []api.Track{}
+    unmapped := []api.Track{}
+    for _, track := range deleted {
+        if _, ok := byID[track.ID]; ok {
+            exact = collect(exact, track.ID)
+            continue
+        }
+        m, err := lookup(fromPlatform, track)
+        if err != nil {
+            logger.Errorf("Ошибка чтения соответствия %s:%s: %v", fromPlatform, track.ID, err)
+        }
+        if m != nil && m.IDs[otherPlatform] != "" {
+            exact = collect(exact, m.IDs[otherPlatform])
+            continue
+        }
+        unmapped = append(unmapped, track)
+    }
+    similar := []api.Track{}
+    for _, p := range matching.Diff(convertToMetadata(fromPlatform, unmapped), convertToMetadata(otherPlatform, other)).Matches {
+        similar = collect(similar, p.Target.ID)
+    }
+    return exact, similar
+}
+
+// withoutTracks возвращает треки, не входящие в exclude.
+func withoutTracks(tracks, exclude []api.Track) []api.Track {
+    excluded := trackIDs(exclude)
+    result := []api.Track{}
+    for _, t := range tracks {
+        if !excluded[t.ID] {
+            result = append(result, t)
+        }
+    }
+    return result
+}
+
+// trackIDs возвращает множество ID треков.
+func trackIDs(tracks []api.Track) map[string]bool {
+    ids := map[string]bool{}
+    for _, t := range tracks {
+        ids[t.ID] = true
+    }
+    return ids
+}
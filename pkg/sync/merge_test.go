@@ -0,0 +1,153 @@
+// pkg/sync/merge_test.go
+package sync
+
+import (
+    "reflect"
+    "testing"
+
+    "github.com/Clean1ines/scps/pkg/api"
+    "github.com/Clean1ines/scps/pkg/logging"
+    "github.com/Clean1ines/scps/pkg/storage"
+)
+
+func TestMergeSnapshot(t *testing.T) {
+    s1 := api.Track{ID: "s1", Name: "First Song", Artist: "Alpha"}
+    s2 := api.Track{ID: "s2", Name: "Second Song", Artist: "Beta"}
+    s3 := api.Track{ID: "s3", Name: "Third Song", Artist: "Gamma"}
+    y1 := api.Track{ID: "y1", Name: "Alpha - First Song", Artist: "Alpha"}
+    y2 := api.Track{ID: "y2", Name: "Beta - Second Song", Artist: "Beta"}
+    y3 := api.Track{ID: "y3", Name: "Gamma - Third Song", Artist: "Gamma"} // Похож на s3, но не связан с ним
+    mappings := map[string]string{"spotify:s1": "y1", "spotify:s2": "y2", "youtube:y1": "s1", "youtube:y2": "s2"}
+    lookup := func(platform string, track api.Track) (*storage.TrackMapping, error) {
+        other, ok := mappings[platform+":"+track.ID]
+        if !ok {
+            return nil, nil
+        }
+        ids := map[string]string{platform: track.ID}
+        if platform == api.PlatformSpotify {
+            ids[api.PlatformYouTube] = other
+        } else {
+            ids[api.PlatformSpotify] = other
+        }
+        return &storage.TrackMapping{IDs: ids}, nil
+    }
+    snapshot := &Snapshot{Source: []api.Track{s1, s2, s3}, Target: []api.Track{y1, y2, y3}}
+
+    tests := []struct {
+        name             string
+        snapshot         *Snapshot
+        deletions        DeletionPolicy
+        direction        Direction
+        source, target   []api.Track
+        removeFromSource []string
+        removeFromTarget []string
+        pendingOnSource  []string
+        pendingOnTarget  []string
+        keptOnTarget     []string
+        fromSource       []string
+        fromTarget       []string
+    }{
+        {
+            name:       "без снимка удаления не учитываются",
+            deletions:  DeletionPropagate,
+            source:     []api.Track{s2},
+            target:     []api.Track{y1, y2},
+            fromSource: []string{"s2"},
+            fromTarget: []string{"y1", "y2"},
+        },
+        {
+            name:             "удаление в источнике распространяется по соответствию",
+            snapshot:         snapshot,
+            deletions:        DeletionPropagate,
+            source:           []api.Track{s2, s3},
+            target:           []api.Track{y1, y2, y3},
+            removeFromTarget: []string{"y1"},
+            fromSource:       []string{"s2", "s3"},
+            fromTarget:       []string{"y2", "y3"},
+        },
+        {
+            name:            "удаление в источнике ожидает подтверждения",
+            snapshot:        snapshot,
+            deletions:       DeletionAsk,
+            source:          []api.Track{s2, s3},
+            target:          []api.Track{y1, y2, y3},
+            pendingOnTarget: []string{"y1"},
+            fromSource:      []string{"s2", "s3"},
+            fromTarget:      []string{"y2", "y3"},
+        },
+        {
+            name:             "удаление на целевой стороне распространяется в источник",
+            snapshot:         snapshot,
+            deletions:        DeletionPropagate,
+            source:           []api.Track{s1, s2, s3},
+            target:           []api.Track{y1, y3},
+            removeFromSource: []string{"s2"},
+            fromSource:       []string{"s1", "s3"},
+            fromTarget:       []string{"y1", "y3"},
+        },
+        {
+            name:            "одностороннее направление не удаляет в источнике",
+            snapshot:        snapshot,
+            deletions:       DeletionPropagate,
+            direction:       DirectionSourceToTarget,
+            source:          []api.Track{s1, s2, s3},
+            target:          []api.Track{y1, y3},
+            pendingOnSource: []string{"s2"},
+            fromSource:      []string{"s1", "s3"},
+            fromTarget:      []string{"y1", "y3"},
+        },
+        {
+            name:       "удаление с обеих сторон ничего не удаляет",
+            snapshot:   snapshot,
+            deletions:  DeletionPropagate,
+            source:     []api.Track{s2, s3},
+            target:     []api.Track{y2, y3},
+            fromSource: []string{"s2", "s3"},
+            fromTarget: []string{"y2", "y3"},
+        },
+        {
+            name:         "похожий трек без соответствия не удаляется",
+            snapshot:     snapshot,
+            deletions:    DeletionPropagate,
+            source:       []api.Track{s1, s2},
+            target:       []api.Track{y1, y2, y3},
+            keptOnTarget: []string{"y3"},
+            fromSource:   []string{"s1", "s2"},
+            fromTarget:   []string{"y1", "y2"},
+        },
+        {
+            name:       "политика ignore возвращает удаленные треки",
+            snapshot:   snapshot,
+            deletions:  DeletionIgnore,
+            source:     []api.Track{s2, s3},
+            target:     []api.Track{y1, y2, y3},
+            fromSource: []string{"s2", "s3"},
+            fromTarget: []string{"y1", "y2", "y3"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            pair := Pair{SourcePlatform: api.PlatformSpotify, TargetPlatform: api.PlatformYouTube, Deletions: tt.deletions, Direction: tt.direction}
+            m := mergeSnapshot(tt.snapshot, pair, tt.source, tt.target, lookup, logging.NewStdLogger())
+            check := func(field string, got []api.Track, want []string) {
+                ids := []string{}
+                for _, track := range got {
+                    ids = append(ids, track.ID)
+                }
+                if want == nil {
+                    want = []string{}
+                }
+                if !reflect.DeepEqual(ids, want) {
+                    t.Errorf("%s = %v, ожидалось %v", field, ids, want)
+                }
+            }
+            check("removeFromSource", m.removeFromSource, tt.removeFromSource)
+            check("removeFromTarget", m.removeFromTarget, tt.removeFromTarget)
+            check("pendingOnSource", m.pendingOnSource, tt.pendingOnSource)
+            check("pendingOnTarget", m.pendingOnTarget, tt.pendingOnTarget)
+            check("keptOnTarget", m.keptOnTarget, tt.keptOnTarget)
+            check("fromSource", m.fromSource, tt.fromSource)
+            check("fromTarget", m.fromTarget, tt.fromTarget)
+        })
+    }
+}
\ No newline at end of file
@@ -0,0 +1,190 @@
+// pkg/sync/order.go
+package sync
+
+import (
+    "context"
+    "fmt"
+    "sort"
+
+    "github.com/Clean1ines/scps/pkg/api"
+    "github.com/Clean1ines/scps/pkg/logging"
+    "github.com/Clean1ines/scps/pkg/matching"
+    "github.com/Clean1ines/scps/pkg/storage"
+)
+
+// Move — перемещение трека плейлиста: трек, исходно стоявший на позиции Index, переносится
+// с текущей позиции From на позицию To (позиция после перемещения).
+type Move struct {
+    Index int
+    From  int
+    To    int
+}
+
+// syncOrder приводит порядок треков одного плейлиста пары к порядку другого: при синхронизации
+// target_to_source упорядочивается источник, иначе — целевой плейлист. Треки без соответствия
+// в эталонном плейлисте остаются на местах.
+func syncOrder(ctx context.Context, redisClient *storage.RedisClient, registry *api.Registry, pair Pair, logger *logging.Logger) error {
+    refPlatform, refID, listPlatform, listID := pair.SourcePlatform, pair.SourcePlaylistID, pair.TargetPlatform, pair.TargetPlaylistID
+    if pair.Direction == DirectionTargetToSource {
+        refPlatform, refID, listPlatform, listID = listPlatform, listID, refPlatform, refID
+    }
+    ref, err := registry.Get(refPlatform)
+    if err != nil {
+        return err
+    }
+    provider, err := registry.Get(listPlatform)
+    if err != nil {
+        return err
+    }
+    // Плейлисты перечитываются, чтобы учесть добавленные треки и получить их ID элементов.
+    refList, err := ref.GetPlaylist(ctx, refID)
+    if err != nil {
+        return fmt.Errorf("ошибка получения плейлиста %s: %w", ref.Name(), err)
+    }
+    list, err := provider.GetPlaylist(ctx, listID)
+    if err != nil {
+        return fmt.Errorf("ошибка получения плейлиста %s: %w", provider.Name(), err)
+    }
+    if refList.Truncated || list.Truncated {
+        logger.Infof("Порядок не синхронизируется: плейлист прочитан не полностью")
+        return nil
+    }
+    keys := orderKeys(ctx, redisClient, ref.Name(), refList.Tracks, provider.Name(), list.Tracks, logger)
+    moves := minimalMoves(keys)
+    for _, m := range moves {
+        if err := provider.MoveTrack(ctx, listID, list.Tracks[m.Index], m.From, m.To); err != nil {
+            return fmt.Errorf("ошибка изменения порядка на %s: %w", provider.Name(), err)
+        }
+    }
+    if len(moves) > 0 {
+        logger.Infof("Порядок плейлиста %s приведен к %s: перемещено %d треков", provider.Name(), ref.Name(), len(moves))
+    }
+    return nil
+}
+
+// orderKeys возвращает для каждого трека list позицию соответствующего трека в ref или -1,
+// если соответствие не найдено. Соответствия ищутся по таблице соответствий, затем нечетким сравнением.
+func orderKeys(ctx context.Context, redisClient *storage.RedisClient, refPlatform string, ref []api.Track, listPlatform string, list []api.Track, logger *logging.Logger) []int {
+    refIndex := map[string]int{}
+    for i := len(ref) - 1; i >= 0; i-- {
+        refIndex[ref[i].ID] = i
+    }
+    keys := make([]int, len(list))
+    unmapped := []api.Track{}
+    unmappedAt := map[string][]int{}
+    for i, track := range list {
+        keys[i] = -1
+        m, err := findMapping(ctx, redisClient, listPlatform, track)
+        if err != nil {
+            logger.Errorf("Ошибка чтения соответствия %s:%s: %v", listPlatform, track.ID, err)
+        }
+        if m != nil {
+            if k, ok := refIndex[m.IDs[refPlatform]]; ok {
+                keys[i] = k
+                continue
+            }
+        }
+        if _, ok := unmappedAt[track.ID]; !ok {
+            unmapped = append(unmapped, track)
+        }
+        unmappedAt[track.ID] = append(unmappedAt[track.ID], i)
+    }
+    for _, p := range matching.Diff(convertToMetadata(listPlatform, unmapped), convertToMetadata(refPlatform, ref)).Matches {
+        for _, i := range unmappedAt[p.Source.ID] {
+            keys[i] = refIndex[p.Target.ID]
+        }
+    }
+    return keys
+}
+
+// minimalMoves строит перемещения, упорядочивающие треки по возрастанию keys; треки с ключом -1
+// не перемещаются. Наибольшая неубывающая подпоследовательность ключей остается на месте,
+// поэтому число перемещений минимально: вставка одного трека дает одно перемещение.
+func minimalMoves(keys []int) []Move {
+    ranked := rankedPositions(keys)
+    placed := map[int]bool{}
+    for _, i := range longestNonDecreasing(keys, ranked) {
+        placed[i] = true
+    }
+    desired := append([]int{}, ranked...)
+    sort.SliceStable(desired, func(a, b int) bool { return keys[desired[a]] < keys[desired[b]] })
+
+    order := make([]int, len(keys)) // Исходные позиции треков в текущем порядке
+    for i := range order {
+        order[i] = i
+    }
+    moves := []Move{}
+    prev := -1
+    for _, i := range desired {
+        if placed[i] {
+            prev = i
+            continue
+        }
+        from := indexOf(order, i)
+        order = append(order[:from], order[from+1:]...)
+        to := 0
+        if prev >= 0 {
+            to = indexOf(order, prev) + 1
+        } else {
+            // Все уже стоящие на месте треки идут после i: ставим его перед первым из них.
+            for to < len(order) && !placed[order[to]] {
+                to++
+            }
+        }
+        order = append(order[:to], append([]int{i}, order[to:]...)...)
+        if from != to {
+            moves = append(moves, Move{Index: i, From: from, To: to})
+        }
+        placed[i] = true
+        prev = i
+    }
+    return moves
+}
+
+// rankedPositions возвращает позиции треков с неотрицательным ключом.
+func rankedPositions(keys []int) []int {
+    result := []int{}
+    for i, k := range keys {
+        if k >= 0 {
+            result = append(result, i)
+        }
+    }
+    return result
+}
+
+// longestNonDecreasing возвращает позиции из ranked, образующие наибольшую неубывающую
+// подпоследовательность keys (O(n log n)).
+func longestNonDecreasing(keys []int, ranked []int) []int {
+    tails := []int{}                   // tails[l] — номер в ranked последнего элемента лучшей подпоследовательности длины l+1
+    parent := make([]int, len(ranked)) // Предыдущий элемент подпоследовательности
+    for j, i := range ranked {
+        l := sort.Search(len(tails), func(t int) bool { return keys[ranked[tails[t]]] > keys[i] })
+        parent[j] = -1
+        if l > 0 {
+            parent[j] = tails[l-1]
+        }
+        if l == len(tails) {
+            tails = append(tails, j)
+        } else {
+            tails[l] = j
+        }
+    }
+    result := []int{}
+    if len(tails) == 0 {
+        return result
+    }
+    for j := tails[len(tails)-1]; j >= 0; j = parent[j] {
+        result = append(result, ranked[j])
+    }
+    return result
+}
+
+// indexOf возвращает позицию значения в срезе или -1.
+func indexOf(values []int, v int) int {
+    for i, x := range values {
+        if x == v {
+            return i
+        }
+    }
+    return -1
+}
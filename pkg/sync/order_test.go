@@ -0,0 +1,90 @@
+// pkg/sync/order_test.go
+package sync
+
+import (
+    "math/rand"
+    "sort"
+    "testing"
+)
+
+// applyMoves выполняет перемещения над исходными позициями и возвращает ключи в новом порядке.
+func applyMoves(keys []int, moves []Move) []int {
+    order := make([]int, len(keys))
+    for i := range order {
+        order[i] = i
+    }
+    for _, m := range moves {
+        if order[m.From] != m.Index {
+            return nil
+        }
+        order = append(order[:m.From], order[m.From+1:]...)
+        order = append(order[:m.To], append([]int{m.Index}, order[m.To:]...)...)
+    }
+    result := []int{}
+    for _, i := range order {
+        result = append(result, keys[i])
+    }
+    return result
+}
+
+// rankedSorted сообщает, идут ли неотрицательные ключи по возрастанию.
+func rankedSorted(keys []int) bool {
+    ranked := []int{}
+    for _, k := range keys {
+        if k >= 0 {
+            ranked = append(ranked, k)
+        }
+    }
+    return sort.IntsAreSorted(ranked)
+}
+
+func TestMinimalMoves(t *testing.T) {
+    cases := []struct {
+        name  string
+        keys  []int
+        moves int
+    }{
+        {name: "порядок совпадает", keys: []int{0, 1, 2, 3}, moves: 0},
+        {name: "добавленный трек в конце", keys: []int{0, 1, 3, 4, 2}, moves: 1},
+        {name: "трек перенесен в начало", keys: []int{1, 2, 3, 0}, moves: 1},
+        {name: "обратный порядок", keys: []int{3, 2, 1, 0}, moves: 3},
+        {name: "треки без соответствия остаются", keys: []int{-1, 2, -1, 0, 1}, moves: 1},
+    }
+    for _, c := range cases {
+        t.Run(c.name, func(t *testing.T) {
+            moves := minimalMoves(c.keys)
+            if len(moves) != c.moves {
+                t.Fatalf("перемещений %d, ожидалось %d: %+v", len(moves), c.moves, moves)
+            }
+            if got := applyMoves(c.keys, moves); got == nil || !rankedSorted(got) {
+                t.Fatalf("порядок после перемещений %v", got)
+            }
+        })
+    }
+}
+
+func TestMinimalMovesRandom(t *testing.T) {
+    rng := rand.New(rand.NewSource(1))
+    for n := 0; n < 200; n++ {
+        keys := rng.Perm(rng.Intn(30))
+        for i := range keys {
+            if rng.Intn(5) == 0 {
+                keys[i] = -1
+            }
+        }
+        moves := minimalMoves(keys)
+        got := applyMoves(keys, moves)
+        if got == nil || !rankedSorted(got) {
+            t.Fatalf("ключи %v: порядок после перемещений %v", keys, got)
+        }
+        ranked := 0
+        for _, k := range keys {
+            if k >= 0 {
+                ranked++
+            }
+        }
+        if want := ranked - len(longestNonDecreasing(keys, rankedPositions(keys))); len(moves) != want {
+            t.Fatalf("ключи %v: перемещений %d, ожидалось %d", keys, len(moves), want)
+        }
+    }
+}
@@ -0,0 +1,353 @@
+// pkg/sync/plan.go
+package sync
+
+import (
+    "context"
+    "fmt"
+    "strings"
+
+    "github.com/Clean1ines/scps/pkg/api"
+    "github.com/Clean1ines/scps/pkg/logging"
+    "github.com/Clean1ines/scps/pkg/storage"
+)
+
+// lowConfidenceMargin — найденные поиском соответствия с оценкой ниже порога плюс этот запас
+// отмечаются в плане как сомнительные.
+const lowConfidenceMargin = 0.1
+
+// summaryListLimit — число элементов каждого списка, выводимых в описании плана (см. Plan.Summary).
+const summaryListLimit = 10
+
+// Plan — результат чтения, сравнения и поиска соответствий без изменения плейлистов.
+// Используется как предпросмотр (dry-run) и как входные данные для ApplyPlan.
+type Plan struct {
+    Pair               Pair                    `json:"pair"`
+    SourceTotal        int                     `json:"source_total"`
+    TargetTotal        int                     `json:"target_total"`
+    Truncated          bool                    `json:"truncated"`
+    AddToSource        []api.Track             `json:"add_to_source"`
+    AddToTarget        []api.Track             `json:"add_to_target"`
+    ResolvedOnSource   []ResolvedTrack         `json:"resolved_on_source"`
+    ResolvedOnTarget   []ResolvedTrack         `json:"resolved_on_target"`
+    UnresolvedOnSource []string                `json:"unresolved_on_source"`
+    UnresolvedOnTarget []string                `json:"unresolved_on_target"`
+    LowConfidence      []ResolvedTrack         `json:"low_confidence"`
+    RemoveFromSource   []api.Track             `json:"remove_from_source"` // Удалены на целевой стороне после прошлой синхронизации
+    RemoveFromTarget   []api.Track             `json:"remove_from_target"` // Удалены в источнике после прошлой синхронизации
+    PendingOnSource    []string                `json:"pending_on_source"`  // Удаления, ожидающие подтверждения (DeletionAsk)
+    PendingOnTarget    []string                `json:"pending_on_target"`  // Удаления, ожидающие подтверждения (DeletionAsk)
+    KeptOnSource       []string                `json:"kept_on_source"`     // Похожие на удаленные треки, которые не удаляются автоматически
+    KeptOnTarget       []string                `json:"kept_on_target"`     // Похожие на удаленные треки, которые не удаляются автоматически
+    mappings           []*storage.TrackMapping // Найденные поиском соответствия; сохраняются в ApplyPlan
+    next               *Snapshot               // Снимок, сохраняемый после успешного применения плана
+}
+
+// BuildPlan читает оба плейлиста, определяет недостающие треки и подбирает для них соответствия,
+// не изменяя плейлисты и таблицу соответствий. Треки, удаленные с одной из сторон после прошлой
+// синхронизации (трехстороннее сравнение со снимком), обрабатываются согласно pair.Deletions.
+func BuildPlan(ctx context.Context, redisClient *storage.RedisClient, registry *api.Registry, pair Pair, logger *logging.Logger) (*Plan, error) {
+    source, err := registry.Get(pair.SourcePlatform)
+    if err != nil {
+        return nil, err
+    }
+    target, err := registry.Get(pair.TargetPlatform)
+    if err != nil {
+        return nil, err
+    }
+    // Получаем исходный плейлист.
+    sourceList, err := source.GetPlaylist(ctx, pair.SourcePlaylistID)
+    if err != nil {
+        return nil, fmt.Errorf("ошибка получения плейлиста %s: %w", source.Name(), err)
+    }
+    // Получаем целевой плейлист.
+    targetList, err := target.GetPlaylist(ctx, pair.TargetPlaylistID)
+    if err != nil {
+        return nil, fmt.Errorf("ошибка получения плейлиста %s: %w", target.Name(), err)
+    }
+    if sourceList.Truncated || targetList.Truncated {
+        logger.Infof("Плейлист прочитан не полностью: %s %d/%d, %s %d/%d", source.Name(), len(sourceList.Tracks), sourceList.Total, target.Name(), len(targetList.Tracks), targetList.Total)
+    }
+    // Сравниваем плейлисты со снимком прошлой синхронизации, чтобы найти удаленные треки.
+    plan := &Plan{
+        RemoveFromSource: []api.Track{},
+        RemoveFromTarget: []api.Track{},
+        PendingOnSource:  []string{},
+        PendingOnTarget:  []string{},
+    }
+    snapshot, err := loadSnapshot(ctx, redisClient, pair)
+    if err != nil {
+        logger.Errorf("Ошибка чтения снимка синхронизации: %v", err)
+    }
+    if snapshot != nil && (sourceList.Truncated || targetList.Truncated) {
+        // Треки за пределами прочитанной части выглядели бы удаленными.
+        logger.Infof("Удаления не обрабатываются: плейлист прочитан не полностью")
+        snapshot = nil
+    }
+    merge := mergeSnapshot(snapshot, pair, sourceList.Tracks, targetList.Tracks, func(platform string, track api.Track) (*storage.TrackMapping, error) {
+        return findMapping(ctx, redisClient, platform, track)
+    }, logger)
+    fromSource, fromTarget := merge.fromSource, merge.fromTarget
+    plan.RemoveFromSource = append(plan.RemoveFromSource, merge.removeFromSource...)
+    plan.RemoveFromTarget = append(plan.RemoveFromTarget, merge.removeFromTarget...)
+    plan.PendingOnSource = append(plan.PendingOnSource, describeTracks(merge.pendingOnSource)...)
+    plan.PendingOnTarget = append(plan.PendingOnTarget, describeTracks(merge.pendingOnTarget)...)
+    plan.KeptOnSource = describeTracks(merge.keptOnSource)
+    plan.KeptOnTarget = describeTracks(merge.keptOnTarget)
+    // Определяем недостающие треки и ищем их соответствия на платформах, куда они будут добавлены.
+    threshold := resolveThresholdFromEnv()
+    // При односторонней синхронизации обратное направление не планируется.
+    addToTarget, resolvedOnTarget, unresolvedOnTarget := []api.Track{}, []resolution{}, []api.Track{}
+    if pair.Direction.ToTarget() {
+        addToTarget, resolvedOnTarget, unresolvedOnTarget, err = planAdditions(ctx, redisClient, source.Name(), fromSource, target, targetList.Tracks, threshold, logger)
+        if err != nil {
+            return nil, err
+        }
+    }
+    addToSource, resolvedOnSource, unresolvedOnSource := []api.Track{}, []resolution{}, []api.Track{}
+    if pair.Direction.ToSource() {
+        addToSource, resolvedOnSource, unresolvedOnSource, err = planAdditions(ctx, redisClient, target.Name(), fromTarget, source, sourceList.Tracks, threshold, logger)
+        if err != nil {
+            return nil, err
+        }
+    }
+    lowConfidence := lowConfidenceResolutions(resolvedOnTarget, threshold)
+    lowConfidence = append(lowConfidence, lowConfidenceResolutions(resolvedOnSource, threshold)...)
+    mappings := mappingsFor(source.Name(), target.Name(), resolvedOnTarget)
+    mappings = append(mappings, mappingsFor(target.Name(), source.Name(), resolvedOnSource)...)
+    plan.Pair = pair
+    plan.SourceTotal = sourceList.Total
+    plan.TargetTotal = targetList.Total
+    plan.Truncated = sourceList.Truncated || targetList.Truncated
+    plan.AddToSource = addToSource
+    plan.AddToTarget = addToTarget
+    plan.ResolvedOnSource = describeResolutions(resolvedOnSource)
+    plan.ResolvedOnTarget = describeResolutions(resolvedOnTarget)
+    plan.UnresolvedOnSource = describeTracks(unresolvedOnSource)
+    plan.UnresolvedOnTarget = describeTracks(unresolvedOnTarget)
+    plan.LowConfidence = lowConfidence
+    plan.mappings = mappings
+    // Удаления, ожидающие подтверждения или с похожими треками на другой стороне, остаются в снимке,
+    // чтобы их не добавили обратно при следующей синхронизации.
+    plan.next = &Snapshot{
+        Source: append(withoutTracks(append(sourceList.Tracks, addToSource...), plan.RemoveFromSource), merge.deletedSource...),
+        Target: append(withoutTracks(append(targetList.Tracks, addToTarget...), plan.RemoveFromTarget), merge.deletedTarget...),
+    }
+    return plan, nil
+}
+
+// ApplyPlan добавляет и удаляет треки из плана в плейлистах пары и сохраняет найденные соответствия.
+// Ошибки логируются и не прерывают обновление второго плейлиста; если хотя бы одна операция
+// не удалась, возвращается ошибка (с первой ошибкой внутри) и снимок пары не обновляется.
+// Ход применения передается обработчику, заданному через WithProgress; операции, уже
+// записанные в журнал задачи (см. WithJob), не повторяются. При отмене ctx
+// оставшиеся операции не выполняются и возвращается ошибка, оборачивающая ctx.Err().
+func ApplyPlan(ctx context.Context, redisClient *storage.RedisClient, registry *api.Registry, plan *Plan, logger *logging.Logger) error {
+    source, err := registry.Get(plan.Pair.SourcePlatform)
+    if err != nil {
+        return err
+    }
+    target, err := registry.Get(plan.Pair.TargetPlatform)
+    if err != nil {
+        return err
+    }
+    journal, err := loadJournal(ctx, redisClient)
+    if err != nil {
+        return fmt.Errorf("ошибка чтения журнала операций: %w", err)
+    }
+    saveMappings(ctx, redisClient, plan.mappings, logger)
+    progress := Progress{Total: len(plan.AddToTarget) + len(plan.RemoveFromTarget) + len(plan.AddToSource) + len(plan.RemoveFromSource)}
+    reportProgress(ctx, progress)
+    failed, errs := []string{}, []error{}
+    // applied учитывает примененные операции в ходе синхронизации.
+    applied := func(operation string, provider api.Provider, tracks []api.Track) {
+        progress.Applied += len(tracks)
+        for _, t := range tracks {
+            progress.Items = append(progress.Items, AppliedItem{Operation: operation, Platform: provider.Name(), TrackID: t.ID, Name: t.Name})
+        }
+    }
+    // apply выполняет операцию над треками tracks частями по applyChunkSize, записывая примененные
+    // операции в журнал задачи. Операции, уже записанные в журнал, пропускаются. После отмены ctx
+    // оставшиеся части не отправляются.
+    apply := func(what, operation string, provider api.Provider, playlistID string, tracks []api.Track, op func(chunk []api.Track) error) {
+        pending := make([]api.Track, 0, len(tracks))
+        for _, t := range tracks {
+            if journal.Applied(operation, provider.Name(), playlistID, t.ID) {
+                applied(operation, provider, []api.Track{t})
+            } else {
+                pending = append(pending, t)
+            }
+        }
+        if skipped := len(tracks) - len(pending); skipped > 0 {
+            logger.Infof("Операция «%s»: пропущено треков, обработанных предыдущим запуском: %d", what, skipped)
+            reportProgress(ctx, progress)
+        }
+        for start := 0; start < len(pending); start += applyChunkSize {
+            end := start + applyChunkSize
+            if end > len(pending) {
+                end = len(pending)
+            }
+            chunk := pending[start:end]
+            err := ctx.Err()
+            if err == nil {
+                err = op(chunk)
+            }
+            done := chunk
+            if err != nil {
+                // Сервис мог успеть обработать начало части (см. api.PartialError).
+                if n := api.AppliedCount(err); n < len(chunk) {
+                    done = chunk[:n]
+                }
+            }
+            ids := make([]string, len(done))
+            for i, t := range done {
+                ids[i] = t.ID
+            }
+            // Журнал пишется и после отмены ctx: операции уже применены сервисом.
+            if jerr := journal.Record(context.Background(), operation, provider.Name(), playlistID, ids); jerr != nil {
+                logger.Errorf("Ошибка записи журнала операций: %v", jerr)
+            }
+            applied(operation, provider, done)
+            if err != nil {
+                logger.Errorf("Ошибка операции «%s»: %v", what, err)
+                failed = append(failed, what)
+                errs = append(errs, err)
+                progress.Failed += len(pending) - start - len(done)
+                reportProgress(ctx, progress)
+                return
+            }
+            reportProgress(ctx, progress)
+        }
+    }
+    // Обновляем целевой плейлист.
+    apply("добавление на "+target.Name(), OperationAdd, target, plan.Pair.TargetPlaylistID, plan.AddToTarget, func(chunk []api.Track) error {
+        return target.AddTracks(ctx, plan.Pair.TargetPlaylistID, chunk)
+    })
+    apply("удаление на "+target.Name(), OperationRemove, target, plan.Pair.TargetPlaylistID, plan.RemoveFromTarget, func(chunk []api.Track) error {
+        return target.RemoveTracks(ctx, plan.Pair.TargetPlaylistID, chunk)
+    })
+    // Обновляем исходный плейлист.
+    apply("добавление на "+source.Name(), OperationAdd, source, plan.Pair.SourcePlaylistID, plan.AddToSource, func(chunk []api.Track) error {
+        return source.AddTracks(ctx, plan.Pair.SourcePlaylistID, chunk)
+    })
+    apply("удаление на "+source.Name(), OperationRemove, source, plan.Pair.SourcePlaylistID, plan.RemoveFromSource, func(chunk []api.Track) error {
+        return source.RemoveTracks(ctx, plan.Pair.SourcePlaylistID, chunk)
+    })
+    if err := ctx.Err(); err != nil {
+        // Синхронизация отменена: примененные операции переданы в ход синхронизации, снимок не сохраняется.
+        return fmt.Errorf("синхронизация прервана, применено %d из %d: %w", progress.Applied, progress.Total, err)
+    }
+    if len(failed) == 0 && plan.Pair.PreserveOrder {
+        // Порядок сверяется с актуальным состоянием плейлистов, а не с контрольной точкой чтения.
+        if err := syncOrder(api.WithPageCheckpointer(ctx, nil), redisClient, registry, plan.Pair, logger); err != nil {
+            logger.Errorf("Ошибка синхронизации порядка: %v", err)
+            failed = append(failed, "изменение порядка")
+            errs = append(errs, err)
+        }
+    }
+    if len(failed) > 0 {
+        // Оборачивается первая ошибка, чтобы вызывающий код мог определить, стоит ли повторять синхронизацию.
+        return fmt.Errorf("не выполнено: %s: %w", strings.Join(failed, ", "), errs[0])
+    }
+    if plan.next != nil {
+        if err := saveSnapshot(ctx, redisClient, plan.Pair, plan.next); err != nil {
+            logger.Errorf("Ошибка сохранения снимка синхронизации: %v", err)
+        }
+    }
+    return nil
+}
+
+// DryRun строит план двусторонней синхронизации пары Spotify/YouTube пользователя chatID
+// без изменения плейлистов.
+func DryRun(ctx context.Context, redisClient *storage.RedisClient, chatID int64, spotifyPlaylistID, youtubePlaylistID string, logger *logging.Logger) (*Plan, error) {
+    return BuildPlan(WithUser(ctx, chatID), redisClient, DefaultRegistry(redisClient, chatID), spotifyYouTubePair(spotifyPlaylistID, youtubePlaylistID), logger)
+}
+
+// Summary формирует краткое текстовое описание плана для предпросмотра в боте.
+func (p *Plan) Summary() string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "Направление: %s %s %s\n", p.Pair.SourcePlatform, p.Pair.Direction.Arrow(), p.Pair.TargetPlatform)
+    if p.Pair.Direction.ToTarget() {
+        fmt.Fprintf(&b, "Будет добавлено на %s: %d треков\n", p.Pair.TargetPlatform, len(p.AddToTarget))
+    }
+    if p.Pair.Direction.ToSource() {
+        fmt.Fprintf(&b, "Будет добавлено на %s: %d треков\n", p.Pair.SourcePlatform, len(p.AddToSource))
+    }
+    if len(p.RemoveFromTarget) > 0 {
+        fmt.Fprintf(&b, "Будет удалено на %s: %d треков\n", p.Pair.TargetPlatform, len(p.RemoveFromTarget))
+    }
+    if len(p.RemoveFromSource) > 0 {
+        fmt.Fprintf(&b, "Будет удалено на %s: %d треков\n", p.Pair.SourcePlatform, len(p.RemoveFromSource))
+    }
+    if p.HasPendingDeletions() {
+        pending := []string{}
+        for _, t := range p.PendingOnTarget {
+            pending = append(pending, fmt.Sprintf("%s (%s)", t, p.Pair.TargetPlatform))
+        }
+        for _, t := range p.PendingOnSource {
+            pending = append(pending, fmt.Sprintf("%s (%s)", t, p.Pair.SourcePlatform))
+        }
+        fmt.Fprintf(&b, "Удалены после прошлой синхронизации (%d), удалить и с другой стороны?\n", len(pending))
+        writeSummaryList(&b, pending)
+    }
+    if kept := len(p.KeptOnSource) + len(p.KeptOnTarget); kept > 0 {
+        similar := []string{}
+        for _, t := range p.KeptOnTarget {
+            similar = append(similar, fmt.Sprintf("%s (%s)", t, p.Pair.TargetPlatform))
+        }
+        for _, t := range p.KeptOnSource {
+            similar = append(similar, fmt.Sprintf("%s (%s)", t, p.Pair.SourcePlatform))
+        }
+        fmt.Fprintf(&b, "Не удалены треки, лишь похожие на удаленные (%d): удалите их вручную или свяжите командой /map\n", kept)
+        writeSummaryList(&b, similar)
+    }
+    if unresolved := len(p.UnresolvedOnSource) + len(p.UnresolvedOnTarget); unresolved > 0 {
+        fmt.Fprintf(&b, "Не найдено соответствий: %d\n", unresolved)
+    }
+    if len(p.LowConfidence) > 0 {
+        low := []string{}
+        for _, r := range p.LowConfidence {
+            low = append(low, fmt.Sprintf("%s → %s (%.2f)", r.Source, r.Match, r.Score))
+        }
+        fmt.Fprintf(&b, "Сомнительные соответствия (%d):\n", len(low))
+        writeSummaryList(&b, low)
+    }
+    if p.Pair.PreserveOrder {
+        if p.Pair.Direction == DirectionTargetToSource {
+            fmt.Fprintf(&b, "Порядок треков на %s будет приведен к %s\n", p.Pair.SourcePlatform, p.Pair.TargetPlatform)
+        } else {
+            fmt.Fprintf(&b, "Порядок треков на %s будет приведен к %s\n", p.Pair.TargetPlatform, p.Pair.SourcePlatform)
+        }
+    }
+    if p.Truncated {
+        b.WriteString("Плейлист прочитан не полностью.\n")
+    }
+    return b.String()
+}
+
+// writeSummaryList выводит первые summaryListLimit элементов списка и число оставшихся:
+// полный список большого плана не помещается в сообщение Telegram.
+func writeSummaryList(b *strings.Builder, items []string) {
+    for i, item := range items {
+        if i == summaryListLimit {
+            fmt.Fprintf(b, "… и еще %d\n", len(items)-summaryListLimit)
+            break
+        }
+        fmt.Fprintf(b, "- %s\n", item)
+    }
+}
+
+// HasPendingDeletions сообщает, есть ли в плане удаления, ожидающие подтверждения пользователя.
+func (p *Plan) HasPendingDeletions() bool {
+    return len(p.PendingOnSource)+len(p.PendingOnTarget) > 0
+}
+
+// lowConfidenceResolutions отбирает найденные поиском соответствия с оценкой, близкой к порогу.
+func lowConfidenceResolutions(resolved []resolution, threshold float64) []ResolvedTrack {
+    low := []resolution{}
+    for _, r := range resolved {
+        if r.Result.Score < threshold+lowConfidenceMargin {
+            low = append(low, r)
+        }
+    }
+    return describeResolutions(low)
+}
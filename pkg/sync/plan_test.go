@@ -0,0 +1,197 @@
+// pkg/sync/plan_test.go
+package sync
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "testing"
+
+    "github.com/Clean1ines/scps/pkg/api"
+    "github.com/Clean1ines/scps/pkg/logging"
+    "github.com/go-redis/redis/v8"
+)
+
+// fakeProvider хранит плейлисты в памяти и вызывает onWrite после каждой записи.
+type fakeProvider struct {
+    name      string
+    playlists map[string][]api.Track
+    writes    int
+    onWrite   func()
+    capacity  int // Если больше 0, AddTracks добавляет не больше capacity треков и возвращает api.PartialError
+}
+
+func (f *fakeProvider) Name() string { return f.name }
+
+func (f *fakeProvider) GetPlaylist(ctx context.Context, playlistID string) (*api.TrackList, error) {
+    return &api.TrackList{Tracks: append([]api.Track{}, f.playlists[playlistID]...)}, nil
+}
+
+func (f *fakeProvider) GetPlaylistInfo(ctx context.Context, playlistID string) (*api.PlaylistInfo, error) {
+    return &api.PlaylistInfo{ID: playlistID, TrackCount: len(f.playlists[playlistID])}, nil
+}
+
+func (f *fakeProvider) AddTracks(ctx context.Context, playlistID string, tracks []api.Track) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    if f.capacity > 0 && len(f.playlists[playlistID])+len(tracks) > f.capacity {
+        n := f.capacity - len(f.playlists[playlistID])
+        f.playlists[playlistID] = append(f.playlists[playlistID], tracks[:n]...)
+        return &api.PartialError{Applied: n, Err: &api.StatusError{Message: "квота", StatusCode: 403}}
+    }
+    f.playlists[playlistID] = append(f.playlists[playlistID], tracks...)
+    f.wrote()
+    return nil
+}
+
+func (f *fakeProvider) RemoveTracks(ctx context.Context, playlistID string, tracks []api.Track) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    f.playlists[playlistID] = withoutTracks(f.playlists[playlistID], tracks)
+    f.wrote()
+    return nil
+}
+
+func (f *fakeProvider) MoveTrack(ctx context.Context, playlistID string, track api.Track, from, to int) error {
+    return errors.New("не поддерживается")
+}
+
+func (f *fakeProvider) GetTrack(ctx context.Context, trackID string) (*api.Track, error) {
+    return nil, api.ErrTrackNotFound
+}
+
+func (f *fakeProvider) Search(ctx context.Context, query string, limit int) ([]api.Track, error) {
+    return nil, nil
+}
+
+func (f *fakeProvider) ResolveURL(url string) (string, error) { return url, nil }
+
+func (f *fakeProvider) wrote() {
+    f.writes++
+    if f.onWrite != nil {
+        f.onWrite()
+    }
+}
+
+func TestApplyPlanStopsOnCancel(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    source := &fakeProvider{name: api.PlatformSpotify, playlists: map[string][]api.Track{}}
+    target := &fakeProvider{name: api.PlatformYouTube, playlists: map[string][]api.Track{}, onWrite: cancel}
+    plan := &Plan{Pair: Pair{SourcePlatform: source.name, SourcePlaylistID: "s", TargetPlatform: target.name, TargetPlaylistID: "t"}}
+    for i := 0; i < 2*applyChunkSize+5; i++ {
+        plan.AddToTarget = append(plan.AddToTarget, api.Track{ID: fmt.Sprintf("v%d", i)})
+    }
+    var last Progress
+    ctx = WithProgress(ctx, func(p Progress) { last = p })
+
+    err := ApplyPlan(ctx, nil, api.NewRegistry(source, target), plan, logging.NewStdLogger())
+    if !errors.Is(err, context.Canceled) {
+        t.Fatalf("Ожидалась ошибка отмены, получено: %v", err)
+    }
+    if target.writes != 1 || len(target.playlists["t"]) != applyChunkSize {
+        t.Errorf("После отмены продолжена запись: вызовов %d, треков %d", target.writes, len(target.playlists["t"]))
+    }
+    if last.Total != len(plan.AddToTarget) || last.Applied != applyChunkSize || len(last.Items) != applyChunkSize {
+        t.Errorf("Неверный ход синхронизации: %+v", last)
+    }
+    if last.Items[0].Operation != OperationAdd || last.Items[0].Platform != api.PlatformYouTube || last.Items[0].TrackID != "v0" {
+        t.Errorf("Неверная примененная операция: %+v", last.Items[0])
+    }
+}
+
+func TestPairLockKeyIgnoresDirection(t *testing.T) {
+    forward := Pair{SourcePlatform: api.PlatformSpotify, SourcePlaylistID: "s", TargetPlatform: api.PlatformYouTube, TargetPlaylistID: "y"}
+    backward := Pair{SourcePlatform: api.PlatformYouTube, SourcePlaylistID: "y", TargetPlatform: api.PlatformSpotify, TargetPlaylistID: "s", Direction: DirectionTargetToSource}
+    if pairLockKey(forward) != pairLockKey(backward) {
+        t.Errorf("Ключи блокировки одной пары различаются: %q, %q", pairLockKey(forward), pairLockKey(backward))
+    }
+    other := forward
+    other.TargetPlaylistID = "y2"
+    if pairLockKey(forward) == pairLockKey(other) {
+        t.Errorf("Разные пары получили одинаковый ключ блокировки")
+    }
+}
+
+func TestApplyPlanCountsPartialWrites(t *testing.T) {
+    source := &fakeProvider{name: api.PlatformSpotify, playlists: map[string][]api.Track{}}
+    target := &fakeProvider{name: api.PlatformYouTube, playlists: map[string][]api.Track{}, capacity: 7}
+    plan := &Plan{Pair: Pair{SourcePlatform: source.name, SourcePlaylistID: "s", TargetPlatform: target.name, TargetPlaylistID: "t"}}
+    for i := 0; i < 10; i++ {
+        plan.AddToTarget = append(plan.AddToTarget, api.Track{ID: fmt.Sprintf("v%d", i)})
+    }
+    var last Progress
+    ctx := WithProgress(context.Background(), func(p Progress) { last = p })
+
+    err := ApplyPlan(ctx, nil, api.NewRegistry(source, target), plan, logging.NewStdLogger())
+    if api.AppliedCount(err) != 7 {
+        t.Fatalf("Ожидалась частичная ошибка, получено: %v", err)
+    }
+    if last.Applied != 7 || last.Failed != 3 || len(last.Items) != 7 || last.Items[6].TrackID != "v6" {
+        t.Errorf("Неверный ход синхронизации: %+v", last)
+    }
+}
+
+func TestSummaryLimitsLists(t *testing.T) {
+    plan := &Plan{Pair: Pair{SourcePlatform: api.PlatformSpotify, TargetPlatform: api.PlatformYouTube, Deletions: DeletionAsk}}
+    for i := 0; i < 500; i++ {
+        plan.PendingOnTarget = append(plan.PendingOnTarget, fmt.Sprintf("Исполнитель - Удаленный трек %d", i))
+        plan.LowConfidence = append(plan.LowConfidence, ResolvedTrack{Source: fmt.Sprintf("Трек %d", i), Match: fmt.Sprintf("Видео %d", i), Score: 0.8})
+    }
+
+    summary := plan.Summary()
+    if len([]rune(summary)) > 2000 {
+        t.Errorf("Описание большого плана слишком длинное: %d символов", len([]rune(summary)))
+    }
+    for _, want := range []string{"Удалены после прошлой синхронизации (500)", "Сомнительные соответствия (500)", "… и еще 490", "Удаленный трек 9 ", "Трек 9 → Видео 9"} {
+        if !strings.Contains(summary, want) {
+            t.Errorf("В описании плана нет %q:\n%s", want, summary)
+        }
+    }
+    if strings.Contains(summary, "Удаленный трек 10 ") {
+        t.Errorf("Описание плана содержит элементы сверх ограничения:\n%s", summary)
+    }
+}
+
+// searchProvider возвращает на любой поисковый запрос одни и те же кандидаты.
+type searchProvider struct {
+    *fakeProvider
+    candidates []api.Track
+}
+
+func (s *searchProvider) Search(ctx context.Context, query string, limit int) ([]api.Track, error) {
+    return s.candidates, nil
+}
+
+func TestPlanAdditionsSkipsDuplicateMatches(t *testing.T) {
+    // Redis недоступен: соответствий нет, все треки подбираются поиском
+    redisClient := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+    defer redisClient.Close()
+    to := &searchProvider{
+        fakeProvider: &fakeProvider{name: api.PlatformYouTube},
+        candidates: []api.Track{
+            {ID: "y1", Name: "First Song", Artist: "Alpha"},
+            {ID: "y2", Name: "Second Song", Artist: "Beta"},
+        },
+    }
+    from := []api.Track{
+        {ID: "s1", Name: "First Song", Artist: "Alpha"},
+        {ID: "s2", Name: "Second Song", Artist: "Beta"},
+        {ID: "s3", Name: "Second Song", Artist: "Beta"},
+    }
+    // y1 уже в плейлисте, но под названием, по которому его не найти нечетким сравнением
+    toTracks := []api.Track{{ID: "y1", Name: "Official Video", Artist: "Channel"}}
+    add, resolved, _, err := planAdditions(context.Background(), redisClient, api.PlatformSpotify, from, to, toTracks, 0, logging.NewStdLogger())
+    if err != nil {
+        t.Fatalf("Ошибка планирования: %v", err)
+    }
+    if len(add) != 1 || add[0].ID != "y2" {
+        t.Errorf("Добавляемые треки %v, ожидался только y2", add)
+    }
+    if len(resolved) != 3 {
+        t.Errorf("Найдено соответствий %d, ожидалось 3", len(resolved))
+    }
+}
\ No newline at end of file
@@ -0,0 +1,49 @@
+// pkg/sync/progress.go
+package sync
+
+import "context"
+
+// applyChunkSize — число треков в одном вызове AddTracks/RemoveTracks при применении плана.
+// Между частями проверяется отмена синхронизации; часть, прерванная отменой, считается
+// не примененной.
+const applyChunkSize = 20
+
+// Операции над треками в AppliedItem.
+const (
+    OperationAdd    = "add"
+    OperationRemove = "remove"
+)
+
+// AppliedItem — трек, добавленный в плейлист или удаленный из него при применении плана.
+type AppliedItem struct {
+    Operation string `json:"operation"` // OperationAdd или OperationRemove
+    Platform  string `json:"platform"`
+    TrackID   string `json:"track_id"`
+    Name      string `json:"name,omitempty"`
+}
+
+// Progress — ход применения плана синхронизации.
+type Progress struct {
+    Total   int           `json:"total"`           // Число треков, которые план добавляет и удаляет
+    Applied int           `json:"applied"`         // Число треков, успешно добавленных или удаленных
+    Failed  int           `json:"failed"`          // Число треков, добавить или удалить которые не удалось
+    Items   []AppliedItem `json:"items,omitempty"` // Примененные операции в порядке выполнения
+}
+
+// ProgressFunc получает ход синхронизации после каждой операции ApplyPlan.
+type ProgressFunc func(Progress)
+
+type progressKey struct{}
+
+// WithProgress возвращает контекст, при синхронизации с которым ход применения плана
+// передается в fn.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+    return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// reportProgress передает ход синхронизации обработчику из контекста, если он задан.
+func reportProgress(ctx context.Context, p Progress) {
+    if fn, ok := ctx.Value(progressKey{}).(ProgressFunc); ok && fn != nil {
+        fn(p)
+    }
+}
\ No newline at end of file
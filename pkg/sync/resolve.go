@@ -0,0 +1,182 @@
+// pkg/sync/resolve.go
+package sync
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/Clean1ines/scps/pkg/api"
+    "github.com/Clean1ines/scps/pkg/logging"
+    "github.com/Clean1ines/scps/pkg/matching"
+    "github.com/Clean1ines/scps/pkg/storage"
+)
+
+const (
+    // DefaultResolveThreshold — минимальная оценка сходства, при которой найденный трек добавляется.
+    DefaultResolveThreshold = 0.75
+    // searchCandidates — число кандидатов, запрашиваемых у поиска целевой платформы.
+    searchCandidates = 5
+)
+
+// resolution — найденное на целевой платформе соответствие трека.
+type resolution struct {
+    Source api.Track
+    Match  api.Track
+    Result matching.MatchResult
+}
+
+// ResolvedTrack описывает найденное соответствие в отчете синхронизации.
+type ResolvedTrack struct {
+    Source      string  `json:"source"`
+    Match       string  `json:"match"`
+    Score       float64 `json:"score"`
+    Explanation string  `json:"explanation"`
+}
+
+// resolveMissing ищет на целевой платформе соответствия для треков, отсутствующих в ее плейлисте.
+// Возвращает найденные соответствия и треки, для которых соответствие не найдено. Результаты
+// поиска сохраняются в контрольную точку задачи; при исчерпании квоты сервиса поиск прерывается
+// с ошибкой, чтобы задачу можно было продолжить после сброса квоты.
+func resolveMissing(ctx context.Context, fromPlatform string, target api.Provider, missing []api.Track, threshold float64, logger *logging.Logger) ([]resolution, []api.Track, error) {
+    checkpoint := checkpointFrom(ctx)
+    resolved := []resolution{}
+    unresolved := []api.Track{}
+    for _, track := range missing {
+        found, ok := checkpoint.search(fromPlatform, track.ID, target.Name())
+        if !ok {
+            meta := toMetadata(fromPlatform, track)
+            query := searchQuery(meta)
+            candidates, err := target.Search(ctx, query, searchCandidates)
+            if _, quota := api.QuotaResetAt(err, time.Now()); quota {
+                return nil, nil, fmt.Errorf("ошибка поиска на %s: %w", target.Name(), err)
+            }
+            if err != nil {
+                logger.Errorf("Ошибка поиска %q на %s: %v", query, target.Name(), err)
+                unresolved = append(unresolved, track)
+                continue
+            }
+            found = &searchResult{}
+            if best, result := matching.BestMatch(meta, convertToMetadata(target.Name(), candidates)); best >= 0 {
+                found = &searchResult{Match: &candidates[best], Result: result}
+            }
+            checkpoint.saveSearch(fromPlatform, track.ID, target.Name(), found)
+        }
+        if found.Match == nil || found.Result.Score < threshold {
+            unresolved = append(unresolved, track)
+            continue
+        }
+        resolved = append(resolved, resolution{Source: track, Match: *found.Match, Result: found.Result})
+    }
+    return resolved, unresolved, nil
+}
+
+// planAdditions определяет треки from, отсутствующие в плейлисте платформы to, и подбирает для них
+// треки платформы to. Сначала используется таблица соответствий, затем нечеткое сравнение и поиск.
+// Трек платформы to добавляется один раз, даже если ему соответствуют несколько треков from.
+func planAdditions(ctx context.Context, redisClient *storage.RedisClient, fromPlatform string, from []api.Track, to api.Provider, toTracks []api.Track, threshold float64, logger *logging.Logger) ([]api.Track, []resolution, []api.Track, error) {
+    toIDs := map[string]bool{}
+    for _, t := range toTracks {
+        toIDs[t.ID] = true
+    }
+    add := []api.Track{}
+    unmapped := []api.Track{}
+    for _, track := range from {
+        m, err := findMapping(ctx, redisClient, fromPlatform, track)
+        if err != nil {
+            logger.Errorf("Ошибка чтения соответствия %s:%s: %v", fromPlatform, track.ID, err)
+        }
+        mappedID := ""
+        if m != nil {
+            mappedID = m.IDs[to.Name()]
+        }
+        if mappedID == "" {
+            unmapped = append(unmapped, track)
+            continue
+        }
+        if !toIDs[mappedID] {
+            toIDs[mappedID] = true
+            add = append(add, api.Track{ID: mappedID, Name: track.Name, Artist: track.Artist})
+        }
+    }
+    missing := selectTracks(unmapped, matching.FindMissingTracks(convertToMetadata(fromPlatform, unmapped), convertToMetadata(to.Name(), toTracks)))
+    resolved, unresolved, err := resolveMissing(ctx, fromPlatform, to, missing, threshold, logger)
+    if err != nil {
+        return nil, nil, nil, err
+    }
+    for _, r := range resolved {
+        if toIDs[r.Match.ID] {
+            continue
+        }
+        toIDs[r.Match.ID] = true
+        add = append(add, r.Match)
+    }
+    return add, resolved, unresolved, nil
+}
+
+// mappingsFor формирует записи таблицы соответствий для найденных поиском треков.
+func mappingsFor(fromPlatform, toPlatform string, resolved []resolution) []*storage.TrackMapping {
+    result := []*storage.TrackMapping{}
+    for _, r := range resolved {
+        isrc := r.Source.ISRC
+        if isrc == "" {
+            isrc = r.Match.ISRC
+        }
+        result = append(result, &storage.TrackMapping{
+            IDs:        map[string]string{fromPlatform: r.Source.ID, toPlatform: r.Match.ID},
+            ISRC:       isrc,
+            Confidence: r.Result.Score,
+        })
+    }
+    return result
+}
+
+// saveMappings сохраняет найденные соответствия в таблицу соответствий.
+func saveMappings(ctx context.Context, redisClient *storage.RedisClient, mappings []*storage.TrackMapping, logger *logging.Logger) {
+    for _, m := range mappings {
+        if err := storage.SaveTrackMapping(ctx, redisClient, m); err != nil {
+            logger.Errorf("Ошибка сохранения соответствия %v: %v", m.IDs, err)
+        }
+    }
+}
+
+// searchQuery формирует поисковый запрос из нормализованных исполнителя и названия трека,
+// чтобы пометки вроде "(Official Video)" и суффиксы каналов не попадали в поиск.
+func searchQuery(meta matching.TrackMetadata) string {
+    n := matching.NormalizeTrack(meta)
+    return strings.TrimSpace(n.Artist + " " + n.Name)
+}
+
+// resolveThresholdFromEnv читает порог сходства из MATCH_THRESHOLD.
+func resolveThresholdFromEnv() float64 {
+    if v, err := strconv.ParseFloat(os.Getenv("MATCH_THRESHOLD"), 64); err == nil && v > 0 && v <= 1 {
+        return v
+    }
+    return DefaultResolveThreshold
+}
+
+// describeResolutions формирует записи отчета о найденных соответствиях с объяснением оценки.
+func describeResolutions(resolved []resolution) []ResolvedTrack {
+    result := []ResolvedTrack{}
+    for _, r := range resolved {
+        result = append(result, ResolvedTrack{
+            Source:      r.Source.Artist + " - " + r.Source.Name,
+            Match:       r.Match.Artist + " - " + r.Match.Name,
+            Score:       r.Result.Score,
+            Explanation: r.Result.Explain(),
+        })
+    }
+    return result
+}
+
+// describeTracks формирует список "Исполнитель - Название" для отчета.
+func describeTracks(tracks []api.Track) []string {
+    result := []string{}
+    for _, t := range tracks {
+        result = append(result, t.Artist+" - "+t.Name)
+    }
+    return result
+}
@@ -4,112 +4,282 @@ package sync
 import (
     "context"
     "encoding/json"
+    "errors"
     "fmt"
+    "net/http"
     "os"
+    "strconv"
     "time"
 
     "github.com/Clean1ines/scps/pkg/api"
+    "github.com/Clean1ines/scps/pkg/auth"
     "github.com/Clean1ines/scps/pkg/logging"
     "github.com/Clean1ines/scps/pkg/matching"
     "github.com/Clean1ines/scps/pkg/storage"
 )
 
-// SyncHandler обрабатывает HTTP-запрос на синхронизацию плейлистов.
-// Параметры передаются через query: ?spotify=<playlistID>&youtube=<playlistID>
-func SyncHandler(w http.ResponseWriter, r *http.Request) {
-    ctx := r.Context()
-    spotifyPlaylistID := r.URL.Query().Get("spotify")
-    youtubePlaylistID := r.URL.Query().Get("youtube")
-    if spotifyPlaylistID == "" || youtubePlaylistID == "" {
-        http.Error(w, "Укажите параметры spotify и youtube", 400)
-        return
-    }
-    logger, err := logging.NewLogger(ctx)
-    if err != nil {
-        http.Error(w, fmt.Sprintf("Ошибка логгера: %v", err), 500)
-        return
+// lastSyncReportKeyPrefix — префикс ключей Redis с отчетом о последней синхронизации пользователя:
+// last_sync_report:<chatID>.
+const lastSyncReportKeyPrefix = "last_sync_report:"
+
+// JobQueue ставит синхронизацию пары плейлистов в очередь фоновых задач (реализуется
+// pubsub.PubSubClient: пакет sync не зависит от очереди).
+type JobQueue interface {
+    // EnqueueSync публикует задачу синхронизации пары pair от имени пользователя chatID
+    // и возвращает ID задачи.
+    EnqueueSync(ctx context.Context, chatID int64, pair Pair) (string, error)
+}
+
+// NewSyncHandler возвращает обработчик HTTP-запроса на синхронизацию плейлистов, использующий
+// общие клиент Redis, очередь задач и логгер. Обработчик подключается через auth.Require:
+// синхронизация выполняется от имени пользователя, которому выдан токен; администратор указывает
+// пользователя в параметре chat_id.
+// Параметры передаются через query: ?spotify=<playlistID>&youtube=<playlistID>.
+// Необязательный direction (source_to_target, target_to_source, bidirectional) задает направление
+// относительно Spotify как источника, deletions (propagate, ignore, ask) — обработку удаленных треков.
+// С параметром order=1 порядок треков целевого плейлиста приводится к порядку источника.
+// С параметром dry_run=1 возвращает план синхронизации в JSON, не изменяя плейлисты.
+// Синхронизация выполняется обработчиком очереди, а не в рамках запроса: ответ 202 содержит
+// ID задачи, состояние которой доступно через /jobs/{id}.
+func NewSyncHandler(redisClient *storage.RedisClient, queue JobQueue, logger *logging.Logger) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        ctx := r.Context()
+        identity := auth.FromContext(ctx)
+        if identity == nil {
+            http.Error(w, auth.ErrUnauthorized.Error(), http.StatusUnauthorized)
+            return
+        }
+        chatID := identity.ChatID
+        if v := r.URL.Query().Get("chat_id"); v != "" {
+            id, err := strconv.ParseInt(v, 10, 64)
+            if err != nil {
+                http.Error(w, "Неверный параметр chat_id", 400)
+                return
+            }
+            if !identity.CanAccess(id) {
+                http.Error(w, "Нет доступа к плейлистам этого пользователя", http.StatusForbidden)
+                return
+            }
+            chatID = id
+        }
+        if chatID == 0 {
+            http.Error(w, "Укажите параметр chat_id", 400)
+            return
+        }
+        spotifyPlaylistID := r.URL.Query().Get("spotify")
+        youtubePlaylistID := r.URL.Query().Get("youtube")
+        if spotifyPlaylistID == "" || youtubePlaylistID == "" {
+            http.Error(w, "Укажите параметры spotify и youtube", 400)
+            return
+        }
+        ctx = WithUser(ctx, chatID)
+        direction, err := ParseDirection(r.URL.Query().Get("direction"))
+        if err != nil {
+            http.Error(w, err.Error(), 400)
+            return
+        }
+        deletions, err := ParseDeletionPolicy(r.URL.Query().Get("deletions"))
+        if err != nil {
+            http.Error(w, err.Error(), 400)
+            return
+        }
+        pair := spotifyYouTubePair(spotifyPlaylistID, youtubePlaylistID)
+        pair.Direction = direction
+        pair.Deletions = deletions
+        pair.PreserveOrder, _ = strconv.ParseBool(r.URL.Query().Get("order"))
+        if dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run")); dryRun {
+            plan, err := BuildPlan(ctx, redisClient, DefaultRegistry(redisClient, chatID), pair, logger)
+            if err != nil {
+                http.Error(w, fmt.Sprintf("Ошибка построения плана: %v", err), 500)
+                return
+            }
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(plan)
+            return
+        }
+        jobID, err := queue.EnqueueSync(ctx, chatID, pair)
+        if err != nil {
+            logger.Errorf("Ошибка публикации задачи синхронизации: %v", err)
+            http.Error(w, fmt.Sprintf("Ошибка запуска синхронизации: %v", err), 500)
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        w.Header().Set("Location", "/jobs/"+jobID)
+        w.WriteHeader(http.StatusAccepted)
+        json.NewEncoder(w).Encode(map[string]string{"job_id": jobID})
     }
-    redisClient, err := storage.NewRedisClient(os.Getenv("REDIS_ADDRESS"))
-    if err != nil {
-        http.Error(w, fmt.Sprintf("Ошибка подключения к Redis: %v", err), 500)
-        return
+}
+
+// Pair описывает пару синхронизируемых плейлистов на двух платформах.
+// Имена платформ совпадают с ключами реестра api.Registry ("spotify", "youtube").
+type Pair struct {
+    SourcePlatform   string         `json:"source_platform"`
+    SourcePlaylistID string         `json:"source_playlist_id"`
+    TargetPlatform   string         `json:"target_platform"`
+    TargetPlaylistID string         `json:"target_playlist_id"`
+    Direction        Direction      `json:"direction"`      // Пустое значение равносильно DirectionBidirectional
+    Deletions        DeletionPolicy `json:"deletions"`      // Обработка треков, удаленных после прошлой синхронизации
+    PreserveOrder    bool           `json:"preserve_order"` // Приводить порядок треков к порядку эталонного плейлиста (см. syncOrder)
+}
+
+// RunSync выполняет двустороннюю синхронизацию плейлистов между Spotify и YouTube Music
+// от имени пользователя chatID.
+func RunSync(ctx context.Context, redisClient *storage.RedisClient, chatID int64, spotifyPlaylistID, youtubePlaylistID string, logger *logging.Logger) error {
+    _, err := RunPairSync(WithUser(ctx, chatID), redisClient, DefaultRegistry(redisClient, chatID), spotifyYouTubePair(spotifyPlaylistID, youtubePlaylistID), logger)
+    return err
+}
+
+// RunPairSync синхронизирует произвольную пару плейлистов в направлении pair.Direction,
+// обращаясь к сервисам через провайдеров из реестра. Возвращает примененный план.
+// Синхронизация выполняется под распределенной блокировкой пары; если пара занята,
+// поведение определяется режимом из WithLockMode (в режиме LockCoalesce возвращается nil-план).
+// В рамках задачи (см. WithJob) синхронизация продолжается с контрольной точки прошлого запуска.
+func RunPairSync(ctx context.Context, redisClient *storage.RedisClient, registry *api.Registry, pair Pair, logger *logging.Logger) (*Plan, error) {
+    lockCtx, lease, err := lockPair(ctx, redisClient, pair, logger)
+    if errors.Is(err, ErrPairLocked) && lockModeFrom(ctx) == LockCoalesce {
+        logger.Infof("Синхронизация %s %s %s пропущена: пара уже синхронизируется", pair.SourcePlatform, pair.Direction.Arrow(), pair.TargetPlatform)
+        return nil, nil
     }
-    err = RunSync(ctx, redisClient, spotifyPlaylistID, youtubePlaylistID, logger)
     if err != nil {
-        http.Error(w, fmt.Sprintf("Ошибка синхронизации: %v", err), 500)
-        return
+        return nil, err
     }
-    w.WriteHeader(200)
-    w.Write([]byte("Синхронизация завершена успешно"))
-}
-
-// RunSync выполняет двустороннюю синхронизацию плейлистов между Spotify и YouTube Music.
-func RunSync(ctx context.Context, redisClient *storage.RedisClient, spotifyPlaylistID, youtubePlaylistID string, logger *logging.Logger) error {
-    // Получаем плейлист Spotify.
-    spotifyTracks, err := api.GetSpotifyPlaylist(ctx, redisClient, spotifyPlaylistID)
+    defer lease.Release(context.Background())
+    checkpoint, err := loadCheckpoint(lockCtx, redisClient, logger)
     if err != nil {
-        return fmt.Errorf("ошибка получения плейлиста Spotify: %v", err)
+        logger.Errorf("Ошибка чтения контрольной точки: %v", err)
+    }
+    if checkpoint != nil {
+        lockCtx = checkpoint.attach(lockCtx)
+    }
+    plan, err := BuildPlan(lockCtx, redisClient, registry, pair, logger)
+    if err == nil {
+        err = ApplyPlan(lockCtx, redisClient, registry, plan, logger)
+    }
+    if err != nil && lease.Lost() {
+        return plan, fmt.Errorf("%w: %v", ErrLeaseLost, err)
     }
-    // Получаем плейлист YouTube Music.
-    youtubeTracks, err := api.GetYouTubePlaylist(ctx, redisClient, youtubePlaylistID, os.Getenv("YOUTUBE_API_KEY"))
     if err != nil {
-        return fmt.Errorf("ошибка получения плейлиста YouTube: %v", err)
-    }
-    // Преобразуем треки для сравнения.
-    spotifyMeta := convertToMetadata(spotifyTracks)
-    youtubeMeta := convertToMetadata(youtubeTracks)
-    // Определяем недостающие треки.
-    missingOnYouTube := matching.FindMissingTracks(spotifyMeta, youtubeMeta)
-    missingOnSpotify := matching.FindMissingTracks(youtubeMeta, spotifyMeta)
-    // Обновляем плейлист на YouTube.
-    if len(missingOnYouTube) > 0 {
-        if err := api.AddTracksToYouTubePlaylist(ctx, redisClient, youtubePlaylistID, os.Getenv("YOUTUBE_API_KEY"), convertToTracks(missingOnYouTube)); err != nil {
-            logger.Errorf("Ошибка добавления треков на YouTube: %v", err)
-        }
+        // Контрольная точка сохраняется: повтор задачи продолжит синхронизацию с места остановки.
+        return plan, err
     }
-    // Обновляем плейлист на Spotify.
-    if len(missingOnSpotify) > 0 {
-        if err := api.AddTracksToSpotifyPlaylist(ctx, redisClient, spotifyPlaylistID, convertToTracks(missingOnSpotify)); err != nil {
-            logger.Errorf("Ошибка добавления треков на Spotify: %v", err)
+    if checkpoint != nil {
+        if err := DeleteCheckpoint(ctx, redisClient, jobIDFrom(ctx)); err != nil {
+            logger.Errorf("Ошибка удаления контрольной точки: %v", err)
         }
     }
-    // Сохраняем отчет о синхронизации в Redis.
+    // Сохраняем отчет о синхронизации в Redis для пользователя, от имени которого она выполнена.
     report := map[string]interface{}{
-        "timestamp":     time.Now().Unix(),
-        "spotify_added": len(missingOnSpotify),
-        "youtube_added": len(missingOnYouTube),
+        "timestamp":                         time.Now().Unix(),
+        pair.SourcePlatform + "_added":      len(plan.AddToSource),
+        pair.TargetPlatform + "_added":      len(plan.AddToTarget),
+        pair.SourcePlatform + "_total":      plan.SourceTotal,
+        pair.TargetPlatform + "_total":      plan.TargetTotal,
+        pair.SourcePlatform + "_resolved":   plan.ResolvedOnSource,
+        pair.TargetPlatform + "_resolved":   plan.ResolvedOnTarget,
+        pair.SourcePlatform + "_unresolved": plan.UnresolvedOnSource,
+        pair.TargetPlatform + "_unresolved": plan.UnresolvedOnTarget,
+        "truncated":                         plan.Truncated,
+        "direction":                         pair.Direction,
+        pair.SourcePlatform + "_removed":    len(plan.RemoveFromSource),
+        pair.TargetPlatform + "_removed":    len(plan.RemoveFromTarget),
+        "pending_deletions":                 append(plan.PendingOnSource, plan.PendingOnTarget...),
     }
     reportJSON, _ := json.Marshal(report)
-    redisClient.Set(ctx, "sync_report", reportJSON, 24*time.Hour)
-    logger.Infof("Двусторонняя синхронизация завершена успешно")
-    return nil
+    redisClient.Set(ctx, fmt.Sprintf("%s%d", lastSyncReportKeyPrefix, userFrom(ctx)), reportJSON, 24*time.Hour)
+    logger.Infof("Синхронизация %s %s %s завершена успешно", pair.SourcePlatform, pair.Direction.Arrow(), pair.TargetPlatform)
+    return plan, nil
+}
+
+// DefaultRegistry создает реестр провайдеров пользователя chatID с параметрами из переменных окружения.
+func DefaultRegistry(redisClient *storage.RedisClient, chatID int64) *api.Registry {
+    return api.NewDefaultRegistry(redisClient, chatID, os.Getenv("YOUTUBE_API_KEY"), pageOptionsFromEnv())
+}
+
+type userKey struct{}
+
+// WithUser возвращает контекст синхронизации от имени пользователя chatID: при сопоставлении
+// треков учитываются соответствия, исправленные этим пользователем (см. storage.CorrectTrackMapping).
+func WithUser(ctx context.Context, chatID int64) context.Context {
+    return context.WithValue(ctx, userKey{}, chatID)
+}
+
+// userFrom возвращает ID чата пользователя из контекста или 0.
+func userFrom(ctx context.Context) int64 {
+    chatID, _ := ctx.Value(userKey{}).(int64)
+    return chatID
+}
+
+// findMapping возвращает соответствие трека платформы platform с учетом исправлений пользователя
+// из контекста или nil, если соответствие не найдено.
+func findMapping(ctx context.Context, redisClient *storage.RedisClient, platform string, track api.Track) (*storage.TrackMapping, error) {
+    return storage.FindTrackMapping(ctx, redisClient, userFrom(ctx), platform, track.ID, track.ISRC)
+}
+
+// spotifyYouTubePair формирует пару "Spotify — YouTube" для синхронизации.
+func spotifyYouTubePair(spotifyPlaylistID, youtubePlaylistID string) Pair {
+    return Pair{
+        SourcePlatform:   api.PlatformSpotify,
+        SourcePlaylistID: spotifyPlaylistID,
+        TargetPlatform:   api.PlatformYouTube,
+        TargetPlaylistID: youtubePlaylistID,
+        Direction:        DirectionBidirectional,
+        Deletions:        DeletionAsk,
+    }
+}
+
+// pageOptionsFromEnv читает параметры постраничного чтения плейлистов
+// из PLAYLIST_PAGE_SIZE и PLAYLIST_MAX_ITEMS.
+func pageOptionsFromEnv() api.PageOptions {
+    opts := api.DefaultPageOptions()
+    if v, err := strconv.Atoi(os.Getenv("PLAYLIST_PAGE_SIZE")); err == nil {
+        opts.PageSize = v
+    }
+    if v, err := strconv.Atoi(os.Getenv("PLAYLIST_MAX_ITEMS")); err == nil {
+        opts.MaxItems = v
+    }
+    return opts
 }
 
-// convertToMetadata преобразует список треков в формат TrackMetadata для сравнения.
-func convertToMetadata(tracks []api.Track) []matching.TrackMetadata {
+// convertToMetadata преобразует список треков платформы в формат TrackMetadata для сравнения.
+func convertToMetadata(platform string, tracks []api.Track) []matching.TrackMetadata {
     result := []matching.TrackMetadata{}
     for _, t := range tracks {
-        result = append(result, matching.TrackMetadata{
-            Name:   t.Name,
-            Artist: t.Artist,
-        })
+        result = append(result, toMetadata(platform, t))
     }
     return result
 }
 
-// convertToTracks преобразует TrackMetadata обратно в формат треков для API.
-func convertToTracks(meta []matching.TrackMetadata) []api.Track {
+// toMetadata преобразует трек платформы в формат TrackMetadata.
+func toMetadata(platform string, t api.Track) matching.TrackMetadata {
+    return matching.TrackMetadata{
+        ID:       t.ID,
+        Platform: platform,
+        Name:     t.Name,
+        Artist:   t.Artist,
+        Album:    t.Album,
+        ISRC:     t.ISRC,
+        Duration: time.Duration(t.DurationMs) * time.Millisecond,
+        Explicit: t.Explicit,
+    }
+}
+
+// selectTracks возвращает исходные треки, соответствующие отобранным метаданным.
+func selectTracks(tracks []api.Track, meta []matching.TrackMetadata) []api.Track {
+    byID := map[string]api.Track{}
+    for _, t := range tracks {
+        byID[t.ID] = t
+    }
     result := []api.Track{}
     for _, m := range meta {
-        result = append(result, api.Track{
-            Name:   m.Name,
-            Artist: m.Artist,
-        })
+        if t, ok := byID[m.ID]; ok {
+            result = append(result, t)
+        }
     }
     return result
 }
 
-// RunPeriodicSync запускает синхронизацию каждые 30 минут, используя дефолтные ID из переменных окружения.
+// RunPeriodicSync запускает синхронизацию каждые 30 минут, используя дефолтные ID плейлистов
+// из переменных окружения и токены пользователя DEFAULT_CHAT_ID.
 func RunPeriodicSync(ctx context.Context, redisClient *storage.RedisClient, logger *logging.Logger) {
     ticker := time.NewTicker(30 * time.Minute)
     defer ticker.Stop()
@@ -120,8 +290,10 @@ func RunPeriodicSync(ctx context.Context, redisClient *storage.RedisClient, logg
         case <-ticker.C:
             spotifyID := os.Getenv("DEFAULT_SPOTIFY_PLAYLIST_ID")
             youtubeID := os.Getenv("DEFAULT_YOUTUBE_PLAYLIST_ID")
-            if spotifyID != "" && youtubeID != "" {
-                if err := RunSync(ctx, redisClient, spotifyID, youtubeID, logger); err != nil {
+            chatID, err := strconv.ParseInt(os.Getenv("DEFAULT_CHAT_ID"), 10, 64)
+            if spotifyID != "" && youtubeID != "" && err == nil {
+                // Если пара уже синхронизируется (ботом или через /sync), периодический запуск пропускается.
+                if err := RunSync(WithLockMode(ctx, LockCoalesce), redisClient, chatID, spotifyID, youtubeID, logger); err != nil {
                     logger.Errorf("Ошибка периодической синхронизации: %v", err)
                 }
             }
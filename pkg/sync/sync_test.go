@@ -0,0 +1,78 @@
+// pkg/sync/sync_test.go
+package sync
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/Clean1ines/scps/pkg/auth"
+    "github.com/Clean1ines/scps/pkg/logging"
+)
+
+// fakeQueue запоминает поставленные в очередь синхронизации.
+type fakeQueue struct {
+    chatIDs []int64
+    pairs   []Pair
+}
+
+func (q *fakeQueue) EnqueueSync(ctx context.Context, chatID int64, pair Pair) (string, error) {
+    q.chatIDs = append(q.chatIDs, chatID)
+    q.pairs = append(q.pairs, pair)
+    return "job-1", nil
+}
+
+func TestSyncHandlerUsesAuthenticatedUser(t *testing.T) {
+    queue := &fakeQueue{}
+    handler := NewSyncHandler(nil, queue, logging.NewStdLogger())
+    tests := []struct {
+        name     string
+        identity *auth.Identity
+        query    string
+        status   int
+    }{
+        {"без авторизации", nil, "?spotify=s&youtube=y", http.StatusUnauthorized},
+        {"чужой chat_id", &auth.Identity{ChatID: 7}, "?spotify=s&youtube=y&chat_id=8", http.StatusForbidden},
+        {"администратор без chat_id", &auth.Identity{Admin: true}, "?spotify=s&youtube=y", http.StatusBadRequest},
+        {"без плейлистов", &auth.Identity{ChatID: 7}, "?chat_id=7", http.StatusBadRequest},
+        {"задача в очереди", &auth.Identity{ChatID: 7}, "?spotify=s&youtube=y&direction=source_to_target", http.StatusAccepted},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            req := httptest.NewRequest("POST", "/sync"+tt.query, nil)
+            if tt.identity != nil {
+                req = req.WithContext(auth.WithIdentity(req.Context(), tt.identity))
+            }
+            w := httptest.NewRecorder()
+            handler(w, req)
+            if w.Code != tt.status {
+                t.Errorf("Статус %d, ожидался %d: %s", w.Code, tt.status, w.Body.String())
+            }
+        })
+    }
+    if len(queue.chatIDs) != 1 || queue.chatIDs[0] != 7 {
+        t.Fatalf("В очередь поставлены задачи пользователей %v, ожидался только 7", queue.chatIDs)
+    }
+    if p := queue.pairs[0]; p.SourcePlaylistID != "s" || p.TargetPlaylistID != "y" || p.Direction != DirectionSourceToTarget {
+        t.Errorf("Неверная пара в очереди: %+v", p)
+    }
+}
+
+func TestSyncHandlerReturnsJobID(t *testing.T) {
+    handler := NewSyncHandler(nil, &fakeQueue{}, logging.NewStdLogger())
+    req := httptest.NewRequest("POST", "/sync?spotify=s&youtube=y", nil)
+    req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{ChatID: 7}))
+    w := httptest.NewRecorder()
+    handler(w, req)
+    var body struct {
+        JobID string `json:"job_id"`
+    }
+    if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body.JobID != "job-1" {
+        t.Errorf("Ответ без ID задачи: %q (%v)", body.JobID, err)
+    }
+    if loc := w.Header().Get("Location"); loc != "/jobs/job-1" {
+        t.Errorf("Location = %q, ожидалось /jobs/job-1", loc)
+    }
+}
\ No newline at end of file
@@ -4,15 +4,19 @@ package telegram
 import (
     "context"
     "encoding/json"
+    "errors"
     "fmt"
     "strings"
     "time"
 
     tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
+    "github.com/Clean1ines/scps/pkg/api"
+    "github.com/Clean1ines/scps/pkg/auth"
     "github.com/Clean1ines/scps/pkg/logging"
     "github.com/Clean1ines/scps/pkg/oauth"
     "github.com/Clean1ines/scps/pkg/pubsub"
+    "github.com/Clean1ines/scps/pkg/storage"
     "github.com/Clean1ines/scps/pkg/sync"
     "github.com/go-redis/redis/v8"
 )
@@ -20,13 +24,23 @@ import (
 // Константы состояний диалога
 const (
     StateIdle           = "idle"
-    StateAwaitSource    = "await_source"  // Ожидание выбора исходного сервиса
-    StateAwaitURL       = "await_url"     // Ожидание ввода URL плейлиста
-    StateAwaitTarget    = "await_target"  // Ожидание выбора целевого сервиса
+    StateAwaitSource    = "await_source"     // Ожидание выбора исходного сервиса
+    StateAwaitURL       = "await_url"        // Ожидание ввода URL плейлиста
+    StateAwaitTarget    = "await_target"     // Ожидание выбора целевого сервиса
+    StateAwaitDirection = "await_direction"  // Ожидание выбора направления синхронизации
+    StateAwaitOrder     = "await_order"      // Ожидание выбора синхронизации порядка треков
+    StateAwaitTargetURL = "await_target_url" // Ожидание ввода URL целевого плейлиста
+    StateAwaitConfirm   = "await_confirm"    // Ожидание подтверждения плана синхронизации
     StateSyncInProgress = "sync_in_progress"
     StateSyncCompleted  = "sync_completed"
 )
 
+// cancelJobPrefix — префикс данных inline-кнопки отмены задачи: cancel_job_<ID>.
+const cancelJobPrefix = "cancel_job_"
+
+// maxMessageLength — максимальная длина текста сообщения Telegram.
+const maxMessageLength = 4096
+
 // SessionKey формирует ключ для хранения сессии пользователя в Redis.
 func SessionKey(chatID int64) string {
     return fmt.Sprintf("session:%d", chatID)
@@ -38,6 +52,10 @@ type Session struct {
     SourcePlatform string `json:"source_platform"` // "spotify" или "youtube"
     PlaylistURL    string `json:"playlist_url"`    // URL исходного плейлиста
     TargetPlatform string `json:"target_platform"` // "spotify" или "youtube"
+    TargetURL      string `json:"target_url"`      // URL целевого плейлиста
+    Direction      string `json:"direction"`       // Направление синхронизации (см. sync.Direction)
+    Deletions      string `json:"deletions"`       // Обработка удаленных треков (см. sync.DeletionPolicy)
+    PreserveOrder  bool   `json:"preserve_order"`  // Синхронизировать порядок треков (см. sync.Pair)
 }
 
 // Bot представляет Telegram-бота.
@@ -80,7 +98,7 @@ func (b *Bot) Start() {
 // handleMessage обрабатывает входящие сообщения и управляет диалогом.
 func (b *Bot) handleMessage(msg *tgbotapi.Message) {
     chatID := msg.Chat.ID
-    ctx := msg.Context()
+    ctx := context.Background()
     session, _ := b.getSession(ctx, chatID)
     if msg.IsCommand() {
         switch msg.Command() {
@@ -95,7 +113,19 @@ func (b *Bot) handleMessage(msg *tgbotapi.Message) {
         case "report":
             b.sendSyncReport(chatID)
         case "refresh":
-            b.refreshToken(ctx, chatID)
+            b.refreshToken(ctx, chatID, strings.TrimSpace(msg.CommandArguments()))
+        case "connect":
+            b.sendConnectLink(chatID, strings.TrimSpace(msg.CommandArguments()))
+        case "map":
+            b.correctMapping(ctx, chatID, msg.CommandArguments())
+        case "status":
+            b.sendJobStatus(ctx, chatID, strings.TrimSpace(msg.CommandArguments()))
+        case "deadletters":
+            b.sendDeadLetters(ctx, chatID)
+        case "replay":
+            b.replayDeadLetter(ctx, chatID, strings.TrimSpace(msg.CommandArguments()))
+        case "apitoken":
+            b.sendAPIToken(chatID)
         default:
             b.sendText(chatID, "Неизвестная команда. Используйте /start для начала.")
         }
@@ -108,6 +138,11 @@ func (b *Bot) handleMessage(msg *tgbotapi.Message) {
         session.State = StateAwaitTarget
         b.saveSession(ctx, chatID, session)
         b.sendTargetSelection(chatID)
+    case StateAwaitTargetURL:
+        session.TargetURL = msg.Text
+        b.saveSession(ctx, chatID, session)
+        b.sendText(chatID, "Формирование плана синхронизации...")
+        go b.previewSync(ctx, chatID, session)
     default:
         b.sendText(chatID, "Пожалуйста, используйте /start для начала работы бота.")
     }
@@ -119,6 +154,12 @@ func (b *Bot) handleCallback(cb *tgbotapi.CallbackQuery) {
     ctx := context.Background()
     session, _ := b.getSession(ctx, chatID)
     data := cb.Data
+    // Отмена задачи доступна в любом состоянии диалога.
+    if strings.HasPrefix(data, cancelJobPrefix) {
+        b.cancelJob(ctx, chatID, strings.TrimPrefix(data, cancelJobPrefix))
+        b.api.Request(tgbotapi.NewCallback(cb.ID, ""))
+        return
+    }
     switch session.State {
     case StateAwaitSource:
         if data == "source_spotify" || data == "source_youtube" {
@@ -129,11 +170,48 @@ func (b *Bot) handleCallback(cb *tgbotapi.CallbackQuery) {
         }
     case StateAwaitTarget:
         if data == "target_spotify" || data == "target_youtube" {
-            session.TargetPlatform = strings.TrimPrefix(data, "target_")
+            target := strings.TrimPrefix(data, "target_")
+            if target == session.SourcePlatform {
+                b.sendText(chatID, "Выберите сервис, отличный от источника")
+                break
+            }
+            session.TargetPlatform = target
+            session.State = StateAwaitDirection
+            b.saveSession(ctx, chatID, session)
+            b.sendDirectionSelection(chatID, session)
+        }
+    case StateAwaitDirection:
+        if !strings.HasPrefix(data, "direction_") {
+            break
+        }
+        if direction, err := sync.ParseDirection(strings.TrimPrefix(data, "direction_")); err == nil {
+            session.Direction = string(direction)
+            session.State = StateAwaitOrder
+            b.saveSession(ctx, chatID, session)
+            b.sendOrderSelection(chatID, session)
+        }
+    case StateAwaitOrder:
+        if data == "order_keep" || data == "order_ignore" {
+            session.PreserveOrder = data == "order_keep"
+            session.State = StateAwaitTargetURL
+            b.saveSession(ctx, chatID, session)
+            b.sendText(chatID, "Введите URL целевого плейлиста")
+        }
+    case StateAwaitConfirm:
+        switch data {
+        case "confirm", "confirm_delete":
+            if data == "confirm_delete" {
+                session.Deletions = string(sync.DeletionPropagate)
+            }
             session.State = StateSyncInProgress
             b.saveSession(ctx, chatID, session)
             b.sendText(chatID, "Запуск синхронизации...")
             go b.runSync(ctx, chatID, session)
+        case "cancel":
+            session = &Session{State: StateAwaitSource}
+            b.saveSession(ctx, chatID, session)
+            b.sendText(chatID, "Синхронизация отменена")
+            b.sendSourceSelection(chatID)
         }
     case StateSyncCompleted:
         if data == "restart" {
@@ -148,70 +226,300 @@ func (b *Bot) handleCallback(cb *tgbotapi.CallbackQuery) {
     b.api.Request(callback)
 }
 
+// previewSync строит план синхронизации без изменения плейлистов и предлагает подтвердить его.
+func (b *Bot) previewSync(ctx context.Context, chatID int64, session *Session) {
+    pair, err := sessionPair(b.redisClient, chatID, session)
+    if err != nil {
+        b.sendText(chatID, fmt.Sprintf("Неверный URL плейлиста: %v. Введите URL целевого плейлиста", err))
+        return
+    }
+    plan, err := sync.BuildPlan(sync.WithUser(ctx, chatID), b.redisClient, sync.DefaultRegistry(b.redisClient, chatID), pair, b.logger)
+    if err != nil {
+        b.logger.Errorf("Ошибка построения плана: %v", err)
+        b.sendText(chatID, fmt.Sprintf("Ошибка построения плана: %v", err))
+        return
+    }
+    session.State = StateAwaitConfirm
+    b.saveSession(ctx, chatID, session)
+    b.sendConfirmation(chatID, plan)
+}
+
 // runSync инициирует двустороннюю синхронизацию плейлистов.
 func (b *Bot) runSync(ctx context.Context, chatID int64, session *Session) {
-    // Извлекаем идентификаторы плейлистов из URL.
-    // Здесь должна быть реализация парсинга URL в соответствии с форматами Spotify и YouTube.
-    // В этой реализации мы просто берем последний сегмент URL.
-    spotifyID := extractPlaylistID(session.PlaylistURL, session.SourcePlatform, "spotify")
-    youtubeID := extractPlaylistID(session.PlaylistURL, session.SourcePlatform, "youtube")
-    // Если исходный сервис совпадает с целевым, обновляется существующий плейлист.
-    if session.TargetPlatform == "spotify" {
-        // Если пользователь выбрал Spotify как целевую платформу, используем spotifyID.
-    } else if session.TargetPlatform == "youtube" {
-        // Если выбран YouTube как целевая, используем youtubeID.
-    }
-    // Формируем задачу синхронизации.
-    task := pubsub.SyncTask{
-        Type:              "sync_playlist",
-        SpotifyPlaylistID: spotifyID,
-        YouTubePlaylistID: youtubeID,
-        ChatID:            chatID,
-    }
-    if err := b.psClient.PublishTask(ctx, task); err != nil {
+    pair, err := sessionPair(b.redisClient, chatID, session)
+    if err != nil {
+        b.sendText(chatID, fmt.Sprintf("Неверный URL плейлиста: %v", err))
+        return
+    }
+    jobID, err := b.psClient.PublishTask(ctx, pubsub.NewSyncTask(chatID, pair))
+    if err != nil {
         b.logger.Errorf("Ошибка публикации задачи: %v", err)
         b.sendText(chatID, fmt.Sprintf("Ошибка запуска синхронизации: %v", err))
         return
     }
-    b.sendText(chatID, "Синхронизация запущена. По завершении вы получите отчет.")
+    msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Синхронизация запущена (задача %s). По завершении вы получите отчет.\nСостояние: /status %s", jobID, jobID))
+    msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+        tgbotapi.NewInlineKeyboardRow(
+            tgbotapi.NewInlineKeyboardButtonData("Отменить", cancelJobPrefix+jobID),
+        ),
+    )
+    b.send(msg)
     session.State = StateSyncCompleted
     b.saveSession(ctx, chatID, session)
     b.sendRestartButton(chatID)
 }
 
-// refreshToken обновляет Spotify access_token по команде /refresh.
-func (b *Bot) refreshToken(ctx context.Context, chatID int64) {
-    tokenJSON, err := b.redisClient.Get(ctx, "spotify_token").Result()
+// sendConnectLink отправляет ссылку авторизации в сервисе по команде /connect spotify|youtube.
+// Токен, полученный по ссылке, сохраняется для этого чата; о результате сообщает обработчик callback.
+func (b *Bot) sendConnectLink(chatID int64, service string) {
+    var (
+        authURL string
+        title   string
+        err     error
+    )
+    switch strings.ToLower(service) {
+    case api.PlatformSpotify:
+        title = "Spotify"
+        authURL, err = oauth.SpotifyAuthURL(chatID)
+    case api.PlatformYouTube:
+        title = "YouTube"
+        authURL, err = oauth.YouTubeAuthURL(chatID)
+    default:
+        b.sendText(chatID, "Использование: /connect spotify или /connect youtube")
+        return
+    }
+    if err != nil {
+        b.logger.Errorf("Ошибка формирования ссылки авторизации %s: %v", title, err)
+        b.sendText(chatID, fmt.Sprintf("Не удалось сформировать ссылку авторизации %s: %v", title, err))
+        return
+    }
+    msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Откройте ссылку, чтобы подключить %s. Ссылка действительна 10 минут.", title))
+    msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+        tgbotapi.NewInlineKeyboardRow(
+            tgbotapi.NewInlineKeyboardButtonURL("Подключить "+title, authURL),
+        ),
+    )
+    b.send(msg)
+}
+
+// refreshToken обновляет токены пользователя по команде /refresh [spotify|youtube];
+// без аргумента обновляются токены всех подключенных сервисов.
+func (b *Bot) refreshToken(ctx context.Context, chatID int64, service string) {
+    platforms := []string{api.PlatformSpotify, api.PlatformYouTube}
+    if service != "" {
+        platforms = []string{strings.ToLower(service)}
+    }
+    for _, platform := range platforms {
+        err := oauth.RefreshToken(ctx, b.redisClient, platform, chatID)
+        if errors.Is(err, oauth.ErrNotConnected) && service == "" {
+            continue
+        }
+        if err != nil {
+            b.logger.Errorf("Ошибка обновления токена %s пользователя %d: %v", platform, chatID, err)
+            b.sendText(chatID, fmt.Sprintf("Ошибка обновления токена: %v", err))
+            continue
+        }
+        b.sendText(chatID, fmt.Sprintf("Токен %s обновлен", platform))
+    }
+}
+
+// correctMapping сохраняет заданное пользователем соответствие трека по команде
+// /map <spotify_track_id> <youtube_video_id>. Соответствие сохраняется, только если оба ID
+// существуют, и применяется только к синхронизациям этого пользователя.
+func (b *Bot) correctMapping(ctx context.Context, chatID int64, args string) {
+    fields := strings.Fields(args)
+    if len(fields) != 2 {
+        b.sendText(chatID, "Использование: /map <ID трека Spotify> <ID видео YouTube>")
+        return
+    }
+    ids := map[string]string{api.PlatformSpotify: fields[0], api.PlatformYouTube: fields[1]}
+    registry := sync.DefaultRegistry(b.redisClient, chatID)
+    for platform, id := range ids {
+        provider, err := registry.Get(platform)
+        if err == nil {
+            _, err = provider.GetTrack(ctx, id)
+        }
+        if errors.Is(err, api.ErrTrackNotFound) {
+            b.sendText(chatID, fmt.Sprintf("Трек %s не найден на %s", id, platform))
+            return
+        }
+        if err != nil {
+            b.logger.Errorf("Ошибка проверки трека %s:%s: %v", platform, id, err)
+            b.sendText(chatID, fmt.Sprintf("Не удалось проверить трек %s: %v", id, err))
+            return
+        }
+    }
+    mapping := &storage.TrackMapping{IDs: ids}
+    if err := storage.CorrectTrackMapping(ctx, b.redisClient, chatID, mapping); err != nil {
+        b.logger.Errorf("Ошибка сохранения соответствия: %v", err)
+        b.sendText(chatID, "Ошибка сохранения соответствия")
+        return
+    }
+    b.sendText(chatID, "Соответствие сохранено")
+}
+
+// sendJobStatus отправляет состояние задачи по команде /status <ID> или, без аргумента,
+// состояние последних задач пользователя.
+func (b *Bot) sendJobStatus(ctx context.Context, chatID int64, id string) {
+    if id != "" {
+        job, err := b.psClient.Job(ctx, id)
+        if err == nil && job.ChatID != chatID {
+            err = pubsub.ErrJobNotFound
+        }
+        if err == pubsub.ErrJobNotFound {
+            b.sendText(chatID, "Задача не найдена")
+            return
+        }
+        if err != nil {
+            b.logger.Errorf("Ошибка чтения задачи %s: %v", id, err)
+            b.sendText(chatID, "Ошибка чтения состояния задачи")
+            return
+        }
+        b.sendText(chatID, job.Summary())
+        return
+    }
+    jobs, err := b.psClient.ChatJobs(ctx, chatID)
+    if err != nil {
+        b.logger.Errorf("Ошибка чтения задач чата %d: %v", chatID, err)
+        b.sendText(chatID, "Ошибка чтения состояния задач")
+        return
+    }
+    if len(jobs) == 0 {
+        b.sendText(chatID, "Задач пока нет. Используйте /start для запуска синхронизации.")
+        return
+    }
+    if len(jobs) > 5 {
+        jobs = jobs[:5]
+    }
+    summaries := make([]string, 0, len(jobs))
+    for _, job := range jobs {
+        summaries = append(summaries, job.Summary())
+    }
+    b.sendText(chatID, strings.Join(summaries, "\n\n"))
+}
+
+// cancelJob отменяет задачу пользователя по нажатию кнопки "Отменить".
+func (b *Bot) cancelJob(ctx context.Context, chatID int64, id string) {
+    job, err := b.psClient.Job(ctx, id)
+    if err == nil && job.ChatID != chatID {
+        err = pubsub.ErrJobNotFound
+    }
+    if err == nil {
+        job, err = b.psClient.CancelJob(ctx, id)
+    }
+    switch {
+    case err == pubsub.ErrJobNotFound:
+        b.sendText(chatID, "Задача не найдена")
+    case err == pubsub.ErrJobFinished:
+        b.sendText(chatID, fmt.Sprintf("Задача уже %s", job.Status.Title()))
+    case err != nil:
+        b.logger.Errorf("Ошибка отмены задачи %s: %v", id, err)
+        b.sendText(chatID, "Ошибка отмены задачи")
+    case job.Status == pubsub.JobCancelled:
+        b.sendText(chatID, "Синхронизация отменена до начала выполнения")
+    default:
+        b.sendText(chatID, "Отмена запрошена, синхронизация будет остановлена")
+    }
+}
+
+// sendDeadLetters отправляет список недоставленных задач пользователя.
+func (b *Bot) sendDeadLetters(ctx context.Context, chatID int64) {
+    letters, err := b.psClient.DeadLetters(ctx)
     if err != nil {
-        b.sendText(chatID, "Ошибка получения токена")
+        b.logger.Errorf("Ошибка чтения недоставленных задач: %v", err)
+        b.sendText(chatID, "Ошибка чтения недоставленных задач")
+        return
+    }
+    text := ""
+    for _, dl := range letters {
+        if dl.Task.ChatID != chatID {
+            continue
+        }
+        text += fmt.Sprintf("%s — %s, попыток: %d, %s\n%s\n", dl.ID, dl.Task.Type, dl.Attempts, dl.FailedAt.Format("02.01 15:04"), dl.Error)
+    }
+    if text == "" {
+        b.sendText(chatID, "Недоставленных задач нет")
+        return
+    }
+    b.sendText(chatID, "Недоставленные задачи:\n"+text+"Повторить: /replay <ID>")
+}
+
+// replayDeadLetter публикует заново недоставленную задачу пользователя по команде /replay <ID>.
+func (b *Bot) replayDeadLetter(ctx context.Context, chatID int64, id string) {
+    if id == "" {
+        b.sendText(chatID, "Использование: /replay <ID задачи из /deadletters>")
         return
     }
-    var tokenData map[string]interface{}
-    json.Unmarshal([]byte(tokenJSON), &tokenData)
-    refreshToken, ok := tokenData["refresh_token"].(string)
-    if !ok || refreshToken == "" {
-        b.sendText(chatID, "Нет refresh_token")
+    dl, err := b.psClient.DeadLetter(ctx, id)
+    if err == nil && dl.Task.ChatID != chatID {
+        err = pubsub.ErrDeadLetterNotFound
+    }
+    if err == nil {
+        _, err = b.psClient.ReplayDeadLetter(ctx, id)
+    }
+    if err == pubsub.ErrDeadLetterNotFound {
+        b.sendText(chatID, "Задача не найдена")
         return
     }
-    newToken, err := oauth.RefreshSpotifyToken(refreshToken)
     if err != nil {
-        b.sendText(chatID, "Ошибка обновления токена")
+        b.logger.Errorf("Ошибка повторной публикации задачи %s: %v", id, err)
+        b.sendText(chatID, "Ошибка повторной публикации задачи")
         return
     }
-    newJSON, _ := json.Marshal(newToken)
-    b.redisClient.Set(ctx, "spotify_token", newJSON, time.Hour)
-    b.sendText(chatID, "Токен обновлен")
+    b.sendText(chatID, "Задача поставлена в очередь повторно")
 }
 
-// extractPlaylistID извлекает идентификатор плейлиста из URL для данной платформы.
-func extractPlaylistID(url, sourcePlatform, targetPlatform string) string {
-    // Реализация должна учитывать форматы URL Spotify и YouTube.
-    // Здесь просто берется последний сегмент строки.
-    parts := strings.Split(url, "/")
-    if len(parts) > 0 {
-        return parts[len(parts)-1]
+// sendAPIToken выдает пользователю токен HTTP API (/sync, /jobs, /dead-letters) для его чата.
+func (b *Bot) sendAPIToken(chatID int64) {
+    token, err := auth.IssueToken(chatID, time.Now())
+    if err == auth.ErrNotConfigured {
+        b.sendText(chatID, "HTTP API недоступно: ключ подписи токенов не задан")
+        return
+    }
+    if err != nil {
+        b.logger.Errorf("Ошибка выдачи токена API для чата %d: %v", chatID, err)
+        b.sendText(chatID, "Ошибка выдачи токена API")
+        return
     }
-    return ""
+    b.sendText(chatID, fmt.Sprintf("Токен HTTP API (действует до %s), передавайте его в заголовке Authorization: Bearer <токен>\n%s", time.Now().Add(auth.TokenTTL).Format("02.01.2006"), token))
+}
+
+// sessionPair определяет идентификаторы плейлистов по URL, введенным в сессии пользователя chatID.
+func sessionPair(redisClient *redis.Client, chatID int64, session *Session) (sync.Pair, error) {
+    registry := sync.DefaultRegistry(redisClient, chatID)
+    source, err := registry.Get(session.SourcePlatform)
+    if err != nil {
+        return sync.Pair{}, err
+    }
+    target, err := registry.Get(session.TargetPlatform)
+    if err != nil {
+        return sync.Pair{}, err
+    }
+    sourceID, err := source.ResolveURL(session.PlaylistURL)
+    if err != nil {
+        return sync.Pair{}, err
+    }
+    targetID, err := target.ResolveURL(session.TargetURL)
+    if err != nil {
+        return sync.Pair{}, err
+    }
+    direction, err := sync.ParseDirection(session.Direction)
+    if err != nil {
+        return sync.Pair{}, err
+    }
+    deletions, err := sync.ParseDeletionPolicy(session.Deletions)
+    if err != nil {
+        return sync.Pair{}, err
+    }
+    return sync.Pair{
+        SourcePlatform:   session.SourcePlatform,
+        SourcePlaylistID: sourceID,
+        TargetPlatform:   session.TargetPlatform,
+        TargetPlaylistID: targetID,
+        Direction:        direction,
+        Deletions:        deletions,
+        PreserveOrder:    session.PreserveOrder,
+    }, nil
 }
 
 // saveSession сохраняет состояние сессии в Redis.
@@ -243,7 +551,7 @@ func (b *Bot) sendSourceSelection(chatID int64) {
         ),
     )
     msg.ReplyMarkup = buttons
-    b.api.Send(msg)
+    b.send(msg)
 }
 
 // sendTargetSelection отправляет кнопки для выбора целевого сервиса.
@@ -256,7 +564,75 @@ func (b *Bot) sendTargetSelection(chatID int64) {
         ),
     )
     msg.ReplyMarkup = buttons
-    b.api.Send(msg)
+    b.send(msg)
+}
+
+// sendDirectionSelection отправляет кнопки для выбора направления синхронизации.
+func (b *Bot) sendDirectionSelection(chatID int64, session *Session) {
+    source, target := platformTitle(session.SourcePlatform), platformTitle(session.TargetPlatform)
+    msg := tgbotapi.NewMessage(chatID, "Выберите направление синхронизации:")
+    buttons := tgbotapi.NewInlineKeyboardMarkup(
+        tgbotapi.NewInlineKeyboardRow(
+            tgbotapi.NewInlineKeyboardButtonData(source+" → "+target, "direction_"+string(sync.DirectionSourceToTarget)),
+        ),
+        tgbotapi.NewInlineKeyboardRow(
+            tgbotapi.NewInlineKeyboardButtonData(target+" → "+source, "direction_"+string(sync.DirectionTargetToSource)),
+        ),
+        tgbotapi.NewInlineKeyboardRow(
+            tgbotapi.NewInlineKeyboardButtonData(source+" ↔ "+target, "direction_"+string(sync.DirectionBidirectional)),
+        ),
+    )
+    msg.ReplyMarkup = buttons
+    b.send(msg)
+}
+
+// sendOrderSelection отправляет кнопки для выбора синхронизации порядка треков. Эталоном порядка
+// служит источник, а при направлении target_to_source — целевой плейлист (см. sync.Pair).
+func (b *Bot) sendOrderSelection(chatID int64, session *Session) {
+    ref, list := platformTitle(session.SourcePlatform), platformTitle(session.TargetPlatform)
+    if session.Direction == string(sync.DirectionTargetToSource) {
+        ref, list = list, ref
+    }
+    msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Синхронизировать порядок треков? Порядок плейлиста %s будет приведен к порядку %s:", list, ref))
+    buttons := tgbotapi.NewInlineKeyboardMarkup(
+        tgbotapi.NewInlineKeyboardRow(
+            tgbotapi.NewInlineKeyboardButtonData("Сохранять порядок", "order_keep"),
+            tgbotapi.NewInlineKeyboardButtonData("Не менять порядок", "order_ignore"),
+        ),
+    )
+    msg.ReplyMarkup = buttons
+    b.send(msg)
+}
+
+// platformTitle возвращает название платформы для кнопок.
+func platformTitle(platform string) string {
+    switch platform {
+    case api.PlatformSpotify:
+        return "Spotify"
+    case api.PlatformYouTube:
+        return "YouTube"
+    default:
+        return platform
+    }
+}
+
+// sendConfirmation отправляет план синхронизации с кнопками подтверждения и отмены.
+// Если в плане есть удаления, ожидающие подтверждения, добавляется кнопка их применения.
+func (b *Bot) sendConfirmation(chatID int64, plan *sync.Plan) {
+    msg := tgbotapi.NewMessage(chatID, "План синхронизации:\n"+plan.Summary())
+    rows := [][]tgbotapi.InlineKeyboardButton{
+        tgbotapi.NewInlineKeyboardRow(
+            tgbotapi.NewInlineKeyboardButtonData("Подтвердить", "confirm"),
+            tgbotapi.NewInlineKeyboardButtonData("Отмена", "cancel"),
+        ),
+    }
+    if plan.HasPendingDeletions() {
+        rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+            tgbotapi.NewInlineKeyboardButtonData("Подтвердить с удалением", "confirm_delete"),
+        ))
+    }
+    msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+    b.send(msg)
 }
 
 // sendRestartButton отправляет кнопку Restart для перезапуска диалога.
@@ -268,13 +644,56 @@ func (b *Bot) sendRestartButton(chatID int64) {
         ),
     )
     msg.ReplyMarkup = buttons
-    b.api.Send(msg)
+    b.send(msg)
+}
+
+// Notify отправляет пользователю уведомление о завершении задачи или результате авторизации
+// (реализует pubsub.Notifier и oauth.Notifier).
+func (b *Bot) Notify(chatID int64, text string) {
+    b.sendText(chatID, text)
 }
 
 // sendText отправляет текстовое сообщение пользователю.
 func (b *Bot) sendText(chatID int64, text string) {
-    msg := tgbotapi.NewMessage(chatID, text)
-    b.api.Send(msg)
+    b.send(tgbotapi.NewMessage(chatID, text))
+}
+
+// send отправляет сообщение, сокращая текст до ограничения Telegram, и записывает в журнал
+// ошибку отправки: иначе сообщение, отклоненное Telegram, теряется без следа.
+func (b *Bot) send(msg tgbotapi.MessageConfig) {
+    msg.Text = truncateMessage(msg.Text, maxMessageLength)
+    if _, err := b.api.Send(msg); err != nil {
+        b.logger.Errorf("Ошибка отправки сообщения в чат %d: %v", msg.ChatID, err)
+    }
+}
+
+// truncateMessage сокращает текст до limit символов UTF-16 (так длину сообщения считает Telegram),
+// отмечая сокращение многоточием.
+func truncateMessage(text string, limit int) string {
+    const marker = "\n…"
+    if utf16Len(text) <= limit {
+        return text
+    }
+    n := 0
+    for i, r := range text {
+        n += utf16Len(string(r))
+        if n > limit-utf16Len(marker) {
+            return text[:i] + marker
+        }
+    }
+    return text
+}
+
+// utf16Len возвращает длину строки в символах UTF-16.
+func utf16Len(s string) int {
+    n := 0
+    for _, r := range s {
+        n++
+        if r >= 0x10000 {
+            n++ // Символ вне BMP занимает суррогатную пару
+        }
+    }
+    return n
 }
 
 // sendSyncReport получает отчет синхронизации из Redis и отправляет его пользователю.
@@ -288,13 +707,13 @@ func (b *Bot) sendSyncReport(chatID int64) {
         b.sendText(chatID, "Отчет не найден")
         return
     }
-    var report SyncReport
+    var report pubsub.SyncReport
     if err := json.Unmarshal([]byte(data), &report); err != nil {
         b.logger.Errorf("Ошибка разбора отчета: %v", err)
         b.sendText(chatID, "Ошибка формирования отчета")
         return
     }
-    msgText := fmt.Sprintf("Синхронизация завершена.\nДобавлено на Spotify: %d треков\nДобавлено на YouTube: %d треков\n", report.SuccessCount, report.SuccessCount)
+    msgText := fmt.Sprintf("Успешных синхронизаций: %d\nДобавлено на Spotify: %d треков\nДобавлено на YouTube: %d треков\n", report.SuccessCount, report.Added[api.PlatformSpotify], report.Added[api.PlatformYouTube])
     if len(report.Errors) == 0 {
         msgText += "Ошибок не обнаружено."
     } else {
@@ -303,5 +722,11 @@ func (b *Bot) sendSyncReport(chatID int64) {
             msgText += "- " + errMsg + "\n"
         }
     }
+    if len(report.Matches) > 0 {
+        msgText += "\nНайденные соответствия:\n"
+        for _, m := range report.Matches {
+            msgText += "- " + m + "\n"
+        }
+    }
     b.sendText(chatID, msgText)
 }
\ No newline at end of file
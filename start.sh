@@ -1,20 +1,44 @@
 #!/bin/sh
 # start.sh – Скрипт для сборки и запуска проекта в iSH
 
-export TELEGRAM_BOT_TOKEN="7683033592AAGdvZdkMkl3-rjSRp3YHRYIwWEVg06gRXY"
 export WEBHOOK_URL="https://youtify-211829086557.us-central1.run.app"
 export REDIS_ADDRESS="localhost:6379"
 export PORT="8080"
 export SPOTIFY_CLIENT_ID="19031702dc8e4866a231f755411d8877"
-export SPOTIFY_CLIENT_SECRET="cd45d96a403c4b9e8d651052099d6020"
 export SPOTIFY_REDIRECT_URI="https://youtify-211829086557.us-central1.run.app/spotify/callback"
 export YOUTUBE_CLIENT_ID="your_youtube_client_id"
-export YOUTUBE_CLIENT_SECRET="your_youtube_client_secret"
 export YOUTUBE_REDIRECT_URI="https://youtify-211829086557.us-central1.run.app/youtube/callback"
 export GOOGLE_CLOUD_PROJECT="youtifyBot"
-export ACOUSTID_API_KEY="EMX96S9tia"
+export QUEUE_BACKEND="redis"
+export TASK_MAX_ATTEMPTS="5"
 export DEFAULT_SPOTIFY_PLAYLIST_ID="your_default_spotify_playlist_id"
 export DEFAULT_YOUTUBE_PLAYLIST_ID="your_default_youtube_playlist_id"
+export DEFAULT_CHAT_ID="your_telegram_chat_id"
+
+# Секреты (токен бота, client secret OAuth, ключ подписи state, ключи API) не хранятся в скрипте:
+# они читаются из файла secrets.env, который не добавляется в git. Пример содержимого:
+#   export TELEGRAM_BOT_TOKEN="..."
+#   export SPOTIFY_CLIENT_SECRET="..."
+#   export YOUTUBE_CLIENT_SECRET="..."
+#   export OAUTH_STATE_SECRET="..." # Обязателен: ключ подписи state OAuth, общий для всех экземпляров
+#   export ADMIN_API_TOKEN="..."   # Токен администратора HTTP API (/sync, /jobs, /dead-letters)
+#   export API_TOKEN_SECRET="..."  # Ключ подписи токенов пользователей HTTP API (команда /apitoken)
+#   export ACOUSTID_API_KEY="..."
+SECRETS_FILE="${SECRETS_FILE:-./secrets.env}"
+if [ -f "$SECRETS_FILE" ]; then
+    . "$SECRETS_FILE"
+else
+    echo "Файл секретов $SECRETS_FILE не найден: секреты должны быть заданы в окружении."
+fi
+
+# Ключи шифрования токенов OAuth в Redis: строки <ID>:<base64 32-байтного ключа>.
+# Для ротации добавьте новый ключ, укажите его в TOKEN_ENCRYPTION_KEY_ID, выполните
+# "./scps rotate-token-keys" и после этого удалите прежний ключ из файла.
+export TOKEN_ENCRYPTION_KEY_FILE="${TOKEN_ENCRYPTION_KEY_FILE:-./token_keys}"
+if [ ! -f "$TOKEN_ENCRYPTION_KEY_FILE" ]; then
+    echo "Создаем ключ шифрования токенов $TOKEN_ENCRYPTION_KEY_FILE..."
+    (umask 077 && echo "k1:$(head -c 32 /dev/urandom | base64)" > "$TOKEN_ENCRYPTION_KEY_FILE")
+fi
 
 echo "Переменные окружения установлены."
 